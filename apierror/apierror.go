@@ -0,0 +1,156 @@
+// Package apierror is the shape every failed API request is answered with:
+//
+//	{"error": {"code": "group_not_found", "message": "Group not found", "request_id": "..."}}
+//
+// The code is stable and meant for programs; the message is for people and may change. Validation
+// failures add the offending fields under "details".
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/validation"
+	"log"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID the request is known by in responses and logs.
+const RequestIDHeader = "X-Request-ID"
+
+// Code is a machine-readable error code. Each one always comes with the same HTTP status.
+type Code string
+
+const (
+	InvalidRequest       Code = "invalid_request"        // malformed body, path or query parameter
+	ValidationFailed     Code = "validation_failed"      // well-formed but breaks the rules; see details
+	Unauthenticated      Code = "unauthenticated"        // missing, invalid or expired token
+	InvalidCredentials   Code = "invalid_credentials"    // wrong email or password
+	Forbidden            Code = "forbidden"              // authenticated but not allowed
+	NotFound             Code = "not_found"              // no such route
+	MethodNotAllowed     Code = "method_not_allowed"     // route exists but not for this method
+	Conflict             Code = "conflict"               // not possible in the resource's current state
+	PayloadTooLarge      Code = "payload_too_large"      // upload over the size limit
+	UnsupportedMediaType Code = "unsupported_media_type" // upload of a type that is not accepted
+	Internal             Code = "internal_error"         // a fault on our side; quote the request ID
+
+	UserNotFound             Code = "user_not_found"
+	GroupNotFound            Code = "group_not_found"
+	MemberNotFound           Code = "member_not_found" // the user exists but is not in the group
+	NotGroupMembers          Code = "not_group_members"
+	CategoryNotFound         Code = "category_not_found"
+	ExpenseNotFound          Code = "expense_not_found"
+	RevisionNotFound         Code = "revision_not_found"
+	RecurringExpenseNotFound Code = "recurring_expense_not_found"
+	AttachmentNotFound       Code = "attachment_not_found"
+	SettlementNotFound       Code = "settlement_not_found"
+	ExchangeRateNotFound     Code = "exchange_rate_not_found"
+	ExchangeRateUnavailable  Code = "exchange_rate_unavailable" // an amount cannot be converted
+	NothingToSettle          Code = "nothing_to_settle"
+	OverpaymentLimit         Code = "overpayment_limit"
+)
+
+var statuses = map[Code]int{
+	InvalidRequest:       http.StatusBadRequest,
+	ValidationFailed:     http.StatusUnprocessableEntity,
+	Unauthenticated:      http.StatusUnauthorized,
+	InvalidCredentials:   http.StatusUnauthorized,
+	Forbidden:            http.StatusForbidden,
+	NotFound:             http.StatusNotFound,
+	MethodNotAllowed:     http.StatusMethodNotAllowed,
+	Conflict:             http.StatusConflict,
+	PayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	UnsupportedMediaType: http.StatusUnsupportedMediaType,
+	Internal:             http.StatusInternalServerError,
+
+	UserNotFound:             http.StatusNotFound,
+	GroupNotFound:            http.StatusNotFound,
+	MemberNotFound:           http.StatusNotFound,
+	NotGroupMembers:          http.StatusUnprocessableEntity,
+	CategoryNotFound:         http.StatusNotFound,
+	ExpenseNotFound:          http.StatusNotFound,
+	RevisionNotFound:         http.StatusNotFound,
+	RecurringExpenseNotFound: http.StatusNotFound,
+	AttachmentNotFound:       http.StatusNotFound,
+	SettlementNotFound:       http.StatusNotFound,
+	ExchangeRateNotFound:     http.StatusNotFound,
+	ExchangeRateUnavailable:  http.StatusUnprocessableEntity,
+	NothingToSettle:          http.StatusBadRequest,
+	OverpaymentLimit:         http.StatusUnprocessableEntity,
+}
+
+// Status is the HTTP status responses with this code are sent with; 500 for an unknown code.
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is a failed request as the client sees it.
+type Error struct {
+	Code      Code              `json:"code"`
+	Message   string            `json:"message"`
+	Details   validation.Errors `json:"details,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Validation reports every field problem in errs at once.
+func Validation(errs validation.Errors) *Error {
+	return &Error{Code: ValidationFailed, Message: "Validation failed", Details: errs}
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Status is the HTTP status the error is sent with.
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// Write sends a code and message as an error response.
+func Write(w http.ResponseWriter, code Code, message string) {
+	WriteError(w, New(code, message))
+}
+
+// WriteInternal logs err with the request ID and sends a 500 with message, which should say what
+// failed without saying why.
+func WriteInternal(w http.ResponseWriter, err error, message string) {
+	log.Printf("request %s: %s: %v", w.Header().Get(RequestIDHeader), message, err)
+	Write(w, Internal, message)
+}
+
+// WriteError sends err as an error response. An *Error is sent as it is and validation.Errors as
+// validation_failed; anything else is logged with the request ID and answered with a bare 500, so
+// internals never reach the client.
+func WriteError(w http.ResponseWriter, err error) {
+	requestID := w.Header().Get(RequestIDHeader)
+
+	var apiErr *Error
+	var fieldErrs validation.Errors
+	switch {
+	case errors.As(err, &apiErr):
+		copied := *apiErr
+		apiErr = &copied
+	case errors.As(err, &fieldErrs):
+		apiErr = Validation(fieldErrs)
+	default:
+		log.Printf("request %s: %v", requestID, err)
+		apiErr = New(Internal, "Server error")
+	}
+	apiErr.RequestID = requestID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status())
+	json.NewEncoder(w).Encode(map[string]*Error{"error": apiErr})
+}
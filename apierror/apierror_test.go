@@ -0,0 +1,68 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashishsonamm/setu-splitwise/validation"
+)
+
+type envelope struct {
+	Error Error `json:"error"`
+}
+
+func TestWriteError(t *testing.T) {
+	var fieldErrs validation.Errors
+	fieldErrs.Add("amount", "must be greater than zero")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   Code
+		wantMsg    string
+		wantFields int
+	}{
+		{name: "api error", err: New(GroupNotFound, "Group not found"), wantStatus: http.StatusNotFound, wantCode: GroupNotFound, wantMsg: "Group not found"},
+		{name: "wrapped api error", err: fmt.Errorf("loading: %w", New(Forbidden, "No")), wantStatus: http.StatusForbidden, wantCode: Forbidden, wantMsg: "No"},
+		{name: "field errors", err: fieldErrs, wantStatus: http.StatusUnprocessableEntity, wantCode: ValidationFailed, wantMsg: "Validation failed", wantFields: 1},
+		{name: "anything else is hidden", err: errors.New("pq: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: Internal, wantMsg: "Server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Set(RequestIDHeader, "req-1")
+			WriteError(rec, tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body envelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", rec.Body.String(), err)
+			}
+			got := body.Error
+			if got.Code != tt.wantCode || got.Message != tt.wantMsg || got.RequestID != "req-1" || len(got.Details) != tt.wantFields {
+				t.Errorf("got %+v", got)
+			}
+		})
+	}
+}
+
+func TestEveryCodeHasAStatus(t *testing.T) {
+	for code, status := range statuses {
+		if status < 400 || status > 599 {
+			t.Errorf("%s maps to %d", code, status)
+		}
+	}
+	if got := Code("made_up").Status(); got != http.StatusInternalServerError {
+		t.Errorf("unknown code status = %d", got)
+	}
+}
@@ -0,0 +1,112 @@
+// Package attachment checks uploaded receipt files and makes thumbnails of the images among them.
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif" // registered for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+// ThumbnailSize bounds the longer side of a thumbnail, in pixels.
+const ThumbnailSize = 256
+
+// maxPixels refuses to decode images large enough to exhaust memory.
+const maxPixels = 50_000_000
+
+// AllowedTypes are the content types accepted for receipts.
+var AllowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+var ErrUnsupportedType = errors.New("only JPEG, PNG, GIF, WebP and PDF files are accepted")
+
+// DetectType works out the content type from the file's contents, whatever the client claimed.
+func DetectType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !AllowedTypes[contentType] {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Image describes an uploaded image and its thumbnail.
+type Image struct {
+	Width, Height           int
+	Thumbnail               []byte // JPEG
+	ThumbWidth, ThumbHeight int
+}
+
+// Thumbnail decodes an image and scales it down to fit within ThumbnailSize. It returns nil for files
+// it cannot decode, such as PDFs and WebP images; they are stored without a thumbnail.
+func Thumbnail(data []byte) (*Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxPixels {
+		return nil, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil
+	}
+
+	bounds := src.Bounds()
+	img := &Image{Width: bounds.Dx(), Height: bounds.Dy()}
+	img.ThumbWidth, img.ThumbHeight = fit(img.Width, img.Height, ThumbnailSize)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(src, img.ThumbWidth, img.ThumbHeight), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	img.Thumbnail = buf.Bytes()
+	return img, nil
+}
+
+// fit scales width by height down, keeping the aspect ratio, so the longer side is at most max.
+func fit(width, height, max int) (int, int) {
+	if width <= max && height <= max {
+		return width, height
+	}
+	if width >= height {
+		return max, maxInt(1, height*max/width)
+	}
+	return maxInt(1, width*max/height), max
+}
+
+// scale resizes src to width by height, averaging the source pixels under each output pixel.
+func scale(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := maxInt(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := maxInt(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		err  error
+	}{
+		{"pdf", []byte("%PDF-1.7\n%receipt"), "application/pdf", nil},
+		{"png", pngOf(t, 2, 2), "image/png", nil},
+		{"html", []byte("<html><script>alert(1)</script></html>"), "", ErrUnsupportedType},
+		{"plain text", []byte("just some text"), "", ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectType(tt.data)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Fatalf("DetectType = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img, err := Thumbnail(pngOf(t, 1024, 512))
+	if err != nil || img == nil {
+		t.Fatalf("Thumbnail: %v, %v", img, err)
+	}
+	if img.Width != 1024 || img.Height != 512 || img.ThumbWidth != ThumbnailSize || img.ThumbHeight != ThumbnailSize/2 {
+		t.Fatalf("got %dx%d with a %dx%d thumbnail", img.Width, img.Height, img.ThumbWidth, img.ThumbHeight)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(img.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != img.ThumbWidth || b.Dy() != img.ThumbHeight {
+		t.Fatalf("thumbnail is %dx%d", b.Dx(), b.Dy())
+	}
+
+	small, err := Thumbnail(pngOf(t, 40, 100))
+	if err != nil || small.ThumbWidth != 40 || small.ThumbHeight != 100 {
+		t.Fatalf("small images should not be enlarged: %+v, %v", small, err)
+	}
+
+	if pdf, err := Thumbnail([]byte("%PDF-1.7")); pdf != nil || err != nil {
+		t.Fatalf("PDF should have no thumbnail: %v, %v", pdf, err)
+	}
+}
+
+func pngOf(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -1,15 +1,22 @@
 
+-- All money columns hold exact integer minor units (paise/cents).
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm; -- description search in the expense list
+
 CREATE TABLE users (
                        id SERIAL PRIMARY KEY,
                        name VARCHAR(100) NOT NULL,
                        email VARCHAR(100) UNIQUE NOT NULL,
                        password VARCHAR(100),
+                       is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+                       time_zone TEXT NOT NULL DEFAULT 'UTC',  -- IANA name, for date ranges and "today"
                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE groups (
                         id SERIAL PRIMARY KEY,
                         name VARCHAR(100) NOT NULL,
+                        base_currency CHAR(3) NOT NULL DEFAULT 'INR',
                         created_by INT REFERENCES users(id) ON DELETE SET NULL,
                         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -18,46 +25,148 @@ CREATE TABLE group_users (
                              id SERIAL PRIMARY KEY,
                              group_id INT REFERENCES groups(id) ON DELETE CASCADE,
                              user_id INT REFERENCES users(id) ON DELETE CASCADE,
+                             role VARCHAR(10) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
                              joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                              UNIQUE (group_id, user_id)
 );
 
+CREATE UNIQUE INDEX group_users_one_owner ON group_users (group_id) WHERE role = 'owner';
+
+-- Categories without a group are the system defaults; groups can add their own.
+CREATE TABLE categories (
+                            id SERIAL PRIMARY KEY,
+                            group_id INT REFERENCES groups(id) ON DELETE CASCADE,
+                            name VARCHAR(50) NOT NULL,
+                            created_by INT REFERENCES users(id) ON DELETE SET NULL,
+                            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX categories_system_name ON categories (LOWER(name)) WHERE group_id IS NULL;
+CREATE UNIQUE INDEX categories_group_name ON categories (group_id, LOWER(name)) WHERE group_id IS NOT NULL;
+
+INSERT INTO categories (name) VALUES
+    ('Food'), ('Groceries'), ('Travel'), ('Transport'), ('Rent'), ('Utilities'),
+    ('Entertainment'), ('Shopping'), ('Health'), ('Other');
 
 CREATE TABLE expenses (
                           id SERIAL PRIMARY KEY,
                           description TEXT NOT NULL,
-                          amount FLOAT NOT NULL,
+                          amount BIGINT NOT NULL,
+                          currency CHAR(3) NOT NULL DEFAULT 'INR',
+                          exchange_rate NUMERIC(24, 12) CHECK (exchange_rate > 0), -- to rate_currency, taken when recorded
+                          rate_currency CHAR(3),
                           split_type VARCHAR(20) NOT NULL,
                           expense_type VARCHAR(20) NOT NULL,
                           created_by INT NOT NULL,
-                          group_id INT
+                          group_id INT,
+                          category_id INT REFERENCES categories(id) ON DELETE SET NULL,
+                          tax BIGINT NOT NULL DEFAULT 0 CHECK (tax >= 0),           -- itemized split only
+                          tip BIGINT NOT NULL DEFAULT 0 CHECK (tip >= 0),
+                          discount BIGINT NOT NULL DEFAULT 0 CHECK (discount >= 0),
+                          expense_date DATE NOT NULL,               -- the day it happened, in time_zone
+                          time_zone TEXT NOT NULL DEFAULT 'UTC',    -- the payer's, when recorded
+                          created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                          updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                          deleted_at TIMESTAMP,
+                          deleted_by INT REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX expenses_category_idx ON expenses (category_id);
+-- The expense list sorts by date or amount, breaking ties by id; see GetGroupExpenses.
+CREATE INDEX expenses_group_date_idx ON expenses (group_id, expense_date, id) WHERE deleted_at IS NULL;
+CREATE INDEX expenses_group_amount_idx ON expenses (group_id, amount, id) WHERE deleted_at IS NULL;
+CREATE INDEX expenses_description_trgm_idx ON expenses USING GIN (description gin_trgm_ops);
+
+CREATE TABLE expense_tags (
+                              expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+                              tag VARCHAR(50) NOT NULL,
+                              PRIMARY KEY (expense_id, tag)
+);
+
+CREATE INDEX expense_tags_tag_idx ON expense_tags (tag);
+
+-- Line items of an itemized expense; each is shared equally by the users in assigned_to.
+CREATE TABLE expense_items (
+                               id SERIAL PRIMARY KEY,
+                               expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+                               position INT NOT NULL,
+                               description TEXT NOT NULL DEFAULT '',
+                               amount BIGINT NOT NULL CHECK (amount > 0),
+                               assigned_to INT[] NOT NULL,
+                               UNIQUE (expense_id, position)
+);
+
+-- Receipt files attached to an expense; the bytes live in the blob store under storage_key.
+CREATE TABLE expense_attachments (
+                                     id SERIAL PRIMARY KEY,
+                                     expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+                                     storage_key TEXT NOT NULL UNIQUE,
+                                     file_name TEXT NOT NULL,
+                                     content_type TEXT NOT NULL,
+                                     size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+                                     checksum CHAR(64) NOT NULL,               -- SHA-256, hex
+                                     width INT,                                -- images only
+                                     height INT,
+                                     thumbnail_key TEXT,
+                                     thumbnail_width INT,
+                                     thumbnail_height INT,
+                                     uploaded_by INT REFERENCES users(id) ON DELETE SET NULL,
+                                     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX expense_attachments_expense_id_idx ON expense_attachments (expense_id);
+
+-- Snapshot of an expense (with contributors and amounts owed) taken before each change.
+CREATE TABLE expense_revisions (
+                                   id SERIAL PRIMARY KEY,
+                                   expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+                                   revision INT NOT NULL,
+                                   action VARCHAR(20) NOT NULL,
+                                   snapshot JSONB NOT NULL,
+                                   actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                   UNIQUE (expense_id, revision)
 );
 
 CREATE TABLE contributors (
                               id SERIAL PRIMARY KEY,
                               expense_id INT REFERENCES expenses(id) ON DELETE CASCADE,
                               user_id INT NOT NULL,
-                              contribution_amount FLOAT NOT NULL,
-                              paid_amount FLOAT,
-                              percentage FLOAT,
-                              share FLOAT,
-                              amount FLOAT
+                              contribution_amount BIGINT NOT NULL,
+                              paid_amount BIGINT,
+                              percentage BIGINT, -- hundredths of a percent
+                              share BIGINT,      -- hundredths of a share
+                              amount BIGINT
 );
 
+CREATE INDEX contributors_expense_idx ON contributors (expense_id);
+CREATE INDEX contributors_user_expense_idx ON contributors (user_id, expense_id);
+
 CREATE TABLE amounts_owed (
                               id SERIAL PRIMARY KEY,
                               expense_id INT REFERENCES expenses(id) ON DELETE CASCADE,
                               user_id INT NOT NULL,
-                              owed FLOAT DEFAULT 0,
-                              balance FLOAT DEFAULT 0
+                              owed BIGINT DEFAULT 0,
+                              balance BIGINT DEFAULT 0
 );
 
+CREATE INDEX amounts_owed_expense_idx ON amounts_owed (expense_id);
+
 CREATE TABLE group_settlements (
                                    id SERIAL PRIMARY KEY,
                                    group_id INT NOT NULL,
                                    debtor_id INT NOT NULL,
                                    creditor_id INT NOT NULL,
-                                   amount FLOAT NOT NULL,
+                                   amount BIGINT NOT NULL,
+                                   currency CHAR(3) NOT NULL DEFAULT 'INR',
+                                   exchange_rate NUMERIC(24, 12) CHECK (exchange_rate > 0),
+                                   rate_currency CHAR(3),
+                                   status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'rejected', 'expired', 'disputed')),
+                                   status_reason TEXT,
+                                   expires_at TIMESTAMP,
+                                   responded_at TIMESTAMP,
+                                   reversal_of INT UNIQUE REFERENCES group_settlements(id) ON DELETE CASCADE,
+                                   created_by INT REFERENCES users(id) ON DELETE SET NULL,
                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                                    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
                                    FOREIGN KEY (debtor_id) REFERENCES users(id) ON DELETE CASCADE,
@@ -68,8 +177,59 @@ CREATE TABLE personal_settlements (
                                    id SERIAL PRIMARY KEY,
                                    debtor_id INT NOT NULL,
                                    creditor_id INT NOT NULL,
-                                   amount FLOAT NOT NULL,
+                                   amount BIGINT NOT NULL,
+                                   currency CHAR(3) NOT NULL DEFAULT 'INR',
+                                   exchange_rate NUMERIC(24, 12) CHECK (exchange_rate > 0),
+                                   rate_currency CHAR(3),
+                                   status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'rejected', 'expired', 'disputed')),
+                                   status_reason TEXT,
+                                   expires_at TIMESTAMP,
+                                   responded_at TIMESTAMP,
+                                   reversal_of INT UNIQUE REFERENCES personal_settlements(id) ON DELETE CASCADE,
+                                   created_by INT REFERENCES users(id) ON DELETE SET NULL,
                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                                    FOREIGN KEY (debtor_id) REFERENCES users(id) ON DELETE CASCADE,
                                    FOREIGN KEY (creditor_id) REFERENCES users(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+
+CREATE INDEX group_settlements_pending_idx ON group_settlements (creditor_id) WHERE status = 'pending';
+CREATE INDEX personal_settlements_pending_idx ON personal_settlements (creditor_id) WHERE status = 'pending';
+
+-- One unit of base_currency is worth rate units of quote_currency on rate_date.
+CREATE TABLE exchange_rates (
+                                base_currency CHAR(3) NOT NULL,
+                                quote_currency CHAR(3) NOT NULL,
+                                rate_date DATE NOT NULL,
+                                rate NUMERIC(24, 12) NOT NULL CHECK (rate > 0),
+                                PRIMARY KEY (base_currency, quote_currency, rate_date)
+);
+
+-- template is the expense to create, in the shape POST /api/expense accepts.
+CREATE TABLE recurring_expenses (
+                                    id SERIAL PRIMARY KEY,
+                                    template JSONB NOT NULL,
+                                    group_id INT REFERENCES groups(id) ON DELETE CASCADE,
+                                    created_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                    frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly', 'custom')),
+                                    every INT NOT NULL DEFAULT 1 CHECK (every > 0),
+                                    cron VARCHAR(100),
+                                    start_date DATE NOT NULL,
+                                    end_date DATE CHECK (end_date >= start_date),
+                                    next_occurrence DATE,
+                                    paused BOOLEAN NOT NULL DEFAULT FALSE,
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX recurring_expenses_due_idx ON recurring_expenses (next_occurrence) WHERE NOT paused;
+
+CREATE TABLE recurring_occurrences (
+                                       id SERIAL PRIMARY KEY,
+                                       recurring_id INT NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+                                       occurs_on DATE NOT NULL,
+                                       status VARCHAR(10) NOT NULL CHECK (status IN ('created', 'skipped', 'failed')),
+                                       expense_id INT REFERENCES expenses(id) ON DELETE SET NULL,
+                                       error TEXT,
+                                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                       UNIQUE (recurring_id, occurs_on)
+);
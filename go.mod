@@ -9,3 +9,5 @@ require (
 )
 
 require github.com/golang-jwt/jwt/v5 v5.2.1
+
+require golang.org/x/crypto v0.31.0
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/attachment"
+	"github.com/ashishsonamm/setu-splitwise/blobstore"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxAttachmentBytes caps an upload when ATTACHMENT_MAX_BYTES is unset: 10 MB.
+const defaultMaxAttachmentBytes = 10 << 20
+
+// multipartOverhead allows for the multipart boundaries and headers around the file itself.
+const multipartOverhead = 64 << 10
+
+const maxFileNameLength = 255
+
+// The attachment types live in models so the repositories can store them.
+type (
+	Attachment          = models.Attachment
+	AttachmentThumbnail = models.AttachmentThumbnail
+)
+
+// maxAttachmentBytes is the largest file UploadAttachment accepts, from ATTACHMENT_MAX_BYTES.
+func maxAttachmentBytes() int64 {
+	if value := os.Getenv("ATTACHMENT_MAX_BYTES"); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxAttachmentBytes
+}
+
+// AttachmentHandler serves the receipts attached to expenses. The files go to a blob store and their
+// rows to the attachment repository.
+type AttachmentHandler struct {
+	expenseStore
+	attachments repository.AttachmentRepository
+	blobs       blobstore.BlobStore
+}
+
+func NewAttachmentHandler(repos repository.Repositories, blobs blobstore.BlobStore) *AttachmentHandler {
+	return &AttachmentHandler{expenseStore: newExpenseStore(repos), attachments: repos.Attachments, blobs: blobs}
+}
+
+// UploadAttachment attaches a receipt to an expense from the "file" field of a multipart form. Anyone
+// who can see the expense may attach to it. The type is worked out from the file's contents; images
+// get a thumbnail.
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	expenseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID")
+		return
+	}
+
+	expense, err := h.loadExpense(r.Context(), expenseID)
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense")
+		return
+	}
+	if !h.canViewExpense(w, r, expense, callerID) {
+		return
+	}
+
+	limit := maxAttachmentBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, limit+multipartOverhead)
+	fileName, data, err := readUploadedFile(r, limit)
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, errFileTooLarge) || errors.As(err, &tooLarge) {
+		apierror.Write(w, apierror.PayloadTooLarge, fmt.Sprintf("File is larger than the %d byte limit", limit))
+		return
+	} else if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	contentType, err := attachment.DetectType(data)
+	if err != nil {
+		apierror.Write(w, apierror.UnsupportedMediaType, err.Error())
+		return
+	}
+	img, err := attachment.Thumbnail(data)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to make a thumbnail")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	a := Attachment{
+		ExpenseID:   expenseID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Checksum:    hex.EncodeToString(sum[:]),
+		UploadedBy:  &callerID,
+	}
+	if a.StorageKey, err = newStorageKey(expenseID); err != nil {
+		apierror.WriteInternal(w, err, "Failed to store attachment")
+		return
+	}
+
+	// The blobs go in first so a row never points at a missing file; if the row cannot be written
+	// they are removed again.
+	ctx := r.Context()
+	if err := h.blobs.Put(ctx, a.StorageKey, data, contentType); err != nil {
+		log.Printf("Failed to store attachment for expense %d: %v", expenseID, err)
+		apierror.Write(w, apierror.Internal, "Failed to store attachment")
+		return
+	}
+	if img != nil {
+		thumbKey := a.StorageKey + "-thumb.jpg"
+		if err := h.blobs.Put(ctx, thumbKey, img.Thumbnail, "image/jpeg"); err != nil {
+			log.Printf("Failed to store thumbnail for expense %d: %v", expenseID, err)
+			h.deleteBlobs(a.StorageKey)
+			apierror.Write(w, apierror.Internal, "Failed to store attachment")
+			return
+		}
+		a.ThumbnailKey = &thumbKey
+		a.Width, a.Height = &img.Width, &img.Height
+		a.Thumbnail = &AttachmentThumbnail{Width: img.ThumbWidth, Height: img.ThumbHeight}
+	}
+
+	if err := h.attachments.Create(ctx, &a); err != nil {
+		h.deleteBlobs(a.StorageKey, a.ThumbnailKey)
+		apierror.WriteInternal(w, err, "Failed to save attachment")
+		return
+	}
+	setAttachmentURLs(&a)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+var errFileTooLarge = errors.New("file too large")
+
+// readUploadedFile reads the "file" part of a multipart request, refusing files over limit bytes.
+func readUploadedFile(r *http.Request, limit int64) (string, []byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, errors.New("Expected a multipart/form-data body with a file field")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", nil, errors.New("Missing file field")
+		} else if err != nil {
+			return "", nil, err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, limit+1))
+		part.Close()
+		if err != nil {
+			return "", nil, err
+		}
+		if int64(len(data)) > limit {
+			return "", nil, errFileTooLarge
+		}
+		if len(data) == 0 {
+			return "", nil, errors.New("File is empty")
+		}
+		return cleanFileName(part.FileName()), data, nil
+	}
+}
+
+// cleanFileName keeps the base name the client sent, for display only; it is never a storage path.
+func cleanFileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > maxFileNameLength {
+		name = name[:maxFileNameLength]
+	}
+	return name
+}
+
+func newStorageKey(expenseID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("expenses/%d/%s", expenseID, hex.EncodeToString(b)), nil
+}
+
+// deleteBlobs removes an attachment's files, only logging failures: an orphaned blob is harmless.
+func (h *AttachmentHandler) deleteBlobs(key string, thumbnailKey ...*string) {
+	keys := []string{key}
+	for _, k := range thumbnailKey {
+		if k != nil {
+			keys = append(keys, *k)
+		}
+	}
+	for _, k := range keys {
+		if err := h.blobs.Delete(context.Background(), k); err != nil {
+			log.Printf("Failed to delete blob %s: %v", k, err)
+		}
+	}
+}
+
+// ListAttachments lists an expense's attachments, oldest first.
+func (h *AttachmentHandler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	expenseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID")
+		return
+	}
+	if _, ok := h.viewableExpense(w, r, expenseID, callerID); !ok {
+		return
+	}
+
+	attachments, err := h.attachments.List(r.Context(), expenseID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch attachments")
+		return
+	}
+	if attachments == nil {
+		attachments = []Attachment{}
+	}
+	for i := range attachments {
+		setAttachmentURLs(&attachments[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadAttachment streams the attached file. Attachments of deleted expenses stay readable, like
+// the expense's history.
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	h.serveAttachment(w, r, false)
+}
+
+// DownloadAttachmentThumbnail streams an image attachment's JPEG thumbnail.
+func (h *AttachmentHandler) DownloadAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serveAttachment(w, r, true)
+}
+
+func (h *AttachmentHandler) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	a, ok := h.attachmentForRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	key, contentType, fileName := a.StorageKey, a.ContentType, a.FileName
+	if thumbnail {
+		if a.ThumbnailKey == nil {
+			apierror.Write(w, apierror.AttachmentNotFound, "This attachment has no thumbnail")
+			return
+		}
+		key, contentType = *a.ThumbnailKey, "image/jpeg"
+		fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "-thumbnail.jpg"
+	}
+
+	body, err := h.blobs.Get(r.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		apierror.Write(w, apierror.AttachmentNotFound, "Attachment file is missing")
+		return
+	} else if err != nil {
+		log.Printf("Failed to read attachment %d: %v", a.ID, err)
+		apierror.Write(w, apierror.Internal, "Failed to fetch attachment")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if !thumbnail {
+		w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	}
+	io.Copy(w, body)
+}
+
+// DeleteAttachment removes an attachment. The uploader and the expense's creator may, as may group
+// members whose role lets them edit others' expenses.
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	a, ok := h.attachmentForRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	expense, err := h.loadExpense(r.Context(), a.ExpenseID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense")
+		return
+	}
+	uploader := a.UploadedBy != nil && *a.UploadedBy == callerID
+	if !uploader && expense.CreatedBy != callerID {
+		if expense.GroupID == nil {
+			apierror.Write(w, apierror.Forbidden, "Only the uploader or the expense's creator can delete this attachment")
+			return
+		}
+		if _, ok := authorizeGroupAction(w, r, h.groups, *expense.GroupID, callerID, models.ActionEditExpense); !ok {
+			return
+		}
+	}
+
+	if err := h.attachments.Delete(r.Context(), a.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apierror.WriteInternal(w, err, "Failed to delete attachment")
+		return
+	}
+	h.deleteBlobs(a.StorageKey, a.ThumbnailKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Attachment deleted successfully", "attachment_id": a.ID})
+}
+
+// attachmentForRequest loads the attachment named by the URL if the caller can see its expense and,
+// when live is set, the expense is not deleted.
+func (h *AttachmentHandler) attachmentForRequest(w http.ResponseWriter, r *http.Request, live bool) (*Attachment, bool) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	vars := mux.Vars(r)
+	expenseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID")
+		return nil, false
+	}
+	attachmentID, err := strconv.Atoi(vars["attachmentId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid attachment ID")
+		return nil, false
+	}
+
+	deleted, ok := h.viewableExpense(w, r, expenseID, callerID)
+	if !ok {
+		return nil, false
+	}
+	if live && deleted {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return nil, false
+	}
+
+	a, err := h.attachments.Get(r.Context(), expenseID, attachmentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.AttachmentNotFound, "Attachment not found")
+		return nil, false
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch attachment")
+		return nil, false
+	}
+	setAttachmentURLs(a)
+	return a, true
+}
+
+// viewableExpense checks the expense exists, deleted or not, and that the caller can see it.
+func (s expenseStore) viewableExpense(w http.ResponseWriter, r *http.Request, expenseID, callerID int) (deleted bool, ok bool) {
+	expense, deleted, err := s.expenses.Get(r.Context(), expenseID)
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return false, false
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense")
+		return false, false
+	}
+	return deleted, s.canViewExpense(w, r, expense, callerID)
+}
+
+// setAttachmentURLs fills in where the attachment and its thumbnail can be downloaded.
+func setAttachmentURLs(a *Attachment) {
+	a.DownloadURL = fmt.Sprintf("/api/expense/%d/attachments/%d", a.ExpenseID, a.ID)
+	if a.Thumbnail != nil {
+		a.Thumbnail.URL = a.DownloadURL + "/thumbnail"
+	}
+}
@@ -1,37 +1,72 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/middleware"
 	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
 	"github.com/ashishsonamm/setu-splitwise/utils"
+	"log"
 	"net/http"
 )
 
-func Login(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var loginReq models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request")
 		return
 	}
 
-	var user models.User
-	query := `SELECT id, password FROM users WHERE email = $1`
-	err := utils.DB.QueryRow(query, loginReq.Email).Scan(&user.ID, &user.Password)
-	if err == sql.ErrNoRows || user.Password != loginReq.Password {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+	user, err := h.users.GetByEmail(r.Context(), loginReq.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		utils.VerifyPassword(utils.DummyPasswordHash(), loginReq.Password)
+		apierror.Write(w, apierror.InvalidCredentials, "Invalid email or password")
 		return
 	} else if err != nil {
-		http.Error(w, "Server error", http.StatusInternalServerError)
+		apierror.WriteInternal(w, err, "Server error")
 		return
 	}
 
+	ok, needsRehash, err := utils.VerifyPassword(user.Password, loginReq.Password)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return
+	}
+	if !ok {
+		apierror.Write(w, apierror.InvalidCredentials, "Invalid email or password")
+		return
+	}
+
+	// Upgrade legacy plaintext rows (and hashes made with an outdated cost) now that we know the password.
+	// A failure here must not block the login; the row is simply upgraded on a later attempt.
+	if needsRehash {
+		hash, err := utils.HashPassword(loginReq.Password)
+		if err == nil {
+			err = h.users.SetPassword(r.Context(), user.ID, hash)
+		}
+		if err != nil {
+			log.Printf("Failed to re-hash password for user %d: %v", user.ID, err)
+		}
+	}
+
 	token, err := utils.CreateJWT(user.ID)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		apierror.WriteInternal(w, err, "Failed to generate token")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
+
+// currentUserID returns the user the request is authenticated as, writing a 401 if there is none.
+func currentUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, apierror.Unauthenticated, "Missing or invalid token")
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/validation"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxCategoryName = 50
+	maxTags         = 20
+	maxTagLength    = 50
+)
+
+// CategoryHandler serves expense categories.
+type CategoryHandler struct {
+	groups   repository.GroupRepository
+	expenses repository.ExpenseRepository
+}
+
+func NewCategoryHandler(repos repository.Repositories) *CategoryHandler {
+	return &CategoryHandler{groups: repos.Groups, expenses: repos.Expenses}
+}
+
+// GetCategories lists the system categories, the only ones personal expenses can use.
+func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	h.writeCategories(w, r, nil)
+}
+
+// GetGroupCategories lists the categories a group's expenses can use: the system ones, then the
+// group's own.
+func (h *CategoryHandler) GetGroupCategories(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+	h.writeCategories(w, r, &groupID)
+}
+
+func (h *CategoryHandler) writeCategories(w http.ResponseWriter, r *http.Request, groupID *int) {
+	categories, err := h.expenses.Categories(r.Context(), groupID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch categories")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// CreateGroupCategory adds a custom category to the group. Any member may add one; its name must
+// not clash with a system category or another of the group's.
+func (h *CategoryHandler) CreateGroupCategory(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	var req models.CreateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxCategoryName {
+		apierror.Write(w, apierror.InvalidRequest, "Category name must be 1 to 50 characters")
+		return
+	}
+
+	category := models.Category{Name: name, GroupID: &groupID}
+	err = h.expenses.CreateCategory(r.Context(), &category, callerID)
+	if errors.Is(err, repository.ErrDuplicate) {
+		apierror.Write(w, apierror.Conflict, "A category with this name already exists")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to create category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// DeleteGroupCategory removes one of the group's own categories. Its expenses become uncategorized.
+func (h *CategoryHandler) DeleteGroupCategory(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	categoryID, err2 := strconv.Atoi(mux.Vars(r)["categoryId"])
+	if err != nil || err2 != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group or category ID")
+		return
+	}
+
+	if _, ok := authorizeGroupAction(w, r, h.groups, groupID, callerID, models.ActionDeleteCategory); !ok {
+		return
+	}
+
+	err = h.expenses.DeleteCategory(r.Context(), groupID, categoryID)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.CategoryNotFound, "Category not found in this group")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to delete category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Category deleted successfully", "category_id": categoryID})
+}
+
+// resolveCategory fills in the expense's category ID and name from either one, returning validation
+// errors for a category the expense cannot use.
+func (s expenseStore) resolveCategory(ctx context.Context, expense *Expense) (validation.Errors, error) {
+	name := strings.TrimSpace(expense.Category)
+	if expense.CategoryID == nil && name == "" {
+		expense.Category = ""
+		return nil, nil
+	}
+
+	var category *models.Category
+	var err error
+	field := "category_id"
+	if expense.CategoryID != nil {
+		category, err = s.expenses.Category(ctx, *expense.CategoryID)
+	} else {
+		field = "category"
+		category, err = s.expenses.CategoryByName(ctx, name, expense.GroupID)
+	}
+
+	var errs validation.Errors
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		errs.Add(field, "unknown category")
+		return errs, nil
+	case err != nil:
+		return nil, err
+	case category.GroupID != nil && (expense.GroupID == nil || *category.GroupID != *expense.GroupID):
+		errs.Add(field, "category %d belongs to another group", category.ID)
+		return errs, nil
+	}
+
+	expense.CategoryID = &category.ID
+	expense.Category = category.Name
+	return nil, nil
+}
+
+func validateTags(tags []string, errs *validation.Errors) {
+	if len(tags) > maxTags {
+		errs.Add("tags", "at most %d tags are allowed", maxTags)
+	}
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		field := "tags[" + strconv.Itoa(i) + "]"
+		if tag == "" {
+			errs.Add(field, "must not be empty")
+		} else if len(tag) > maxTagLength {
+			errs.Add(field, "must be at most %d characters", maxTagLength)
+		}
+	}
+}
+
+// normalizeTags trims, lower-cases, de-duplicates and sorts tags, so "Goa" and "goa " are one tag.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+func sameCategory(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
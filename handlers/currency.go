@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// balanceEntry is an expense's or settlement's effect on balances, in the currency it was recorded in.
+type balanceEntry struct {
+	currency string
+	date     time.Time
+	snapshot *rates.Snapshot // rate taken when the entry was recorded, if any
+	balances []userBalance
+}
+
+// convertBalances expresses an entry's balances in currency to, at its snapshotted rate or else p's
+// rate for its date, allocating credits and debits separately so they still cancel exactly.
+func convertBalances(p rates.ExchangeRateProvider, entry balanceEntry, to string) ([]userBalance, error) {
+	if entry.currency == to {
+		return entry.balances, nil
+	}
+	rate, err := entryRate(p, entry.currency, to, entry.date, entry.snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	credits := make([]int64, len(entry.balances))
+	debits := make([]int64, len(entry.balances))
+	var creditTotal, debitTotal money.Amount
+	for i, b := range entry.balances {
+		if b.balance > 0 {
+			credits[i] = int64(b.balance)
+			creditTotal += b.balance
+		} else {
+			debits[i] = int64(-b.balance)
+			debitTotal -= b.balance
+		}
+	}
+
+	converted := make([]userBalance, len(entry.balances))
+	for i, b := range entry.balances {
+		converted[i].userID = b.userID
+	}
+	for _, side := range []struct {
+		total   money.Amount
+		weights []int64
+		sign    money.Amount
+	}{{creditTotal, credits, 1}, {debitTotal, debits, -1}} {
+		if side.total == 0 {
+			continue
+		}
+		total, err := money.Convert(side.total, rate)
+		if err != nil {
+			return nil, err
+		}
+		parts, err := money.Allocate(total, side.weights)
+		if err != nil {
+			return nil, err
+		}
+		for i, part := range parts {
+			converted[i].balance += side.sign * part
+		}
+	}
+	return converted, nil
+}
+
+// entryRate is the snapshotted rate when it converts to the wanted currency, else p's rate for date.
+func entryRate(p rates.ExchangeRateProvider, from, to string, date time.Time, snapshot *rates.Snapshot) (*big.Rat, error) {
+	if snapshot != nil && snapshot.Currency == to {
+		return snapshot.Rate, nil
+	}
+	return p.Rate(from, to, date)
+}
+
+// writeConversionError writes the response for err, returning false when it is nil.
+func writeConversionError(w http.ResponseWriter, err error, fallback string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, rates.ErrNoRate):
+		apierror.Write(w, apierror.ExchangeRateUnavailable, err.Error())
+	default:
+		apierror.WriteInternal(w, err, fallback)
+	}
+	return true
+}
+
+// parseConvert reads ?convert=; balances are converted to the base currency unless it is "false".
+func parseConvert(r *http.Request) (bool, bool) {
+	switch r.URL.Query().Get("convert") {
+	case "", "true":
+		return true, true
+	case "false":
+		return false, true
+	default:
+		return false, false
+	}
+}
@@ -1,353 +1,322 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/settlement"
 	"github.com/gorilla/mux"
 	"net/http"
+	"sort"
 	"strconv"
 )
 
-func GetPersonalBalance(w http.ResponseWriter, r *http.Request) {
+// ledger reads the expenses and confirmed settlements that balances are worked out from.
+type ledger struct {
+	groups      repository.GroupRepository
+	expenses    repository.ExpenseRepository
+	settlements repository.SettlementRepository
+	rates       rates.ExchangeRateProvider
+}
+
+func newLedger(repos repository.Repositories) ledger {
+	return ledger{groups: repos.Groups, expenses: repos.Expenses, settlements: repos.Settlements, rates: repos.ExchangeRates}
+}
+
+// BalanceHandler serves group and personal balances.
+type BalanceHandler struct {
+	ledger
+}
+
+func NewBalanceHandler(repos repository.Repositories) *BalanceHandler {
+	return &BalanceHandler{newLedger(repos)}
+}
+
+// GetPersonalBalance summarizes the caller's personal (non-group) balance with every user they share
+// personal expenses or settlements with.
+func (h *BalanceHandler) GetPersonalBalance(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	userIDStr := mux.Vars(r)["userId"]
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid user ID")
 		return
 	}
 
-	query := `
-		WITH personal_expenses AS (
-    SELECT e.id AS expense_id
-    FROM expenses e
-    JOIN contributors c ON e.id = c.expense_id
-    WHERE e.expense_type = 'personal' AND c.user_id = $1
-)
-
-SELECT 
-    c.user_id,
-    c.expense_id,
-    SUM(c.paid_amount - c.contribution_amount) AS balance
-FROM 
-    contributors c
-JOIN 
-    personal_expenses pe ON c.expense_id = pe.expense_id
-WHERE c.user_id != $1
-GROUP BY 
-    c.user_id, c.expense_id;
-	`
-
-	rows, err := utils.DB.Query(query, userID)
-	if err != nil {
-		http.Error(w, "Failed to fetch personal balance details", http.StatusInternalServerError)
+	if userID != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot view another user's personal balance")
 		return
 	}
-	defer rows.Close()
-
-	var balances []map[string]interface{}
-	for rows.Next() {
-		var amount float64
-		var fromUser, expenseId int
-
-		err := rows.Scan(&fromUser, &expenseId, &amount)
-		if err != nil {
-			http.Error(w, "Error scanning balance details", http.StatusInternalServerError)
-			return
-		}
 
-		balances = append(balances, map[string]interface{}{
-			"amount": amount,
-			"from":   fromUser,
-			"to":     userID,
-		})
+	balances, _, err := h.personalLedger(r.Context(), userID)
+	if writeConversionError(w, err, "Failed to fetch personal balance details") {
+		return
 	}
 
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Error iterating over balance details", http.StatusInternalServerError)
-		return
+	friendIDs := make([]int, 0, len(balances))
+	for friendID := range balances {
+		friendIDs = append(friendIDs, friendID)
+	}
+	sort.Ints(friendIDs)
+
+	summary := []map[string]interface{}{}
+	for _, friendID := range friendIDs {
+		details := getUserBalanceDetails(balances[friendID])
+		details["user_id"] = friendID
+		details["currency"] = personalCurrency
+		summary = append(summary, details)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(balances)
+	json.NewEncoder(w).Encode(summary)
 }
 
-func GetGroupBalances(w http.ResponseWriter, r *http.Request) {
-	groupIDStr := mux.Vars(r)["groupId"]
-	groupID, err := strconv.Atoi(groupIDStr)
-	if err != nil {
-		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+// GetPersonalPairBalance returns the personal (non-group) balance between the caller and one other
+// user, with the expenses and settlements it is made of.
+func (h *BalanceHandler) GetPersonalPairBalance(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	query := `
-		SELECT 
-			c.user_id,
-			SUM(c.paid_amount - c.contribution_amount) AS balance
-		FROM 
-			contributors c
-		JOIN 
-			expenses e ON c.expense_id = e.id
-		WHERE 
-			e.group_id = $1
-		GROUP BY 
-			c.user_id;
-	`
-
-	rows, err := utils.DB.Query(query, groupID)
-	if err != nil {
-		http.Error(w, "Failed to fetch group balances", http.StatusInternalServerError)
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	otherUserID, err2 := strconv.Atoi(mux.Vars(r)["otherUserId"])
+	if err != nil || err2 != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid user ID")
 		return
 	}
-	defer rows.Close()
 
-	userBalances := make(map[int]float64)
-	for rows.Next() {
-		var userID int
-		var netBalance float64
-		if err := rows.Scan(&userID, &netBalance); err != nil {
-			http.Error(w, "Failed to parse group balances", http.StatusInternalServerError)
-			return
-		}
-		userBalances[userID] = netBalance
+	if userID != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot view another user's personal balance")
+		return
 	}
 
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Failed to fetch group balances", http.StatusInternalServerError)
+	balances, entries, err := h.personalLedger(r.Context(), userID)
+	if writeConversionError(w, err, "Failed to fetch personal balance details") {
 		return
 	}
 
-	query = `
-		SELECT 
-			debtor_id, 
-			creditor_id, 
-			amount
-		FROM 
-			group_settlements
-		WHERE 
-			group_id = $1;
-	`
+	details := getUserBalanceDetails(balances[otherUserID])
+	details["user_id"] = userID
+	details["other_user_id"] = otherUserID
+	details["currency"] = personalCurrency
+	details["entries"] = entries[otherUserID]
+	if entries[otherUserID] == nil {
+		details["entries"] = []LedgerEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
+
+// currencyTransfer is a planned transfer together with the currency it is to be paid in.
+type currencyTransfer struct {
+	settlement.Transfer
+	Currency string `json:"currency"`
+}
 
-	rows, err = utils.DB.Query(query, groupID)
+// GetGroupBalances plans the transfers that settle a group, in its base currency. With ?convert=false
+// each currency is planned separately instead, without any exchange rates.
+func (h *BalanceHandler) GetGroupBalances(w http.ResponseWriter, r *http.Request) {
+	groupIDStr := mux.Vars(r)["groupId"]
+	groupID, err := strconv.Atoi(groupIDStr)
 	if err != nil {
-		http.Error(w, "Failed to fetch group settlements", http.StatusInternalServerError)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
 		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var debtorID, creditorID int
-		var amount float64
-		if err := rows.Scan(&debtorID, &creditorID, &amount); err != nil {
-			http.Error(w, "Failed to parse group settlements", http.StatusInternalServerError)
-			return
-		}
 
-		userBalances[debtorID] += amount
-		userBalances[creditorID] -= amount
+	strategy, err := settlement.ParseStrategy(r.URL.Query().Get("strategy"))
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+	convert, ok := parseConvert(r)
+	if !ok {
+		apierror.Write(w, apierror.InvalidRequest, "convert must be true or false")
+		return
 	}
 
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Failed to fetch group settlements", http.StatusInternalServerError)
+	byCurrency, err := h.groupBalancesIn(r.Context(), groupID, convert)
+	if writeConversionError(w, err, "Failed to fetch group balances") {
 		return
 	}
 
-	settlements := calculateSettlements(userBalances)
+	settlements := []currencyTransfer{}
+	for _, currency := range sortedCurrencies(byCurrency) {
+		for _, transfer := range settlement.Plan(byCurrency[currency], strategy, settlement.DefaultDust) {
+			settlements = append(settlements, currencyTransfer{Transfer: transfer, Currency: currency})
+		}
+	}
 
 	json.NewEncoder(w).Encode(settlements)
 }
 
-func calculateSettlements(balances map[int]float64) []map[string]interface{} {
-	var debtors []int
-	var creditors []int
-
-	for userID, balance := range balances {
-		if balance < 0 {
-			debtors = append(debtors, userID)
-		} else if balance > 0 {
-			creditors = append(creditors, userID)
-		}
+// groupBalances returns every member's net balance in a group, positive when owed, in the group's base
+// currency, which is returned too.
+func (l ledger) groupBalances(ctx context.Context, groupID int) (map[int]money.Amount, string, error) {
+	group, err := l.groups.Get(ctx, groupID)
+	if err != nil {
+		return nil, "", err
 	}
+	base := group.BaseCurrency
 
-	var settlements []map[string]interface{}
-
-	for len(debtors) > 0 && len(creditors) > 0 {
-		debtorID := debtors[0]
-		creditorID := creditors[0]
+	entries, err := l.groupEntries(ctx, groupID)
+	if err != nil {
+		return nil, "", err
+	}
 
-		amountOwed := min(-balances[debtorID], balances[creditorID])
+	userBalances := make(map[int]money.Amount)
+	for _, entry := range entries {
+		converted, err := convertBalances(l.rates, entry, base)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, b := range converted {
+			userBalances[b.userID] += b.balance
+		}
+	}
+	return userBalances, base, nil
+}
 
-		settlements = append(settlements, map[string]interface{}{
-			"from":   debtorID,
-			"to":     creditorID,
-			"amount": amountOwed,
-		})
+// groupBalancesIn returns the group's balances keyed by currency: a single entry for the base currency
+// when convert is set, otherwise one per currency the group has used.
+func (l ledger) groupBalancesIn(ctx context.Context, groupID int, convert bool) (map[string]map[int]money.Amount, error) {
+	if convert {
+		balances, base, err := l.groupBalances(ctx, groupID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]map[int]money.Amount{base: balances}, nil
+	}
 
-		balances[debtorID] += amountOwed
-		balances[creditorID] -= amountOwed
+	entries, err := l.groupEntries(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
 
-		if balances[debtorID] == 0 {
-			debtors = debtors[1:]
+	byCurrency := make(map[string]map[int]money.Amount)
+	for _, entry := range entries {
+		if byCurrency[entry.currency] == nil {
+			byCurrency[entry.currency] = make(map[int]money.Amount)
 		}
-		if balances[creditorID] == 0 {
-			creditors = creditors[1:]
+		for _, b := range entry.balances {
+			byCurrency[entry.currency][b.userID] += b.balance
 		}
 	}
+	return byCurrency, nil
+}
+
+// groupEntries lists the live expenses and counted settlements of a group as balance entries, in the
+// currencies they were recorded in.
+func (l ledger) groupEntries(ctx context.Context, groupID int) ([]balanceEntry, error) {
+	expenses, err := l.expenses.GroupShares(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	settlements, err := l.settlements.List(ctx, repository.SettlementFilter{Type: "group", GroupID: &groupID, Status: models.SettlementConfirmed})
+	if err != nil {
+		return nil, err
+	}
 
-	return settlements
+	entries := make([]balanceEntry, 0, len(expenses)+len(settlements))
+	for _, e := range expenses {
+		entry := balanceEntry{currency: e.Currency, date: e.Date.Time, snapshot: e.ExchangeRate}
+		for _, share := range e.Shares {
+			entry.balances = append(entry.balances, userBalance{userID: share.UserID, balance: share.Paid - share.Owed})
+		}
+		entries = append(entries, entry)
+	}
+	for _, s := range settlements {
+		entries = append(entries, balanceEntry{
+			currency: s.Currency,
+			date:     s.CreatedAt,
+			snapshot: s.ExchangeRate,
+			balances: []userBalance{{userID: s.DebtorID, balance: s.Amount}, {userID: s.CreditorID, balance: -s.Amount}},
+		})
+	}
+	return entries, nil
 }
 
-func min(a, b float64) float64 {
-	if a < b {
-		return a
+func sortedCurrencies(byCurrency map[string]map[int]money.Amount) []string {
+	currencies := make([]string, 0, len(byCurrency))
+	for currency := range byCurrency {
+		currencies = append(currencies, currency)
 	}
-	return b
+	sort.Strings(currencies)
+	return currencies
 }
 
-func GetUserBalanceInAGroup(w http.ResponseWriter, r *http.Request) {
+// GetUserBalanceInAGroup reports one member's balance in a group and the planned transfers they are
+// part of, in the group's base currency or, with ?convert=false, per currency.
+func (h *BalanceHandler) GetUserBalanceInAGroup(w http.ResponseWriter, r *http.Request) {
 	groupIDStr := mux.Vars(r)["groupId"]
 	userIDStr := mux.Vars(r)["userId"]
 	groupID, err := strconv.Atoi(groupIDStr)
 	userID, err2 := strconv.Atoi(userIDStr)
 	if err != nil || err2 != nil {
-		http.Error(w, "Invalid group or user ID", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group or user ID")
 		return
 	}
 
-	query := `
-        SELECT 
-            c.user_id,
-            SUM(c.paid_amount - c.contribution_amount) AS balance
-        FROM 
-            contributors c
-        JOIN 
-            expenses e ON c.expense_id = e.id
-        WHERE 
-            e.group_id = $1 AND c.user_id = $2
-        GROUP BY 
-            c.user_id;
-    `
-
-	rows, err := utils.DB.Query(query, groupID, userID)
+	strategy, err := settlement.ParseStrategy(r.URL.Query().Get("strategy"))
 	if err != nil {
-		http.Error(w, "Failed to fetch user balance", http.StatusInternalServerError)
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
 		return
 	}
-	defer rows.Close()
-
-	var userBalance float64
-	if rows.Next() {
-		if err := rows.Scan(&userID, &userBalance); err != nil {
-			http.Error(w, "Failed to parse user balance", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Failed to fetch user balance", http.StatusInternalServerError)
+	convert, ok := parseConvert(r)
+	if !ok {
+		apierror.Write(w, apierror.InvalidRequest, "convert must be true or false")
 		return
 	}
 
-	query = `
-        SELECT 
-            debtor_id, 
-            creditor_id, 
-            amount
-        FROM 
-            group_settlements
-        WHERE 
-            group_id = $1 AND (debtor_id = $2 OR creditor_id = $2);
-    `
-
-	rows, err = utils.DB.Query(query, groupID, userID)
+	_, member, err := h.groups.Role(r.Context(), groupID, userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch group settlements", http.StatusInternalServerError)
+		apierror.WriteInternal(w, err, "Server error")
 		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var debtorID, creditorID int
-		var amount float64
-		if err := rows.Scan(&debtorID, &creditorID, &amount); err != nil {
-			http.Error(w, "Failed to parse group settlements", http.StatusInternalServerError)
-			return
-		}
-
-		if debtorID == userID {
-			userBalance += amount
-		} else {
-			userBalance -= amount
-		}
-	}
-
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Failed to fetch group settlements", http.StatusInternalServerError)
+	if !member {
+		apierror.Write(w, apierror.MemberNotFound, "User not found in group")
 		return
 	}
 
-	balanceDetails := getUserBalanceDetails(userBalance)
-
-	query = `
-        SELECT 
-            c.user_id,
-            SUM(c.paid_amount - c.contribution_amount) AS balance
-        FROM 
-            contributors c
-        JOIN 
-            expenses e ON c.expense_id = e.id
-        WHERE 
-            e.group_id = $1
-        GROUP BY 
-            c.user_id;
-    `
-
-	rows, err = utils.DB.Query(query, groupID)
-	if err != nil {
-		http.Error(w, "Failed to fetch group balances", http.StatusInternalServerError)
+	byCurrency, err := h.groupBalancesIn(r.Context(), groupID, convert)
+	if writeConversionError(w, err, "Failed to fetch group balances") {
 		return
 	}
-	defer rows.Close()
 
-	userBalances := make(map[int]float64)
-	for rows.Next() {
-		var userID int
-		var netBalance float64
-		if err := rows.Scan(&userID, &netBalance); err != nil {
-			http.Error(w, "Failed to parse group balances", http.StatusInternalServerError)
-			return
+	balances := []map[string]interface{}{}
+	filteredSettlements := []currencyTransfer{}
+	for _, currency := range sortedCurrencies(byCurrency) {
+		balanceDetails := getUserBalanceDetails(byCurrency[currency][userID])
+		balanceDetails["currency"] = currency
+		balances = append(balances, balanceDetails)
+
+		for _, transfer := range settlement.Plan(byCurrency[currency], strategy, settlement.DefaultDust) {
+			if transfer.From == userID || transfer.To == userID {
+				filteredSettlements = append(filteredSettlements, currencyTransfer{Transfer: transfer, Currency: currency})
+			}
 		}
-		userBalances[userID] = netBalance
-	}
-
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Failed to fetch group balances", http.StatusInternalServerError)
-		return
 	}
 
-	settlements := calculateSettlements(userBalances)
-
-	filteredSettlements := []map[string]interface{}{}
-	for _, settlement := range settlements {
-		from := settlement["from"].(int)
-		to := settlement["to"].(int)
-
-		if from == userID || to == userID {
-			filteredSettlements = append(filteredSettlements, settlement)
-		}
-	}
-
-	response := struct {
-		UserBalance     map[string]interface{}   `json:"user_balance"`
-		UserSettlements []map[string]interface{} `json:"user_settlements"`
-	}{
-		UserBalance:     balanceDetails,
-		UserSettlements: filteredSettlements,
+	response := map[string]interface{}{"user_settlements": filteredSettlements}
+	if convert {
+		response["user_balance"] = balances[0]
+	} else {
+		response["user_balances"] = balances
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-func getUserBalanceDetails(balance float64) map[string]interface{} {
+func getUserBalanceDetails(balance money.Amount) map[string]interface{} {
 	var balanceDetails = map[string]interface{}{
 		"user_balance": balance,
 	}
@@ -360,7 +329,7 @@ func getUserBalanceDetails(balance float64) map[string]interface{} {
 		balanceDetails["amount"] = -balance
 	} else {
 		balanceDetails["status"] = "settled"
-		balanceDetails["amount"] = 0
+		balanceDetails["amount"] = money.Amount(0)
 	}
 
 	return balanceDetails
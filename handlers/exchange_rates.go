@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxRatesUpload caps the size of an exchange-rate import.
+const maxRatesUpload = 10 << 20
+
+// ExchangeRateHandler serves exchange rates.
+type ExchangeRateHandler struct {
+	rates repository.ExchangeRateRepository
+}
+
+func NewExchangeRateHandler(repos repository.Repositories) *ExchangeRateHandler {
+	return &ExchangeRateHandler{rates: repos.ExchangeRates}
+}
+
+// ImportExchangeRates stores dated exchange rates sent by an administrator, as CSV when the
+// Content-Type is text/csv and JSON otherwise, in any layout rates.Parse accepts (including ECB
+// dumps). Rates already stored for the same pair and date are replaced.
+func (h *ExchangeRateHandler) ImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxRatesUpload)
+
+	format := rates.FormatJSON
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		format = rates.FormatCSV
+	}
+	imported, err := rates.Parse(body, format)
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid exchange rates: "+err.Error())
+		return
+	}
+	if len(imported) == 0 {
+		apierror.Write(w, apierror.InvalidRequest, "No exchange rates given")
+		return
+	}
+
+	if err := h.rates.Save(r.Context(), imported); err != nil {
+		apierror.WriteInternal(w, err, "Failed to save exchange rates")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Exchange rates imported", "imported": len(imported)})
+}
+
+// GetExchangeRate returns the rate used to convert ?from= to ?to= on ?date= (default today): the
+// latest one stored on or before that date.
+func (h *ExchangeRateHandler) GetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := money.NormalizeCurrency(query.Get("from"))
+	to, err2 := money.NormalizeCurrency(query.Get("to"))
+	if err != nil || err2 != nil || query.Get("from") == "" || query.Get("to") == "" {
+		apierror.Write(w, apierror.InvalidRequest, "from and to must be three-letter currency codes")
+		return
+	}
+
+	date := time.Now()
+	if value := query.Get("date"); value != "" {
+		if date, err = time.Parse(rates.DateLayout, value); err != nil {
+			apierror.Write(w, apierror.InvalidRequest, "date must be YYYY-MM-DD")
+			return
+		}
+	}
+
+	rate, err := h.rates.Rate(from, to, date)
+	if errors.Is(err, rates.ErrNoRate) {
+		apierror.Write(w, apierror.ExchangeRateNotFound, err.Error())
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch exchange rate")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates.Rate{Base: from, Quote: to, Date: date, Value: rate})
+}
@@ -1,190 +1,407 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"github.com/ashishsonamm/setu-splitwise/utils"
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
-type Expense struct {
-	ID           int           `json:"id"`
-	Description  string        `json:"description"`
-	Amount       float64       `json:"amount"`
-	SplitType    string        `json:"split_type"`   // Types like "equally", "percentage", "share-wise", "absolute"
-	ExpenseType  string        `json:"expense_type"` // "group" or "personal"
-	CreatedBy    int           `json:"created_by"`   // User ID of the person who created the expense
-	GroupID      *int          `json:"group_id"`     // Group ID, if applicable
-	Contributors []Contributor `json:"contributors"` // List of users who contributed to this expense
-	AmountsOwed  []AmountOwed  `json:"amounts_owed"` // List of users and the amount they owe or are owed
+const (
+	SplitEqual      = "equal"
+	SplitPercentage = "percentage"
+	SplitAbsolute   = "absolute"
+	SplitShareWise  = "share-wise"
+	SplitItemized   = "itemized" // line items with assignees, see LineItem
+)
+
+// The expense types live in models so the repositories can store them.
+type (
+	Expense     = models.Expense
+	Contributor = models.Contributor
+	AmountOwed  = models.AmountOwed
+)
+
+// expenseStore holds what every handler that writes expenses needs.
+type expenseStore struct {
+	users    repository.UserRepository
+	groups   repository.GroupRepository
+	expenses repository.ExpenseRepository
+	rates    rates.ExchangeRateProvider
+	tx       repository.Transactor
 }
 
-type Contributor struct {
-	UserID     int     `json:"user_id"`
-	PaidAmount float64 `json:"paid_amount"`          // Amount paid by the user for this expense
-	Percentage float64 `json:"percentage,omitempty"` // Percentage for percentage-based split
-	Share      float64 `json:"share,omitempty"`      // Share for share-wise split
-	Amount     float64 `json:"amount,omitempty"`     // Absolute amount for absolute-based split
+func newExpenseStore(repos repository.Repositories) expenseStore {
+	return expenseStore{users: repos.Users, groups: repos.Groups, expenses: repos.Expenses, rates: repos.ExchangeRates, tx: repos.Tx}
 }
 
-type AmountOwed struct {
-	UserID  int     `json:"user_id"`
-	Owed    float64 `json:"owed"`
-	Balance float64 `json:"balance"`
+// ExpenseHandler serves expenses, their listings and their history.
+type ExpenseHandler struct {
+	expenseStore
 }
 
-func AddExpense(w http.ResponseWriter, r *http.Request) {
+func NewExpenseHandler(repos repository.Repositories) *ExpenseHandler {
+	return &ExpenseHandler{newExpenseStore(repos)}
+}
+
+func (h *ExpenseHandler) AddExpense(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var expense Expense
 	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request payload")
+		return
+	}
+
+	if expense.CreatedBy != 0 && expense.CreatedBy != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot create an expense on behalf of another user")
+		return
+	}
+	expense.CreatedBy = callerID
+	expense.CreatedAt, expense.UpdatedAt = nil, nil
+
+	if !h.prepareExpense(w, r, &expense, nil, callerID) {
 		return
 	}
 
-	expenseType := "personal"
+	expense.ExpenseType = "personal"
 	if expense.GroupID != nil {
-		expenseType = "group"
+		expense.ExpenseType = "group"
 	}
 
-	query := `INSERT INTO expenses (group_id, description, amount, created_by, split_type, expense_type) 
-			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	err := utils.DB.QueryRow(query, expense.GroupID, expense.Description, expense.Amount, expense.CreatedBy, expense.SplitType, expenseType).Scan(&expense.ID)
+	err := h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		if err := h.snapshotRate(ctx, &expense, expense.ExpenseDate.Time); err != nil {
+			return err
+		}
+		return h.expenses.Create(ctx, &expense)
+	})
 	if err != nil {
-		http.Error(w, "Failed to add expense", http.StatusInternalServerError)
+		apierror.WriteInternal(w, err, "Failed to add expense")
 		return
 	}
 
-	totalAmount := expense.Amount
-	totalShares := totalShares(expense.Contributors)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Expense added successfully", "expense_id": expense.ID})
+}
 
-	for _, contributor := range expense.Contributors {
-		var contributionAmount float64
-		switch expense.SplitType {
-		case "equal":
-			contributionAmount = totalAmount / float64(len(expense.Contributors))
-		case "percentage":
-			contributionAmount = totalAmount * (contributor.Percentage / 100)
-		case "absolute":
-			contributionAmount = contributor.Amount
-		case "share-wise":
-			contributionAmount = totalAmount * (contributor.Share / totalShares)
-		default:
-			http.Error(w, "Invalid split type", http.StatusBadRequest)
-			return
-		}
+func (h *ExpenseHandler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
 
-		_, err := utils.DB.Exec(`INSERT INTO contributors (expense_id, user_id, paid_amount, contribution_amount) VALUES ($1, $2, $3, $4)`, expense.ID, contributor.UserID, contributor.PaidAmount, contributionAmount)
-		if err != nil {
-			http.Error(w, "Failed to add contributor", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	for _, contributor := range expense.Contributors {
-		var owedAmount float64
-		switch expense.SplitType {
-		case "equal":
-			owedAmount = totalAmount / float64(len(expense.Contributors))
-		case "percentage":
-			owedAmount = totalAmount * (contributor.Percentage / 100)
-		case "absolute":
-			owedAmount = contributor.Amount
-		case "share-wise":
-			owedAmount = totalAmount * (contributor.Share / totalShares)
-		default:
-			http.Error(w, "Invalid split type", http.StatusBadRequest)
-			return
-		}
-		balance := contributor.PaidAmount - owedAmount
-
-		_, err := utils.DB.Exec(
-			`INSERT INTO amounts_owed (expense_id, user_id, owed, balance) VALUES ($1, $2, $3, $4)`,
-			expense.ID, contributor.UserID, owedAmount, balance,
-		)
+	expenseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID")
+		return
+	}
+
+	var update Expense
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request payload")
+		return
+	}
+
+	existing, ok := h.loadExpenseForChange(w, r, expenseID, callerID, models.ActionEditExpense)
+	if !ok {
+		return
+	}
+
+	// Ownership and placement are fixed at creation; only the bill itself can be edited.
+	update.ID = existing.ID
+	update.CreatedBy = existing.CreatedBy
+	update.GroupID = existing.GroupID
+	update.ExpenseType = existing.ExpenseType
+
+	if !h.prepareExpense(w, r, &update, existing, callerID) {
+		return
+	}
+
+	err = h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		current, err := h.lockExpense(ctx, expenseID)
 		if err != nil {
-			http.Error(w, "Failed to store amount owed", http.StatusInternalServerError)
-			return
+			return err
+		}
+		if err := h.expenses.SaveRevision(ctx, current, "update", callerID); err != nil {
+			return err
 		}
+		return h.replaceExpense(ctx, current, &update)
+	})
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to update expense")
+		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Expense added successfully", "expense_id": expense.ID})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Expense updated successfully", "expense_id": expenseID})
 }
 
-func totalShares(contributors []Contributor) float64 {
-	total := 0.0
-	for _, c := range contributors {
-		total += c.Share
+// DeleteExpense soft-deletes an expense: it stays in the database for history but stops counting
+// towards any balance.
+func (h *ExpenseHandler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
 	}
-	return total
-}
 
-func GetGroupExpenses(w http.ResponseWriter, r *http.Request) {
-	groupIDStr := mux.Vars(r)["groupId"]
-	groupID, err := strconv.Atoi(groupIDStr)
+	expenseID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID")
 		return
 	}
 
-	query := `
-		SELECT e.id, e.description, e.amount, e.split_type, e.expense_type, e.created_by,
-		       ao.user_id, ao.owed, c.contribution_amount, c.paid_amount, ao.balance
-		FROM expenses e
-		JOIN amounts_owed ao ON e.id = ao.expense_id
-		JOIN contributors c ON ao.expense_id = c.expense_id and ao.user_id = c.user_id
-		WHERE e.group_id = $1
-	`
+	if _, ok := h.loadExpenseForChange(w, r, expenseID, callerID, models.ActionDeleteExpense); !ok {
+		return
+	}
 
-	rows, err := utils.DB.Query(query, groupID)
-	if err != nil {
-		http.Error(w, "Failed to fetch group expenses", http.StatusInternalServerError)
+	err = h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		current, err := h.lockExpense(ctx, expenseID)
+		if err != nil {
+			return err
+		}
+		if err := h.expenses.SaveRevision(ctx, current, "delete", callerID); err != nil {
+			return err
+		}
+		return h.expenses.Delete(ctx, expenseID, callerID)
+	})
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to delete expense")
 		return
 	}
-	defer rows.Close()
 
-	expenses := make(map[int]map[string]interface{})
-	for rows.Next() {
-		var expenseID, createdBy, userID int
-		var description, splitType, expenseType string
-		var amount, owed, contributionAmount, paidAmount, balance float64
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Expense deleted successfully", "expense_id": expenseID})
+}
+
+// prepareExpense runs every check an expense must pass before it is written and fills in its split,
+// writing the error response and returning false on failure. previous is as for resolveExpenseDate.
+func (s expenseStore) prepareExpense(w http.ResponseWriter, r *http.Request, expense, previous *Expense, callerID int) bool {
+	if errs := validateExpense(*expense); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+
+	if expense.GroupID == nil && !hasContributor(expense.Contributors, callerID) {
+		apierror.Write(w, apierror.Forbidden, "You must be a contributor to a personal expense")
+		return false
+	}
+
+	if expense.GroupID != nil {
+		if _, ok := requireGroupMember(w, r, s.groups, *expense.GroupID, callerID); !ok {
+			return false
+		}
+
+		userIDs := make([]int, len(expense.Contributors))
+		for i, c := range expense.Contributors {
+			userIDs[i] = c.UserID
+		}
+		if !requireMembers(w, r, s.groups, *expense.GroupID, userIDs) {
+			return false
+		}
+	}
+
+	// Group expenses default to the group's base currency, personal ones to money.DefaultCurrency.
+	if strings.TrimSpace(expense.Currency) == "" && expense.GroupID != nil {
+		group, err := s.groups.Get(r.Context(), *expense.GroupID)
+		if err != nil {
+			apierror.WriteInternal(w, err, "Server error")
+			return false
+		}
+		expense.Currency = group.BaseCurrency
+	}
+	currency, err := money.NormalizeCurrency(expense.Currency)
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return false
+	}
+	expense.Currency = currency
+
+	if errs, err := s.resolveExpenseDate(r.Context(), expense, previous, time.Now()); err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return false
+	} else if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+
+	if errs, err := s.resolveCategory(r.Context(), expense); err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return false
+	} else if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+	expense.Tags = normalizeTags(expense.Tags)
+
+	if err := fillAmountsOwed(expense); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// loadExpenseForChange fetches an expense the caller may change: their own, or a group one their role
+// allows action on.
+func (s expenseStore) loadExpenseForChange(w http.ResponseWriter, r *http.Request, expenseID, callerID int, action models.GroupAction) (*Expense, bool) {
+	expense, err := s.loadExpense(r.Context(), expenseID)
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return nil, false
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense")
+		return nil, false
+	}
+
+	if expense.CreatedBy == callerID {
+		return expense, true
+	}
+	if expense.GroupID == nil {
+		apierror.Write(w, apierror.Forbidden, "Only the creator can change a personal expense")
+		return nil, false
+	}
+	if _, ok := authorizeGroupAction(w, r, s.groups, *expense.GroupID, callerID, action); !ok {
+		return nil, false
+	}
+	return expense, true
+}
+
+var errExpenseNotFound = repository.ErrNotFound
+
+// loadExpense reads a live (not deleted) expense with its contributors and amounts owed.
+func (s expenseStore) loadExpense(ctx context.Context, expenseID int) (*Expense, error) {
+	expense, deleted, err := s.expenses.Get(ctx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return nil, errExpenseNotFound
+	}
+	return expense, nil
+}
+
+// lockExpense holds the expense for the rest of the transaction and returns its current state, so
+// concurrent edits are applied one after the other.
+func (s expenseStore) lockExpense(ctx context.Context, expenseID int) (*Expense, error) {
+	expense, deleted, err := s.expenses.Lock(ctx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return nil, errExpenseNotFound
+	}
+	return expense, nil
+}
 
-		if err := rows.Scan(&expenseID, &description, &amount, &splitType, &expenseType, &createdBy, &userID, &owed, &contributionAmount, &paidAmount, &balance); err != nil {
-			http.Error(w, "Failed to parse expense details", http.StatusInternalServerError)
-			return
+// replaceExpense overwrites the stored expense and its splits, taking a new exchange rate only if the
+// currency or date changed from previous.
+func (s expenseStore) replaceExpense(ctx context.Context, previous, expense *Expense) error {
+	expense.CreatedAt = previous.CreatedAt
+	expense.ExchangeRate = previous.ExchangeRate
+	if expense.Currency != previous.Currency || !sameDate(expense.ExpenseDate, previous.ExpenseDate) {
+		if err := s.snapshotRate(ctx, expense, expense.ExpenseDate.Time); err != nil {
+			return err
 		}
+	}
+	return s.expenses.Update(ctx, expense)
+}
 
-		if _, exists := expenses[expenseID]; !exists {
-			expenses[expenseID] = map[string]interface{}{
-				"id":           expenseID,
-				"description":  description,
-				"amount":       amount,
-				"split_type":   splitType,
-				"expense_type": expenseType,
-				"created_by":   createdBy,
-				"contributors": []map[string]interface{}{},
-			}
+// snapshotRate records the rate from the expense's currency to the one its balances are kept in as of
+// date, so that later imports leave its worth alone. It records none while no rate is known.
+func (s expenseStore) snapshotRate(ctx context.Context, expense *Expense, date time.Time) error {
+	target := personalCurrency
+	if expense.GroupID != nil {
+		group, err := s.groups.Get(ctx, *expense.GroupID)
+		if err != nil {
+			return err
 		}
+		target = group.BaseCurrency
+	}
 
-		expenses[expenseID]["contributors"] = append(
-			expenses[expenseID]["contributors"].([]map[string]interface{}),
-			map[string]interface{}{
-				"user_id":             userID,
-				"contribution_amount": contributionAmount,
-				"paid_amount":         paidAmount,
-				"balance":             balance,
-			},
-		)
+	snapshot, err := rates.Take(s.rates, expense.Currency, target, date)
+	if err != nil {
+		return err
 	}
+	expense.ExchangeRate = snapshot
+	return nil
+}
 
-	if err = rows.Err(); err != nil {
-		http.Error(w, "Failed to fetch group expenses", http.StatusInternalServerError)
-		return
+// fillAmountsOwed works out the split with splitAmounts and stores it in expense.AmountsOwed.
+func fillAmountsOwed(expense *Expense) error {
+	owedAmounts, err := splitAmounts(*expense)
+	if err != nil {
+		return err
+	}
+	expense.AmountsOwed = make([]AmountOwed, len(owedAmounts))
+	for i, c := range expense.Contributors {
+		expense.AmountsOwed[i] = AmountOwed{UserID: c.UserID, Owed: owedAmounts[i], Balance: c.PaidAmount - owedAmounts[i]}
+	}
+	return nil
+}
+
+// splitAmounts works out how much each contributor owes, in contributor order, adding up to
+// expense.Amount exactly.
+func splitAmounts(expense Expense) ([]money.Amount, error) {
+	if len(expense.Contributors) == 0 {
+		return nil, errors.New("expense must have at least one contributor")
 	}
 
-	var expenseList []map[string]interface{}
-	for _, expense := range expenses {
-		expenseList = append(expenseList, expense)
+	weights := make([]int64, len(expense.Contributors))
+	switch expense.SplitType {
+	case SplitEqual:
+		return money.Equal(expense.Amount, len(expense.Contributors))
+	case SplitPercentage:
+		var total int64
+		for i, c := range expense.Contributors {
+			weights[i] = int64(c.Percentage)
+			total += weights[i]
+		}
+		if total != 100*100 {
+			return nil, errors.New("percentages must add up to 100")
+		}
+	case SplitAbsolute:
+		amounts := make([]money.Amount, len(expense.Contributors))
+		for i, c := range expense.Contributors {
+			amounts[i] = c.Amount
+		}
+		if money.Sum(amounts) != expense.Amount {
+			return nil, errors.New("absolute amounts must add up to the expense amount")
+		}
+		return amounts, nil
+	case SplitShareWise:
+		for i, c := range expense.Contributors {
+			weights[i] = int64(c.Share)
+		}
+	case SplitItemized:
+		return itemizedAmounts(expense)
+	default:
+		return nil, errors.New("invalid split type")
 	}
 
-	json.NewEncoder(w).Encode(expenseList)
+	return money.Allocate(expense.Amount, weights)
+}
+
+func hasContributor(contributors []Contributor, userID int) bool {
+	for _, c := range contributors {
+		if c.UserID == userID {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/validation"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultMaxBackdateDays is how far back an expense may be dated by default: a year.
+const defaultMaxBackdateDays = 365
+
+// maxBackdateDays reads EXPENSE_MAX_BACKDATE_DAYS; 0 lifts the limit.
+func maxBackdateDays() int {
+	if value := os.Getenv("EXPENSE_MAX_BACKDATE_DAYS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultMaxBackdateDays
+}
+
+// payerID is the contributor who paid the most towards the expense, the first of them on a tie.
+func payerID(contributors []Contributor) int {
+	payer := 0
+	var paid int64 = -1
+	for _, c := range contributors {
+		if int64(c.PaidAmount) > paid {
+			payer, paid = c.UserID, int64(c.PaidAmount)
+		}
+	}
+	return payer
+}
+
+// fillTimeZone defaults the expense's time zone to its payer's and checks it is a real one.
+func (s expenseStore) fillTimeZone(ctx context.Context, expense *Expense) (*time.Location, validation.Errors, error) {
+	var errs validation.Errors
+	if expense.TimeZone == "" {
+		loc, err := userLocation(ctx, s.users, payerID(expense.Contributors))
+		if err != nil {
+			return nil, nil, err
+		}
+		expense.TimeZone = loc.String()
+		return loc, nil, nil
+	}
+
+	name, err := parseTimeZone(expense.TimeZone)
+	if err != nil {
+		errs.Add("time_zone", "%s", err)
+		return nil, errs, nil
+	}
+	expense.TimeZone = name
+	loc, _ := time.LoadLocation(name)
+	return loc, nil, nil
+}
+
+// resolveExpenseDate fills in the expense's time zone and date and holds the date to the backdating
+// rules. previous, nil for a new expense, supplies what the request leaves out, and a date it does not
+// change is not checked again so that an old expense stays editable.
+func (s expenseStore) resolveExpenseDate(ctx context.Context, expense, previous *Expense, now time.Time) (validation.Errors, error) {
+	if previous != nil {
+		if expense.TimeZone == "" {
+			expense.TimeZone = previous.TimeZone
+		}
+		if expense.ExpenseDate == nil {
+			expense.ExpenseDate = previous.ExpenseDate
+		}
+	}
+	loc, errs, err := s.fillTimeZone(ctx, expense)
+	if err != nil || len(errs) > 0 {
+		return errs, err
+	}
+
+	today := recurrence.Day(now.In(loc))
+	if expense.ExpenseDate == nil {
+		expense.ExpenseDate = &today
+		return nil, nil
+	}
+	if previous != nil && sameDate(expense.ExpenseDate, previous.ExpenseDate) {
+		return nil, nil
+	}
+
+	date := *expense.ExpenseDate
+	if date.After(today.Time) {
+		errs.Add("expense_date", "cannot be later than today (%s in %s)", today, loc)
+	} else if limit := maxBackdateDays(); limit > 0 && date.Before(today.AddDays(-limit).Time) {
+		errs.Add("expense_date", "cannot be more than %d days ago", limit)
+	} else if expense.GroupID != nil {
+		group, err := s.groups.Get(ctx, *expense.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if first := recurrence.Day(group.CreatedAt.In(loc)); date.Before(first.Time) {
+			errs.Add("expense_date", "cannot be before the group was created on %s", first)
+		}
+	}
+	return errs, nil
+}
+
+// sameDate reports whether two optional dates are the same day.
+func sameDate(a, b *recurrence.Date) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b.Time)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+)
+
+func datePtr(s string) *recurrence.Date {
+	d, err := recurrence.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return &d
+}
+
+func TestResolveExpenseDate(t *testing.T) {
+	t.Setenv("EXPENSE_MAX_BACKDATE_DAYS", "30")
+	// 22:00 UTC on 10 March is already 11 March in Tokyo.
+	now := time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expense   Expense
+		previous  *Expense
+		wantDate  string
+		wantError bool
+	}{
+		{name: "defaults to today where it was paid", expense: Expense{TimeZone: "Asia/Tokyo"}, wantDate: "2024-03-11"},
+		{name: "same instant is still the 10th in UTC", expense: Expense{TimeZone: "UTC"}, wantDate: "2024-03-10"},
+		{name: "backdated within the limit", expense: Expense{TimeZone: "UTC", ExpenseDate: datePtr("2024-02-15")}, wantDate: "2024-02-15"},
+		{name: "today in Tokyo is not the future", expense: Expense{TimeZone: "Asia/Tokyo", ExpenseDate: datePtr("2024-03-11")}, wantDate: "2024-03-11"},
+		{name: "tomorrow in UTC is the future", expense: Expense{TimeZone: "UTC", ExpenseDate: datePtr("2024-03-11")}, wantError: true},
+		{name: "beyond the backdating limit", expense: Expense{TimeZone: "UTC", ExpenseDate: datePtr("2024-01-01")}, wantError: true},
+		{name: "unknown time zone", expense: Expense{TimeZone: "Mars/Olympus"}, wantError: true},
+		{
+			name:     "an old date that is not changing is kept",
+			expense:  Expense{},
+			previous: &Expense{TimeZone: "Europe/Paris", ExpenseDate: datePtr("2023-06-01")},
+			wantDate: "2023-06-01",
+		},
+		{
+			name:      "moving an old expense further back is checked",
+			expense:   Expense{ExpenseDate: datePtr("2023-05-01")},
+			previous:  &Expense{TimeZone: "Europe/Paris", ExpenseDate: datePtr("2023-06-01")},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := tt.expense
+			errs, err := expenseStore{}.resolveExpenseDate(context.Background(), &expense, tt.previous, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantError {
+				if len(errs) == 0 {
+					t.Fatalf("expected a validation error, got date %v", expense.ExpenseDate)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if expense.ExpenseDate == nil || expense.ExpenseDate.String() != tt.wantDate {
+				t.Fatalf("expense_date = %v, want %s", expense.ExpenseDate, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestPayerID(t *testing.T) {
+	if got := payerID([]Contributor{{UserID: 4}, {UserID: 2, PaidAmount: 500}, {UserID: 9, PaidAmount: 500}}); got != 2 {
+		t.Fatalf("payerID = %d, want 2", got)
+	}
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldChange is one field that differs between two versions of an expense.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+type RevisionEntry struct {
+	Revision  int           `json:"revision"`
+	Action    string        `json:"action"` // "update", "delete" or "restore"
+	ActorID   *int          `json:"actor_id"`
+	ChangedAt time.Time     `json:"changed_at"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// GetExpenseHistory lists every change made to an expense, oldest first, with a field-level diff
+// between the version each change replaced and the version it produced.
+func (h *ExpenseHandler) GetExpenseHistory(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	expenseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID")
+		return
+	}
+
+	current, deleted, err := h.expenses.Get(r.Context(), expenseID)
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense")
+		return
+	}
+
+	if !h.canViewExpense(w, r, current, callerID) {
+		return
+	}
+
+	revisions, err := h.expenses.Revisions(r.Context(), expenseID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense history")
+		return
+	}
+
+	entries := make([]RevisionEntry, len(revisions))
+	for i, rev := range revisions {
+		entry := RevisionEntry{
+			Revision:  rev.Revision,
+			Action:    rev.Action,
+			ActorID:   rev.ActorID,
+			ChangedAt: rev.CreatedAt,
+			Changes:   []FieldChange{},
+		}
+		if rev.Action != "delete" {
+			after := current
+			if i+1 < len(revisions) {
+				after = &revisions[i+1].Snapshot
+			}
+			entry.Changes = diffExpenses(&rev.Snapshot, after)
+		}
+		entries[i] = entry
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"expense_id": expenseID,
+		"created_by": current.CreatedBy,
+		"deleted":    deleted,
+		"current":    current,
+		"revisions":  entries,
+	})
+}
+
+// RestoreExpenseRevision makes an expense look like it did at an earlier revision, undeleting it if
+// necessary. The restore is itself recorded, so it can be undone the same way.
+func (h *ExpenseHandler) RestoreExpenseRevision(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	expenseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	revisionNumber, err2 := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil || err2 != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid expense ID or revision")
+		return
+	}
+
+	current, _, err := h.expenses.Get(r.Context(), expenseID)
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch expense")
+		return
+	}
+
+	if current.CreatedBy != callerID {
+		if current.GroupID == nil {
+			apierror.Write(w, apierror.Forbidden, "Only the creator can change a personal expense")
+			return
+		}
+		if _, ok := authorizeGroupAction(w, r, h.groups, *current.GroupID, callerID, models.ActionEditExpense); !ok {
+			return
+		}
+	}
+
+	revision, err := h.expenses.Revision(r.Context(), expenseID, revisionNumber)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.RevisionNotFound, "Revision not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch revision")
+		return
+	}
+
+	restored := revision.Snapshot
+	restored.ID = current.ID
+	restored.CreatedBy = current.CreatedBy
+	restored.GroupID = current.GroupID
+	restored.ExpenseType = current.ExpenseType
+
+	// Revisions taken before expenses had dates carry none, so those keep the current one.
+	if restored.ExpenseDate == nil {
+		restored.ExpenseDate, restored.TimeZone = current.ExpenseDate, current.TimeZone
+	}
+	accepted := restored
+
+	// Membership may have changed since the revision was taken, so it goes through the same checks as an
+	// edit. Its date was accepted once already and is not held to the backdating limit again.
+	if !h.prepareExpense(w, r, &restored, &accepted, callerID) {
+		return
+	}
+
+	err = h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		before, _, err := h.expenses.Lock(ctx, expenseID)
+		if err != nil {
+			return err
+		}
+		if err := h.expenses.SaveRevision(ctx, before, "restore", callerID); err != nil {
+			return err
+		}
+		if err := h.replaceExpense(ctx, before, &restored); err != nil {
+			return err
+		}
+		return h.expenses.Undelete(ctx, expenseID)
+	})
+	if errors.Is(err, errExpenseNotFound) {
+		apierror.Write(w, apierror.ExpenseNotFound, "Expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to restore expense")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Expense restored successfully", "expense_id": expenseID, "restored_revision": revisionNumber})
+}
+
+// canViewExpense writes a 403 and returns false unless the caller may see the expense.
+func (s expenseStore) canViewExpense(w http.ResponseWriter, r *http.Request, expense *Expense, callerID int) bool {
+	if expense.GroupID != nil {
+		_, ok := requireGroupMember(w, r, s.groups, *expense.GroupID, callerID)
+		return ok
+	}
+	if expense.CreatedBy == callerID || hasContributor(expense.Contributors, callerID) {
+		return true
+	}
+	apierror.Write(w, apierror.Forbidden, "You are not part of this expense")
+	return false
+}
+
+// diffExpenses lists the fields that differ between two versions of an expense, matching
+// contributors by user ID.
+func diffExpenses(before, after *Expense) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, old, new interface{}) {
+		changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+	}
+
+	if before.Description != after.Description {
+		add("description", before.Description, after.Description)
+	}
+	if before.Amount != after.Amount {
+		add("amount", before.Amount, after.Amount)
+	}
+	if before.Currency != after.Currency {
+		add("currency", before.Currency, after.Currency)
+	}
+	if before.SplitType != after.SplitType {
+		add("split_type", before.SplitType, after.SplitType)
+	}
+	if !sameDate(before.ExpenseDate, after.ExpenseDate) {
+		add("expense_date", before.ExpenseDate, after.ExpenseDate)
+	}
+	if before.TimeZone != after.TimeZone {
+		add("time_zone", before.TimeZone, after.TimeZone)
+	}
+	if !sameCategory(before.CategoryID, after.CategoryID) {
+		add("category", before.Category, after.Category)
+	}
+	if strings.Join(before.Tags, ",") != strings.Join(after.Tags, ",") {
+		add("tags", before.Tags, after.Tags)
+	}
+	if !reflect.DeepEqual(before.Items, after.Items) {
+		add("items", before.Items, after.Items)
+	}
+	for _, f := range []struct {
+		name          string
+		before, after money.Amount
+	}{{"tax", before.Tax, after.Tax}, {"tip", before.Tip, after.Tip}, {"discount", before.Discount, after.Discount}} {
+		if f.before != f.after {
+			add(f.name, f.before, f.after)
+		}
+	}
+
+	oldContributors := contributorsByUser(before)
+	newContributors := contributorsByUser(after)
+	oldOwed := owedByUser(before)
+	newOwed := owedByUser(after)
+
+	userIDs := make([]int, 0, len(oldContributors)+len(newContributors))
+	for id := range oldContributors {
+		userIDs = append(userIDs, id)
+	}
+	for id := range newContributors {
+		if _, ok := oldContributors[id]; !ok {
+			userIDs = append(userIDs, id)
+		}
+	}
+	sort.Ints(userIDs)
+
+	for _, id := range userIDs {
+		prefix := fmt.Sprintf("contributors[user_id=%d]", id)
+		oldC, hadOld := oldContributors[id]
+		newC, hasNew := newContributors[id]
+		switch {
+		case !hadOld:
+			add(prefix, nil, newC)
+			continue
+		case !hasNew:
+			add(prefix, oldC, nil)
+			continue
+		}
+
+		if oldC.PaidAmount != newC.PaidAmount {
+			add(prefix+".paid_amount", oldC.PaidAmount, newC.PaidAmount)
+		}
+		if oldC.Percentage != newC.Percentage {
+			add(prefix+".percentage", oldC.Percentage, newC.Percentage)
+		}
+		if oldC.Share != newC.Share {
+			add(prefix+".share", oldC.Share, newC.Share)
+		}
+		if oldC.Amount != newC.Amount {
+			add(prefix+".amount", oldC.Amount, newC.Amount)
+		}
+		if oldOwed[id] != newOwed[id] {
+			add(prefix+".owed", oldOwed[id], newOwed[id])
+		}
+	}
+
+	return changes
+}
+
+func contributorsByUser(expense *Expense) map[int]Contributor {
+	byUser := make(map[int]Contributor, len(expense.Contributors))
+	for _, c := range expense.Contributors {
+		byUser[c.UserID] = c
+	}
+	return byUser
+}
+
+func owedByUser(expense *Expense) map[int]money.Amount {
+	byUser := make(map[int]money.Amount, len(expense.AmountsOwed))
+	for _, ao := range expense.AmountsOwed {
+		byUser[ao.UserID] = ao.Owed
+	}
+	return byUser
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExpensePageSize = 50
+	maxExpensePageSize     = 200
+	maxSearchLength        = 100
+)
+
+// expenseCursor marks the last expense of a page and the sort it was made for.
+type expenseCursor struct {
+	Sort   string           `json:"s"`
+	Desc   bool             `json:"d,omitempty"`
+	Date   *recurrence.Date `json:"t,omitempty"`
+	Amount money.Amount     `json:"a,omitempty"`
+	ID     int              `json:"id"`
+}
+
+// cursorAfter is the cursor for a page ending with e.
+func cursorAfter(filter repository.ExpenseFilter, e *Expense) expenseCursor {
+	c := expenseCursor{Sort: filter.Sort, Desc: filter.Desc, ID: e.ID, Amount: e.Amount}
+	if filter.Sort == repository.SortByDate {
+		c.Date = e.ExpenseDate
+	}
+	return c
+}
+
+func (c expenseCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeExpenseCursor(s string) (*expenseCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c expenseCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// GroupExpensePage is one page of GetGroupExpenses. NextCursor is nil on the last page.
+type GroupExpensePage struct {
+	Expenses   []map[string]interface{} `json:"expenses"`
+	TotalCount int                      `json:"total_count"` // expenses matching the filters, across all pages
+	NextCursor *string                  `json:"next_cursor"`
+}
+
+// GetGroupExpenses lists a group's expenses a page at a time, latest expense date first. ?sort=date|amount and
+// ?order=asc|desc change the order; ties are broken by ID so pages never overlap or skip. Pass the
+// returned next_cursor as ?cursor= for the following page, and ?limit= for its size.
+//
+// Filters: ?from=&to= expense dates, ?payer= (paid something), ?participant= (any part in it),
+// ?min_amount=&max_amount= (in the expense's own currency), ?q= (text in the description),
+// ?category_id= (an ID, or "none" for uncategorized ones) and each ?tag=.
+func (h *ExpenseHandler) GetGroupExpenses(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	loc, ok := callerLocation(w, r, h.users, callerID)
+	if !ok {
+		return
+	}
+	filter, err := parseExpenseListFilter(r, loc)
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+	filter.GroupID = groupID
+
+	page, err := h.listGroupExpenses(r.Context(), filter, loc)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch group expenses")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseExpenseListFilter reads GetGroupExpenses' query, taking the dates of timestamps in loc.
+func parseExpenseListFilter(r *http.Request, loc *time.Location) (repository.ExpenseFilter, error) {
+	params := r.URL.Query()
+	filter := repository.ExpenseFilter{Sort: repository.SortByDate, Desc: true, Limit: defaultExpensePageSize}
+
+	switch sort := params.Get("sort"); sort {
+	case "", repository.SortByDate:
+	case repository.SortByAmount:
+		filter.Sort = repository.SortByAmount
+	default:
+		return filter, errors.New("sort must be date or amount")
+	}
+	switch order := params.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Desc = false
+	default:
+		return filter, errors.New("order must be asc or desc")
+	}
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxExpensePageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxExpensePageSize)
+		}
+		filter.Limit = n
+	}
+	if value := params.Get("cursor"); value != "" {
+		after, err := decodeExpenseCursor(value)
+		if err != nil {
+			return filter, err
+		}
+		if after.Sort != filter.Sort || after.Desc != filter.Desc {
+			return filter, errors.New("cursor was made for a different sort order")
+		}
+		if filter.Sort == repository.SortByDate && after.Date == nil {
+			return filter, errInvalidCursor
+		}
+		filter.After = &repository.ExpenseCursor{Date: after.Date, Amount: after.Amount, ID: after.ID}
+	}
+
+	switch category := params.Get("category_id"); category {
+	case "":
+	case "none":
+		filter.Uncategorized = true
+	default:
+		categoryID, err := strconv.Atoi(category)
+		if err != nil {
+			return filter, errors.New("Invalid category ID")
+		}
+		filter.CategoryID = &categoryID
+	}
+	filter.Tags = normalizeTags(params["tag"])
+
+	for _, bound := range []struct {
+		name string
+		dst  **recurrence.Date
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := params.Get(bound.name); value != "" {
+			date, err := parseDateParam(value, loc)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 timestamp", bound.name)
+			}
+			*bound.dst = &date
+		}
+	}
+	for _, user := range []struct {
+		name string
+		dst  **int
+	}{{"payer", &filter.PayerID}, {"participant", &filter.ParticipantID}} {
+		if value := params.Get(user.name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid user ID in %s", user.name)
+			}
+			*user.dst = &id
+		}
+	}
+	for _, bound := range []struct {
+		name string
+		dst  **money.Amount
+	}{{"min_amount", &filter.MinAmount}, {"max_amount", &filter.MaxAmount}} {
+		if value := params.Get(bound.name); value != "" {
+			amount, err := money.Parse(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an amount like 250 or 99.50", bound.name)
+			}
+			*bound.dst = &amount
+		}
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, errors.New("min_amount cannot be more than max_amount")
+	}
+	filter.Search = strings.TrimSpace(params.Get("q"))
+	if len(filter.Search) > maxSearchLength {
+		return filter, fmt.Errorf("q cannot be longer than %d characters", maxSearchLength)
+	}
+	return filter, nil
+}
+
+// parseDateParam reads a YYYY-MM-DD date, or the date an RFC 3339 timestamp falls on in loc.
+func parseDateParam(value string, loc *time.Location) (recurrence.Date, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return recurrence.Day(t.In(loc)), nil
+	}
+	return recurrence.ParseDate(value)
+}
+
+// listGroupExpenses reads one page and summarises its expenses, showing timestamps in loc.
+func (h *ExpenseHandler) listGroupExpenses(ctx context.Context, filter repository.ExpenseFilter, loc *time.Location) (*GroupExpensePage, error) {
+	result, err := h.expenses.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &GroupExpensePage{Expenses: []map[string]interface{}{}, TotalCount: result.Total}
+	for i := range result.Expenses {
+		summary, err := expenseSummary(&result.Expenses[i], loc)
+		if err != nil {
+			return nil, err
+		}
+		page.Expenses = append(page.Expenses, summary)
+	}
+	if result.More && len(result.Expenses) > 0 {
+		next := cursorAfter(filter, &result.Expenses[len(result.Expenses)-1]).encode()
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+// inLocation is t shown in loc, or nil if there is no t.
+func inLocation(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
+
+// expenseSummary is how an expense appears in a GetGroupExpenses listing.
+func expenseSummary(e *Expense, loc *time.Location) (map[string]interface{}, error) {
+	var category *string
+	if e.CategoryID != nil {
+		category = &e.Category
+	}
+	tags := e.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	summary := map[string]interface{}{
+		"id":           e.ID,
+		"description":  e.Description,
+		"amount":       e.Amount,
+		"currency":     e.Currency,
+		"split_type":   e.SplitType,
+		"expense_type": e.ExpenseType,
+		"created_by":   e.CreatedBy,
+		"expense_date": e.ExpenseDate,
+		"time_zone":    e.TimeZone,
+		"created_at":   inLocation(e.CreatedAt, loc),
+		"updated_at":   inLocation(e.UpdatedAt, loc),
+		"category_id":  e.CategoryID,
+		"category":     category,
+		"tags":         tags,
+	}
+
+	var shares map[int]ItemizedShare
+	if e.SplitType == SplitItemized {
+		var err error
+		if shares, err = itemizedShares(*e); err != nil {
+			return nil, err
+		}
+		summary["tax"] = e.Tax
+		summary["tip"] = e.Tip
+		summary["discount"] = e.Discount
+		summary["items"] = e.Items
+	}
+
+	contributors := make([]map[string]interface{}, len(e.Contributors))
+	for i, c := range e.Contributors {
+		contributors[i] = map[string]interface{}{
+			"user_id":             c.UserID,
+			"contribution_amount": e.AmountsOwed[i].Owed,
+			"paid_amount":         c.PaidAmount,
+			"balance":             e.AmountsOwed[i].Balance,
+		}
+		if shares != nil {
+			contributors[i]["itemized"] = shares[c.UserID]
+		}
+	}
+	summary["contributors"] = contributors
+	return summary, nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+func TestParseExpenseListFilter(t *testing.T) {
+	cursor := expenseCursor{Sort: repository.SortByAmount, Desc: true, Amount: 2500, ID: 41}.encode()
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+		check   func(t *testing.T, f repository.ExpenseFilter)
+	}{
+		{
+			name:  "defaults to newest first",
+			query: "",
+			check: func(t *testing.T, f repository.ExpenseFilter) {
+				if f.Sort != repository.SortByDate || !f.Desc || f.Limit != defaultExpensePageSize || f.After != nil {
+					t.Fatalf("got %+v", f)
+				}
+			},
+		},
+		{
+			name:  "every filter",
+			query: "sort=amount&order=asc&limit=10&from=2024-01-01&to=2024-01-31T20:00:00Z&payer=3&participant=4&min_amount=10&max_amount=99.50&q=+Dinner+&tag=Trip&category_id=none",
+			check: func(t *testing.T, f repository.ExpenseFilter) {
+				if f.Sort != repository.SortByAmount || f.Desc || f.Limit != 10 {
+					t.Fatalf("sort: got %+v", f)
+				}
+				// 20:00 UTC on the 31st is already 1 February in Kolkata.
+				if f.From.String() != "2024-01-01" || f.To.String() != "2024-02-01" {
+					t.Fatalf("dates: got %v to %v", f.From, f.To)
+				}
+				if *f.PayerID != 3 || *f.ParticipantID != 4 || *f.MinAmount != 1000 || *f.MaxAmount != 9950 {
+					t.Fatalf("filters: got %+v", f)
+				}
+				if f.Search != "Dinner" || len(f.Tags) != 1 || f.Tags[0] != "trip" || !f.Uncategorized {
+					t.Fatalf("search: got %+v", f)
+				}
+			},
+		},
+		{
+			name:  "cursor for the same sort",
+			query: "sort=amount&cursor=" + cursor,
+			check: func(t *testing.T, f repository.ExpenseFilter) {
+				if f.After == nil || f.After.ID != 41 || f.After.Amount != 2500 {
+					t.Fatalf("got cursor %+v", f.After)
+				}
+			},
+		},
+		{name: "cursor for another sort", query: "sort=date&cursor=" + cursor, wantErr: "different sort order"},
+		{name: "garbage cursor", query: "cursor=not-a-cursor", wantErr: "Invalid cursor"},
+		{name: "unknown sort", query: "sort=payer", wantErr: "sort must be"},
+		{name: "limit too large", query: "limit=1000", wantErr: "limit must be"},
+		{name: "bad amount", query: "min_amount=1.234", wantErr: "min_amount must be"},
+		{name: "min above max", query: "min_amount=50&max_amount=10", wantErr: "cannot be more than"},
+		{name: "bad payer", query: "payer=me", wantErr: "payer"},
+		{name: "bad date", query: "from=01/02/2024", wantErr: "from must be a date"},
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseExpenseListFilter(httptest.NewRequest("GET", "/api/group/1/expenses?"+tt.query, nil), kolkata)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, f)
+		})
+	}
+}
+
+func TestExpenseSummaryTimestamps(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, time.March, 31, 20, 0, 0, 0, time.UTC)
+	expense := &Expense{
+		SplitType:    "equal",
+		Contributors: []Contributor{{UserID: 1, PaidAmount: 100}},
+		AmountsOwed:  []AmountOwed{{UserID: 1}},
+		CreatedAt:    &created,
+	}
+
+	summary, err := expenseSummary(expense, kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summary["created_at"].(*time.Time); !got.Equal(created) || got.Location() != kolkata {
+		t.Errorf("created_at = %v, want %v in Asia/Kolkata", got, created)
+	}
+	if got := summary["updated_at"].(*time.Time); got != nil {
+		t.Errorf("updated_at = %v, want nil", got)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/validation"
+	"math"
+	"net/http"
+)
+
+// validateExpense reports every problem with an expense, so that splitAmounts only sees valid input.
+func validateExpense(expense Expense) validation.Errors {
+	var errs validation.Errors
+
+	if expense.Amount <= 0 {
+		errs.Add("amount", "must be greater than zero")
+	}
+	if _, err := money.NormalizeCurrency(expense.Currency); err != nil {
+		errs.Add("currency", "must be a three-letter ISO 4217 code")
+	}
+
+	validateTags(expense.Tags, &errs)
+
+	if len(expense.Contributors) == 0 {
+		errs.Add("contributors", "must list at least one contributor")
+		return errs
+	}
+	if expense.GroupID == nil && len(expense.Contributors) < 2 {
+		errs.Add("contributors", "a personal expense needs at least two contributors")
+	}
+
+	seen := make(map[int]bool)
+	var paidTotal money.Amount
+	for i, c := range expense.Contributors {
+		field := contributorField(i)
+		if c.UserID <= 0 {
+			errs.Add(field+".user_id", "is required")
+		} else if seen[c.UserID] {
+			errs.Add(field+".user_id", "user %d is listed more than once", c.UserID)
+		}
+		seen[c.UserID] = true
+
+		if c.PaidAmount < 0 {
+			errs.Add(field+".paid_amount", "must not be negative")
+		}
+		paidTotal += c.PaidAmount
+	}
+	if expense.Amount > 0 && paidTotal != expense.Amount {
+		errs.Add("contributors", "paid amounts add up to %s but the expense amount is %s", paidTotal, expense.Amount)
+	}
+
+	switch expense.SplitType {
+	case SplitEqual:
+	case SplitPercentage:
+		validatePercentages(expense.Contributors, &errs)
+	case SplitAbsolute:
+		validateAbsoluteAmounts(expense, &errs)
+	case SplitShareWise:
+		validateShares(expense.Contributors, &errs)
+	case SplitItemized:
+		validateItemized(expense, &errs)
+	case "":
+		errs.Add("split_type", "is required")
+	default:
+		errs.Add("split_type", "must be one of %s, %s, %s, %s or %s", SplitEqual, SplitPercentage, SplitAbsolute, SplitShareWise, SplitItemized)
+	}
+	if expense.SplitType != SplitItemized && (len(expense.Items) > 0 || expense.Tax != 0 || expense.Tip != 0 || expense.Discount != 0) {
+		errs.Add("items", "items, tax, tip and discount are only used with the %s split", SplitItemized)
+	}
+
+	return errs
+}
+
+func validatePercentages(contributors []Contributor, errs *validation.Errors) {
+	var total money.Hundredths
+	valid := true
+	for i, c := range contributors {
+		field := contributorField(i) + ".percentage"
+		if c.Percentage < 0 || c.Percentage > 100*100 {
+			errs.Add(field, "must be between 0 and 100")
+			valid = false
+		}
+		total += c.Percentage
+	}
+	if valid && total != 100*100 {
+		errs.Add("contributors", "percentages add up to %s but must add up to 100", total)
+	}
+}
+
+func validateAbsoluteAmounts(expense Expense, errs *validation.Errors) {
+	var total money.Amount
+	valid := true
+	for i, c := range expense.Contributors {
+		if c.Amount < 0 {
+			errs.Add(contributorField(i)+".amount", "must not be negative")
+			valid = false
+		}
+		total += c.Amount
+	}
+	if valid && total != expense.Amount {
+		errs.Add("contributors", "amounts add up to %s but the expense amount is %s", total, expense.Amount)
+	}
+}
+
+func validateShares(contributors []Contributor, errs *validation.Errors) {
+	var total money.Hundredths
+	valid := true
+	for i, c := range contributors {
+		switch {
+		case c.Share < 0:
+			errs.Add(contributorField(i)+".share", "must not be negative")
+			valid = false
+		case c.Share > math.MaxInt64-total:
+			errs.Add("contributors", "total shares are too large")
+			return
+		default:
+			total += c.Share
+		}
+	}
+	if valid && total <= 0 {
+		errs.Add("contributors", "total shares must be greater than zero")
+	}
+}
+
+// writeValidationErrors responds 422 with the full list of field errors.
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	apierror.WriteError(w, apierror.Validation(errs))
+}
+
+func contributorField(i int) string {
+	return fmt.Sprintf("contributors[%d]", i)
+}
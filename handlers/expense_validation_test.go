@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ashishsonamm/setu-splitwise/money"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestValidateExpense(t *testing.T) {
+	tests := []struct {
+		name       string
+		expense    Expense
+		wantFields []string
+	}{
+		{
+			name: "equal split is valid",
+			expense: Expense{Amount: 10000, SplitType: SplitEqual, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000}, {UserID: 2}, {UserID: 3},
+			}},
+		},
+		{
+			name: "equal split with paid total below amount",
+			expense: Expense{Amount: 10000, SplitType: SplitEqual, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 5000}, {UserID: 2},
+			}},
+			wantFields: []string{"contributors"},
+		},
+		{
+			name: "percentage split adding to 100 is valid",
+			expense: Expense{Amount: 10000, SplitType: SplitPercentage, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Percentage: 3333}, {UserID: 2, Percentage: 3333}, {UserID: 3, Percentage: 3334},
+			}},
+		},
+		{
+			name: "percentage split not adding to 100",
+			expense: Expense{Amount: 10000, SplitType: SplitPercentage, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Percentage: 5000}, {UserID: 2, Percentage: 4000},
+			}},
+			wantFields: []string{"contributors"},
+		},
+		{
+			name: "percentage out of range",
+			expense: Expense{Amount: 10000, SplitType: SplitPercentage, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Percentage: 12000}, {UserID: 2, Percentage: -2000},
+			}},
+			wantFields: []string{"contributors[0].percentage", "contributors[1].percentage"},
+		},
+		{
+			name: "absolute split matching amount is valid",
+			expense: Expense{Amount: 10000, SplitType: SplitAbsolute, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Amount: 2500}, {UserID: 2, Amount: 7500},
+			}},
+		},
+		{
+			name: "absolute split not matching amount",
+			expense: Expense{Amount: 10000, SplitType: SplitAbsolute, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Amount: 2500}, {UserID: 2, Amount: 2500},
+			}},
+			wantFields: []string{"contributors"},
+		},
+		{
+			name: "absolute split with negative amount",
+			expense: Expense{Amount: 10000, SplitType: SplitAbsolute, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Amount: 12500}, {UserID: 2, Amount: -2500},
+			}},
+			wantFields: []string{"contributors[1].amount"},
+		},
+		{
+			name: "share-wise split is valid",
+			expense: Expense{Amount: 10000, SplitType: SplitShareWise, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Share: 200}, {UserID: 2, Share: 100}, {UserID: 3, Share: 0},
+			}},
+		},
+		{
+			name: "share-wise split with zero total shares",
+			expense: Expense{Amount: 10000, SplitType: SplitShareWise, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000}, {UserID: 2},
+			}},
+			wantFields: []string{"contributors"},
+		},
+		{
+			name: "share-wise split with negative share",
+			expense: Expense{Amount: 10000, SplitType: SplitShareWise, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Share: 300}, {UserID: 2, Share: -100},
+			}},
+			wantFields: []string{"contributors[1].share"},
+		},
+		{
+			name: "share-wise split with shares too large to add up",
+			expense: Expense{Amount: 10000, SplitType: SplitShareWise, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000, Share: math.MaxInt64}, {UserID: 2, Share: 100},
+			}},
+			wantFields: []string{"contributors"},
+		},
+		{
+			name: "duplicate contributor and negative paid amount",
+			expense: Expense{Amount: 10000, SplitType: SplitEqual, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 12000}, {UserID: 1, PaidAmount: -2000},
+			}},
+			wantFields: []string{"contributors[1].user_id", "contributors[1].paid_amount"},
+		},
+		{
+			name:       "missing amount, split type and contributors",
+			expense:    Expense{GroupID: intPtr(1)},
+			wantFields: []string{"amount", "contributors"},
+		},
+		{
+			name: "unknown split type",
+			expense: Expense{Amount: 10000, SplitType: "equally", GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000},
+			}},
+			wantFields: []string{"split_type"},
+		},
+		{
+			name: "personal expense with a single contributor",
+			expense: Expense{Amount: 10000, SplitType: SplitEqual, Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000},
+			}},
+			wantFields: []string{"contributors"},
+		},
+		{
+			name: "invalid currency",
+			expense: Expense{Amount: 10000, Currency: "RUPEES", SplitType: SplitEqual, GroupID: intPtr(1), Contributors: []Contributor{
+				{UserID: 1, PaidAmount: 10000},
+			}},
+			wantFields: []string{"currency"},
+		},
+		{
+			name: "itemized split adding up is valid",
+			expense: Expense{Amount: 2510, SplitType: SplitItemized, GroupID: intPtr(1), Tax: 210, Tip: 300, Discount: 100,
+				Items:        []LineItem{{Amount: 1200, AssignedTo: []int{1, 2}}, {Amount: 600, AssignedTo: []int{2}}, {Amount: 300, AssignedTo: []int{3}}},
+				Contributors: []Contributor{{UserID: 1, PaidAmount: 2510}, {UserID: 2}, {UserID: 3}}},
+		},
+		{
+			name: "itemized split with an unknown assignee and wrong total",
+			expense: Expense{Amount: 2000, SplitType: SplitItemized, GroupID: intPtr(1),
+				Items:        []LineItem{{Amount: 1200, AssignedTo: []int{1, 4}}},
+				Contributors: []Contributor{{UserID: 1, PaidAmount: 2000}, {UserID: 2}}},
+			wantFields: []string{"items[0].assigned_to", "items"},
+		},
+		{
+			name: "items on a non-itemized split",
+			expense: Expense{Amount: 1000, SplitType: SplitEqual, GroupID: intPtr(1), Tip: 100,
+				Contributors: []Contributor{{UserID: 1, PaidAmount: 1000}, {UserID: 2}}},
+			wantFields: []string{"items"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateExpense(tt.expense)
+			if len(tt.wantFields) == 0 && len(errs) > 0 {
+				t.Fatalf("expected no errors, got %v", errs)
+			}
+			for _, field := range tt.wantFields {
+				if !errs.Has(field) {
+					t.Errorf("expected an error on %q, got %v", field, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitAmountsAddUpToTotal(t *testing.T) {
+	tests := []struct {
+		name    string
+		expense Expense
+		want    []money.Amount
+	}{
+		{
+			name: "equal",
+			expense: Expense{Amount: 10000, SplitType: SplitEqual, Contributors: []Contributor{
+				{UserID: 1}, {UserID: 2}, {UserID: 3},
+			}},
+			want: []money.Amount{3334, 3333, 3333},
+		},
+		{
+			name: "percentage",
+			expense: Expense{Amount: 10001, SplitType: SplitPercentage, Contributors: []Contributor{
+				{UserID: 1, Percentage: 5000}, {UserID: 2, Percentage: 5000},
+			}},
+			want: []money.Amount{5001, 5000},
+		},
+		{
+			name: "absolute",
+			expense: Expense{Amount: 10000, SplitType: SplitAbsolute, Contributors: []Contributor{
+				{UserID: 1, Amount: 1234}, {UserID: 2, Amount: 8766},
+			}},
+			want: []money.Amount{1234, 8766},
+		},
+		{
+			name: "share-wise",
+			expense: Expense{Amount: 1000, SplitType: SplitShareWise, Contributors: []Contributor{
+				{UserID: 1, Share: 100}, {UserID: 2, Share: 100}, {UserID: 3, Share: 100},
+			}},
+			want: []money.Amount{334, 333, 333},
+		},
+		{
+			name: "itemized with proportional tax, tip and discount",
+			expense: Expense{Amount: 2510, SplitType: SplitItemized, Tax: 210, Tip: 300, Discount: 100,
+				Items:        []LineItem{{Amount: 1200, AssignedTo: []int{1, 2}}, {Amount: 600, AssignedTo: []int{2}}, {Amount: 300, AssignedTo: []int{3}}},
+				Contributors: []Contributor{{UserID: 1}, {UserID: 2}, {UserID: 3}}},
+			want: []money.Amount{717, 1434, 359},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitAmounts(tt.expense)
+			if err != nil {
+				t.Fatalf("splitAmounts: %v", err)
+			}
+			if money.Sum(got) != tt.expense.Amount {
+				t.Fatalf("parts %v add up to %s, want %s", got, money.Sum(got), tt.expense.Amount)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
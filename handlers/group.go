@@ -2,52 +2,155 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
 	"github.com/ashishsonamm/setu-splitwise/models"
-	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-func CreateGroup(w http.ResponseWriter, r *http.Request) {
+// GroupHandler serves groups and their membership.
+type GroupHandler struct {
+	users  repository.UserRepository
+	groups repository.GroupRepository
+}
+
+func NewGroupHandler(repos repository.Repositories) *GroupHandler {
+	return &GroupHandler{users: repos.Users, groups: repos.Groups}
+}
+
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var group models.Group
 	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
 		return
 	}
 
-	query := `INSERT INTO groups (name) VALUES ($1) RETURNING id`
-	err := utils.DB.QueryRow(query, group.Name).Scan(&group.ID)
+	currency, err := money.NormalizeCurrency(group.BaseCurrency)
 	if err != nil {
-		http.Error(w, "Failed to create group", http.StatusInternalServerError)
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+	group.BaseCurrency = currency
+
+	if err := h.groups.Create(r.Context(), &group, callerID); err != nil {
+		apierror.WriteInternal(w, err, "Failed to create group")
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Group created successfully", "group_id": group.ID})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Group created successfully", "group_id": group.ID, "base_currency": group.BaseCurrency})
+}
+
+func (h *GroupHandler) RenameGroup(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	var req models.RenameGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+
+	if _, ok := authorizeGroupAction(w, r, h.groups, groupID, callerID, models.ActionRenameGroup); !ok {
+		return
+	}
+
+	if err := h.groups.Rename(r.Context(), groupID, strings.TrimSpace(req.Name)); err != nil {
+		apierror.WriteInternal(w, err, "Failed to rename group")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Group renamed successfully"})
+}
+
+// ChangeGroupCurrency sets the currency a group's balances are reported in. Expenses and settlements
+// keep the currency they were recorded in, so this only changes what balances are converted to.
+func (h *GroupHandler) ChangeGroupCurrency(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	var req models.ChangeCurrencyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.BaseCurrency) == "" {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+	currency, err := money.NormalizeCurrency(req.BaseCurrency)
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	if _, ok := authorizeGroupAction(w, r, h.groups, groupID, callerID, models.ActionChangeCurrency); !ok {
+		return
+	}
+
+	if err := h.groups.SetBaseCurrency(r.Context(), groupID, currency); err != nil {
+		apierror.WriteInternal(w, err, "Failed to change group currency")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Group currency updated successfully", "base_currency": currency})
 }
 
-func AddUserToGroup(w http.ResponseWriter, r *http.Request) {
+func (h *GroupHandler) AddUserToGroup(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.AddOrRemoveUserToGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
 		return
 	}
 
-	var exists bool
-	err := utils.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM groups WHERE id = $1)", req.GroupID).Scan(&exists)
-	if err != nil || !exists {
-		http.Error(w, "Group not found", http.StatusNotFound)
+	if _, ok := authorizeGroupAction(w, r, h.groups, req.GroupID, callerID, models.ActionAddMember); !ok {
 		return
 	}
 
-	err = utils.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", req.UserID).Scan(&exists)
-	if err != nil || !exists {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if _, err := h.users.Get(r.Context(), req.UserID); errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch user")
 		return
 	}
 
-	_, err = utils.DB.Exec("INSERT INTO group_users (group_id, user_id) VALUES ($1, $2)", req.GroupID, req.UserID)
-	if err != nil {
-		http.Error(w, "Failed to add user to group", http.StatusInternalServerError)
+	err := h.groups.AddMember(r.Context(), req.GroupID, req.UserID, models.RoleMember)
+	if errors.Is(err, repository.ErrDuplicate) {
+		apierror.Write(w, apierror.Conflict, "User is already a member of this group")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to add user to group")
 		return
 	}
 
@@ -55,26 +158,196 @@ func AddUserToGroup(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "User added to group successfully"})
 }
 
-func RemoveUserFromGroup(w http.ResponseWriter, r *http.Request) {
+// RemoveUserFromGroup lets admins remove members ranked below them, and any non-owner leave the
+// group themselves. The owner has to transfer ownership before they can be removed.
+func (h *GroupHandler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.AddOrRemoveUserToGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
 		return
 	}
 
-	var exists bool
-	err := utils.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM group_users WHERE group_id = $1 AND user_id = $2)", req.GroupID, req.UserID).Scan(&exists)
-	if err != nil || !exists {
-		http.Error(w, "User not found in group", http.StatusNotFound)
+	callerRole, ok := requireGroupMember(w, r, h.groups, req.GroupID, callerID)
+	if !ok {
 		return
 	}
 
-	_, err = utils.DB.Exec("DELETE FROM group_users WHERE group_id = $1 AND user_id = $2", req.GroupID, req.UserID)
+	targetRole, member, err := h.groups.Role(r.Context(), req.GroupID, req.UserID)
 	if err != nil {
-		http.Error(w, "Failed to remove user from group", http.StatusInternalServerError)
+		apierror.WriteInternal(w, err, "Server error")
+		return
+	}
+	if !member {
+		apierror.Write(w, apierror.MemberNotFound, "User not found in group")
+		return
+	}
+
+	if targetRole == models.RoleOwner {
+		apierror.Write(w, apierror.Conflict, "The group owner cannot be removed; transfer ownership first")
+		return
+	}
+	if req.UserID != callerID {
+		if !callerRole.Can(models.ActionRemoveMember) || !callerRole.Outranks(targetRole) {
+			apierror.Write(w, apierror.Forbidden, "You do not have permission to remove this member")
+			return
+		}
+	}
+
+	if err := h.groups.RemoveMember(r.Context(), req.GroupID, req.UserID); err != nil {
+		apierror.WriteInternal(w, err, "Failed to remove user from group")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "User removed from group successfully"})
 }
+
+// ChangeMemberRole promotes a member to admin or demotes an admin to member. Ownership only moves
+// through TransferGroupOwnership.
+func (h *GroupHandler) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	userID, err2 := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil || err2 != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group or user ID")
+		return
+	}
+
+	var req models.ChangeRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Role != models.RoleAdmin && req.Role != models.RoleMember {
+		apierror.Write(w, apierror.InvalidRequest, "Role must be admin or member")
+		return
+	}
+
+	if _, ok := authorizeGroupAction(w, r, h.groups, groupID, callerID, models.ActionChangeRole); !ok {
+		return
+	}
+
+	targetRole, member, err := h.groups.Role(r.Context(), groupID, userID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return
+	}
+	if !member {
+		apierror.Write(w, apierror.MemberNotFound, "User not found in group")
+		return
+	}
+	if targetRole == models.RoleOwner {
+		apierror.Write(w, apierror.Conflict, "The owner's role cannot be changed; transfer ownership instead")
+		return
+	}
+
+	if err := h.groups.SetRole(r.Context(), groupID, userID, req.Role); err != nil {
+		apierror.WriteInternal(w, err, "Failed to change role")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Role updated successfully", "user_id": userID, "role": req.Role})
+}
+
+// TransferGroupOwnership hands the owner role to another member; the previous owner becomes an admin.
+func (h *GroupHandler) TransferGroupOwnership(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	var req models.TransferOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+
+	if _, ok := authorizeGroupAction(w, r, h.groups, groupID, callerID, models.ActionTransferOwnership); !ok {
+		return
+	}
+
+	if req.UserID == callerID {
+		apierror.Write(w, apierror.InvalidRequest, "You already own this group")
+		return
+	}
+	if !requireMembers(w, r, h.groups, groupID, []int{req.UserID}) {
+		return
+	}
+
+	if err := h.groups.TransferOwnership(r.Context(), groupID, callerID, req.UserID); err != nil {
+		apierror.WriteInternal(w, err, "Failed to transfer ownership")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Ownership transferred successfully", "owner_id": req.UserID})
+}
+
+// requireGroupMember writes a 404 or 403 and returns false unless userID belongs to the group.
+func requireGroupMember(w http.ResponseWriter, r *http.Request, groups repository.GroupRepository, groupID, userID int) (models.Role, bool) {
+	if _, err := groups.Get(r.Context(), groupID); errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.GroupNotFound, "Group not found")
+		return "", false
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return "", false
+	}
+
+	role, member, err := groups.Role(r.Context(), groupID, userID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return "", false
+	}
+	if !member {
+		apierror.Write(w, apierror.Forbidden, "You are not a member of this group")
+		return "", false
+	}
+	return role, true
+}
+
+// authorizeGroupAction is requireGroupMember plus a models.GroupPolicy check for the action.
+func authorizeGroupAction(w http.ResponseWriter, r *http.Request, groups repository.GroupRepository, groupID, userID int, action models.GroupAction) (models.Role, bool) {
+	role, ok := requireGroupMember(w, r, groups, groupID, userID)
+	if !ok {
+		return "", false
+	}
+	if !role.Can(action) {
+		apierror.Write(w, apierror.Forbidden, fmt.Sprintf("This action requires the %s role", models.GroupPolicy[action]))
+		return "", false
+	}
+	return role, true
+}
+
+// requireMembers writes a 422 listing the offenders and returns false if any of userIDs is not in the group.
+func requireMembers(w http.ResponseWriter, r *http.Request, groups repository.GroupRepository, groupID int, userIDs []int) bool {
+	missing, err := groups.NonMembers(r.Context(), groupID, userIDs)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return false
+	}
+	if len(missing) > 0 {
+		ids := make([]string, len(missing))
+		for i, id := range missing {
+			ids[i] = strconv.Itoa(id)
+		}
+		apierror.Write(w, apierror.NotGroupMembers, fmt.Sprintf("Users %s are not members of this group", strings.Join(ids, ", ")))
+		return false
+	}
+	return true
+}
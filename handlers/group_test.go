@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashishsonamm/setu-splitwise/middleware"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/repository/memory"
+)
+
+// failingUsers is a user store whose lookups fail with err.
+type failingUsers struct {
+	repository.UserRepository
+	err error
+}
+
+func (u failingUsers) Get(ctx context.Context, id int) (*models.User, error) {
+	return nil, u.err
+}
+
+func TestAddUserToGroupLookupErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "missing user", err: repository.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: "user_not_found"},
+		{name: "storage failure", err: errors.New("connection reset"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := memory.New()
+			owner := &models.User{Name: "Owner", Email: "owner@example.com", TimeZone: "UTC"}
+			if err := repos.Users.Create(ctx, owner); err != nil {
+				t.Fatal(err)
+			}
+			group := &models.Group{Name: "Trip", BaseCurrency: "INR"}
+			if err := repos.Groups.Create(ctx, group, owner.ID); err != nil {
+				t.Fatal(err)
+			}
+			repos.Users = failingUsers{UserRepository: repos.Users, err: tt.err}
+
+			body := strings.NewReader(fmt.Sprintf(`{"groupId": %d, "userId": 42}`, group.ID))
+			req := httptest.NewRequest("POST", "/api/group/addUser", body)
+			req = req.WithContext(middleware.WithUserID(req.Context(), owner.ID))
+			rec := httptest.NewRecorder()
+			NewGroupHandler(repos).AddUserToGroup(rec, req)
+
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), `"`+tt.wantCode+`"`) {
+				t.Fatalf("got %d %s, want %d %s", rec.Code, rec.Body, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
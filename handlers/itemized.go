@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/validation"
+)
+
+// LineItem is one line of an itemized receipt, shared equally by the users it is assigned to.
+type LineItem = models.LineItem
+
+// ItemizedShare is how one contributor's part of an itemized expense is made up.
+type ItemizedShare struct {
+	Items    money.Amount `json:"items"`
+	Tax      money.Amount `json:"tax"`
+	Tip      money.Amount `json:"tip"`
+	Discount money.Amount `json:"discount"`
+}
+
+// Owed is what the contributor owes in all.
+func (s ItemizedShare) Owed() money.Amount {
+	return s.Items + s.Tax + s.Tip - s.Discount
+}
+
+func itemsSubtotal(items []LineItem) money.Amount {
+	var subtotal money.Amount
+	for _, item := range items {
+		subtotal += item.Amount
+	}
+	return subtotal
+}
+
+// validateItemized checks the receipt of an itemized expense: every item has an amount and assignees
+// from among the contributors, and the items plus tax and tip, less the discount, come to the amount.
+func validateItemized(expense Expense, errs *validation.Errors) {
+	if len(expense.Items) == 0 {
+		errs.Add("items", "must list at least one item for an %s split", SplitItemized)
+		return
+	}
+
+	valid := true
+	for i, item := range expense.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		if item.Amount <= 0 {
+			errs.Add(field+".amount", "must be greater than zero")
+			valid = false
+		}
+		if len(item.AssignedTo) == 0 {
+			errs.Add(field+".assigned_to", "must name at least one user")
+		}
+		seen := make(map[int]bool, len(item.AssignedTo))
+		for _, userID := range item.AssignedTo {
+			if seen[userID] {
+				errs.Add(field+".assigned_to", "user %d is listed more than once", userID)
+			} else if !hasContributor(expense.Contributors, userID) {
+				errs.Add(field+".assigned_to", "user %d is not a contributor", userID)
+			}
+			seen[userID] = true
+		}
+	}
+
+	for _, f := range []struct {
+		name   string
+		amount money.Amount
+	}{{"tax", expense.Tax}, {"tip", expense.Tip}, {"discount", expense.Discount}} {
+		if f.amount < 0 {
+			errs.Add(f.name, "must not be negative")
+			valid = false
+		}
+	}
+	if !valid {
+		return
+	}
+
+	subtotal := itemsSubtotal(expense.Items)
+	if expense.Discount > subtotal {
+		errs.Add("discount", "must not exceed the items subtotal of %s", subtotal)
+	} else if total := subtotal + expense.Tax + expense.Tip - expense.Discount; expense.Amount > 0 && total != expense.Amount {
+		errs.Add("items", "items %s plus tax and tip less discount come to %s but the expense amount is %s", subtotal, total, expense.Amount)
+	}
+}
+
+// itemizedShares works out each contributor's part of an itemized expense: their items, split equally
+// between assignees, plus tax and tip less discount in proportion to those items.
+func itemizedShares(expense Expense) (map[int]ItemizedShare, error) {
+	if len(expense.Items) == 0 {
+		return nil, errors.New("an itemized split needs at least one item")
+	}
+
+	shares := make(map[int]ItemizedShare, len(expense.Contributors))
+	for _, c := range expense.Contributors {
+		shares[c.UserID] = ItemizedShare{}
+	}
+	for _, item := range expense.Items {
+		parts, err := money.Equal(item.Amount, len(item.AssignedTo))
+		if err != nil {
+			return nil, err
+		}
+		for i, userID := range item.AssignedTo {
+			share, ok := shares[userID]
+			if !ok {
+				return nil, fmt.Errorf("item assignee %d is not a contributor", userID)
+			}
+			share.Items += parts[i]
+			shares[userID] = share
+		}
+	}
+
+	weights := make([]int64, len(expense.Contributors))
+	for i, c := range expense.Contributors {
+		weights[i] = int64(shares[c.UserID].Items)
+	}
+	for _, extra := range []struct {
+		amount money.Amount
+		set    func(*ItemizedShare, money.Amount)
+	}{
+		{expense.Tax, func(s *ItemizedShare, a money.Amount) { s.Tax = a }},
+		{expense.Tip, func(s *ItemizedShare, a money.Amount) { s.Tip = a }},
+		{expense.Discount, func(s *ItemizedShare, a money.Amount) { s.Discount = a }},
+	} {
+		if extra.amount == 0 {
+			continue
+		}
+		parts, err := money.Allocate(extra.amount, weights)
+		if err != nil {
+			return nil, err
+		}
+		for i, c := range expense.Contributors {
+			share := shares[c.UserID]
+			extra.set(&share, parts[i])
+			shares[c.UserID] = share
+		}
+	}
+	return shares, nil
+}
+
+// itemizedAmounts is splitAmounts for the itemized split type.
+func itemizedAmounts(expense Expense) ([]money.Amount, error) {
+	if expense.Discount > itemsSubtotal(expense.Items) {
+		return nil, errors.New("discount must not exceed the items subtotal")
+	}
+	if itemsSubtotal(expense.Items)+expense.Tax+expense.Tip-expense.Discount != expense.Amount {
+		return nil, errors.New("items plus tax and tip less discount must add up to the expense amount")
+	}
+
+	shares, err := itemizedShares(expense)
+	if err != nil {
+		return nil, err
+	}
+	amounts := make([]money.Amount, len(expense.Contributors))
+	for i, c := range expense.Contributors {
+		amounts[i] = shares[c.UserID].Owed()
+	}
+	return amounts, nil
+}
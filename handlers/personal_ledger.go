@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"sort"
+	"time"
+)
+
+// personalCurrency is the currency personal balances are kept in.
+const personalCurrency = money.DefaultCurrency
+
+// LedgerEntry is one line of the personal ledger between two users. Amount is from the point of
+// view of the ledger's owner: positive means the other user now owes them more.
+type LedgerEntry struct {
+	Type        string           `json:"type"` // "expense" or "settlement"
+	ID          int              `json:"id"`
+	Description string           `json:"description,omitempty"`
+	Amount      money.Amount     `json:"amount"`                 // in personalCurrency
+	Original    *money.Money     `json:"original,omitempty"`     // the amount as recorded, when in another currency
+	ExpenseDate *recurrence.Date `json:"expense_date,omitempty"` // expenses
+	CreatedAt   *time.Time       `json:"created_at,omitempty"`   // settlements
+}
+
+// personalLedger nets the live personal expenses and settlements between userID and each other user,
+// in personalCurrency and positive when they owe userID, with the entries behind each balance. Within
+// an expense, debts are split with pairwiseDebts.
+func (l ledger) personalLedger(ctx context.Context, userID int) (map[int]money.Amount, map[int][]LedgerEntry, error) {
+	expenses, err := l.expenses.PersonalShares(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	balances := make(map[int]money.Amount)
+	entries := make(map[int][]LedgerEntry)
+	for _, e := range expenses {
+		shares := make([]userBalance, len(e.Shares))
+		for i, share := range e.Shares {
+			shares[i] = userBalance{userID: share.UserID, balance: share.Paid - share.Owed}
+		}
+		for _, d := range pairwiseDebts(shares) {
+			var otherID int
+			var amount money.Amount
+			switch userID {
+			case d.creditorID:
+				otherID, amount = d.debtorID, d.amount
+			case d.debtorID:
+				otherID, amount = d.creditorID, -d.amount
+			default:
+				continue
+			}
+			date := e.Date
+			entry := LedgerEntry{Type: "expense", ID: e.ID, Description: e.Description, ExpenseDate: &date}
+			if err := entry.setAmount(l.rates, amount, e.Currency, e.Date.Time, e.ExchangeRate); err != nil {
+				return nil, nil, err
+			}
+			balances[otherID] += entry.Amount
+			entries[otherID] = append(entries[otherID], entry)
+		}
+	}
+
+	settlements, err := l.settlements.List(ctx, repository.SettlementFilter{Type: "personal", UserID: &userID, Status: models.SettlementConfirmed})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Settlements come newest first; the ledger lists them in the order they were made.
+	for i := len(settlements) - 1; i >= 0; i-- {
+		s := settlements[i]
+
+		// A payment to userID reduces what the payer owes them; a payment by userID reduces what they owe.
+		otherID, effect := s.DebtorID, -s.Amount
+		if s.DebtorID == userID {
+			otherID, effect = s.CreditorID, s.Amount
+		}
+		createdAt := s.CreatedAt
+		entry := LedgerEntry{Type: "settlement", ID: s.ID, CreatedAt: &createdAt}
+		if err := entry.setAmount(l.rates, effect, s.Currency, createdAt, s.ExchangeRate); err != nil {
+			return nil, nil, err
+		}
+		balances[otherID] += entry.Amount
+		entries[otherID] = append(entries[otherID], entry)
+	}
+
+	return balances, entries, nil
+}
+
+// setAmount records amount, in currency, converted to personalCurrency at the snapshotted rate or p's
+// rate for date.
+func (e *LedgerEntry) setAmount(p rates.ExchangeRateProvider, amount money.Amount, currency string, date time.Time, snapshot *rates.Snapshot) error {
+	converted, err := rates.Convert(p, amount, currency, personalCurrency, date, snapshot)
+	if err != nil {
+		return err
+	}
+	e.Amount = converted
+	if currency != personalCurrency {
+		e.Original = &money.Money{Amount: amount, Currency: currency}
+	}
+	return nil
+}
+
+type userBalance struct {
+	userID  int
+	balance money.Amount
+}
+
+type pairDebt struct {
+	debtorID   int
+	creditorID int
+	amount     money.Amount
+}
+
+// pairwiseDebts breaks one expense's net balances into who owes whom, allocating each debtor's
+// shortfall across the creditors in proportion to what they are owed.
+func pairwiseDebts(balances []userBalance) []pairDebt {
+	var creditors []userBalance
+	for _, b := range balances {
+		if b.balance > 0 {
+			creditors = append(creditors, b)
+		}
+	}
+	if len(creditors) == 0 {
+		return nil
+	}
+	sort.Slice(creditors, func(i, j int) bool { return creditors[i].userID < creditors[j].userID })
+
+	creditWeights := make([]int64, len(creditors))
+	for i, c := range creditors {
+		creditWeights[i] = int64(c.balance)
+	}
+
+	var debts []pairDebt
+	for _, b := range balances {
+		if b.balance >= 0 {
+			continue
+		}
+		parts, err := money.Allocate(-b.balance, creditWeights)
+		if err != nil {
+			continue
+		}
+		for i, part := range parts {
+			if part > 0 {
+				debts = append(debts, pairDebt{debtorID: b.userID, creditorID: creditors[i].userID, amount: part})
+			}
+		}
+	}
+	return debts
+}
+
+// personalOutstanding is how much debtor owes creditor on the personal ledger between the two, in
+// personalCurrency.
+func (l ledger) personalOutstanding(ctx context.Context, debtorID, creditorID int) (money.Amount, error) {
+	balances, _, err := l.personalLedger(ctx, creditorID)
+	if err != nil {
+		return 0, err
+	}
+	if balances[debtorID] < 0 {
+		return 0, nil
+	}
+	return balances[debtorID], nil
+}
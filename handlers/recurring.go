@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The recurring expense types live in models so the repositories can store them.
+type (
+	RecurringExpense    = models.RecurringExpense
+	RecurringOccurrence = models.RecurringOccurrence
+)
+
+// RecurringHandler serves recurring expense templates. The expenses they create go through the
+// expense repository like any other.
+type RecurringHandler struct {
+	expenseStore
+	recurring repository.RecurringRepository
+}
+
+func NewRecurringHandler(repos repository.Repositories) *RecurringHandler {
+	return &RecurringHandler{expenseStore: newExpenseStore(repos), recurring: repos.Recurring}
+}
+
+// CreateRecurringExpense stores a template and creates any occurrences already due, so a schedule
+// starting today produces today's expense straight away.
+func (h *RecurringHandler) CreateRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var rec RecurringExpense
+	if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request payload")
+		return
+	}
+
+	if rec.Expense.CreatedBy != 0 && rec.Expense.CreatedBy != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot create an expense on behalf of another user")
+		return
+	}
+	rec.Expense.CreatedBy = callerID
+
+	if !h.prepareRecurring(w, r, &rec, callerID) {
+		return
+	}
+	next, ok := rec.Schedule.Next(rec.Start)
+	if !ok {
+		apierror.Write(w, apierror.ValidationFailed, "The schedule has no occurrences")
+		return
+	}
+	rec.NextOccurrence = &next
+	rec.Paused = false
+	rec.Occurrences = nil
+
+	if err := h.recurring.Create(r.Context(), &rec); err != nil {
+		apierror.WriteInternal(w, err, "Failed to create recurring expense")
+		return
+	}
+
+	h.writeRecurringAfterRun(w, r, rec.ID, http.StatusCreated)
+}
+
+// ListRecurringExpenses returns the templates the caller can see: those they created, those of their
+// groups, and personal ones they contribute to. ?group_id= narrows the list to one group.
+func (h *RecurringHandler) ListRecurringExpenses(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	filter := repository.RecurringFilter{VisibleTo: callerID}
+	if groupIDStr := r.URL.Query().Get("group_id"); groupIDStr != "" {
+		groupID, err := strconv.Atoi(groupIDStr)
+		if err != nil {
+			apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+			return
+		}
+		filter.GroupID = &groupID
+	}
+
+	list, err := h.recurring.List(r.Context(), filter)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch recurring expenses")
+		return
+	}
+	if list == nil {
+		list = []RecurringExpense{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetRecurringExpense returns one template with every occurrence handled so far, newest first.
+func (h *RecurringHandler) GetRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := recurringID(w, r)
+	if !ok {
+		return
+	}
+
+	rec, err := h.recurring.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.RecurringExpenseNotFound, "Recurring expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch recurring expense")
+		return
+	}
+	if !h.canViewExpense(w, r, &rec.Expense, callerID) {
+		return
+	}
+	h.writeRecurring(w, r, id, http.StatusOK)
+}
+
+// UpdateRecurringExpense replaces the template and schedule for every occurrence not handled yet.
+// Expenses already created are left alone; edit those through PUT /api/expense/{id}.
+func (h *RecurringHandler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := recurringID(w, r)
+	if !ok {
+		return
+	}
+
+	var update RecurringExpense
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request payload")
+		return
+	}
+
+	existing, ok := h.loadRecurringForChange(w, r, id, callerID)
+	if !ok {
+		return
+	}
+	update.Expense.CreatedBy = existing.Expense.CreatedBy
+	update.Expense.GroupID = existing.Expense.GroupID
+	if !h.prepareRecurring(w, r, &update, callerID) {
+		return
+	}
+
+	err := h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		current, err := h.recurring.Lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		from, err := h.resumeFrom(ctx, current)
+		if err != nil {
+			return err
+		}
+		current.Expense = update.Expense
+		current.Schedule = update.Schedule
+		current.NextOccurrence = nil
+		if day, ok := update.Schedule.Next(from); ok {
+			current.NextOccurrence = &day
+		}
+		return h.recurring.Update(ctx, current)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.RecurringExpenseNotFound, "Recurring expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to update recurring expense")
+		return
+	}
+
+	h.writeRecurringAfterRun(w, r, id, http.StatusOK)
+}
+
+// PauseRecurringExpense stops new occurrences until the template is resumed.
+func (h *RecurringHandler) PauseRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	h.setRecurringPaused(w, r, true)
+}
+
+// ResumeRecurringExpense restarts a paused template from today. Occurrences that fell due while it
+// was paused are not created.
+func (h *RecurringHandler) ResumeRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	h.setRecurringPaused(w, r, false)
+}
+
+func (h *RecurringHandler) setRecurringPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := recurringID(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.loadRecurringForChange(w, r, id, callerID); !ok {
+		return
+	}
+
+	err := h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		current, err := h.recurring.Lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		if current.Paused == paused {
+			return nil
+		}
+		current.Paused = paused
+		if paused {
+			return h.recurring.Update(ctx, current)
+		}
+
+		from, err := h.resumeFrom(ctx, current)
+		if err != nil {
+			return err
+		}
+		today, err := h.recurringToday(ctx, current, time.Now())
+		if err != nil {
+			return err
+		}
+		if from.Before(today.Time) {
+			from = today
+		}
+		current.NextOccurrence = nil
+		if day, ok := current.Schedule.Next(from); ok {
+			current.NextOccurrence = &day
+		}
+		return h.recurring.Update(ctx, current)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.RecurringExpenseNotFound, "Recurring expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to update recurring expense")
+		return
+	}
+
+	h.writeRecurringAfterRun(w, r, id, http.StatusOK)
+}
+
+// SkipRecurringOccurrence marks one occurrence, the next one by default, so that no expense is
+// created for it. The rest of the schedule carries on as before.
+func (h *RecurringHandler) SkipRecurringOccurrence(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := recurringID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SkipOccurrenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+	if _, ok := h.loadRecurringForChange(w, r, id, callerID); !ok {
+		return
+	}
+
+	var skipped recurrence.Date
+	var problem string
+	err := h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		current, err := h.recurring.Lock(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case req.Date != nil:
+			skipped = *req.Date
+		case current.NextOccurrence != nil:
+			skipped = *current.NextOccurrence
+		default:
+			problem = "The schedule has no further occurrences"
+			return nil
+		}
+		if !current.Schedule.Occurs(skipped) {
+			problem = "The schedule has no occurrence on " + skipped.String()
+			return nil
+		}
+
+		err = h.recurring.AddOccurrence(ctx, id, RecurringOccurrence{Date: skipped, Status: models.OccurrenceSkipped})
+		if errors.Is(err, repository.ErrDuplicate) {
+			problem = "The occurrence on " + skipped.String() + " has already been handled"
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if current.NextOccurrence != nil && current.NextOccurrence.Equal(skipped.Time) {
+			current.NextOccurrence = nil
+			if day, ok := current.Schedule.Next(skipped.AddDays(1)); ok {
+				current.NextOccurrence = &day
+			}
+			return h.recurring.Update(ctx, current)
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.RecurringExpenseNotFound, "Recurring expense not found")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to skip occurrence")
+		return
+	}
+	if problem != "" {
+		apierror.Write(w, apierror.Conflict, problem)
+		return
+	}
+
+	h.writeRecurring(w, r, id, http.StatusOK)
+}
+
+// prepareRecurring validates and normalises the schedule and the expense template, writing the error
+// response and returning false on failure.
+func (s expenseStore) prepareRecurring(w http.ResponseWriter, r *http.Request, rec *RecurringExpense, callerID int) bool {
+	if err := rec.Schedule.Validate(); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return false
+	}
+
+	// Only the bill itself is kept; everything else is filled in per occurrence.
+	rec.Expense.ID = 0
+	rec.Expense.AmountsOwed = nil
+	rec.Expense.CreatedAt, rec.Expense.UpdatedAt = nil, nil
+	rec.Expense.ExpenseDate = nil
+	rec.Expense.ExchangeRate = nil
+	rec.Expense.ExpenseType = "personal"
+	if rec.Expense.GroupID != nil {
+		rec.Expense.ExpenseType = "group"
+	}
+
+	// Each occurrence is dated the day it falls on, in the template's time zone if it names one and
+	// otherwise in the payer's at the time.
+	timeZone := rec.Expense.TimeZone
+	ok := s.prepareExpense(w, r, &rec.Expense, nil, callerID)
+	if ok && timeZone == "" {
+		rec.Expense.TimeZone = ""
+	}
+	rec.Expense.ExpenseDate = nil
+	rec.Expense.AmountsOwed = nil
+	return ok
+}
+
+// loadRecurringForChange fetches a template the caller may change, by the same rules as an expense.
+func (h *RecurringHandler) loadRecurringForChange(w http.ResponseWriter, r *http.Request, id, callerID int) (*RecurringExpense, bool) {
+	rec, err := h.recurring.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, apierror.RecurringExpenseNotFound, "Recurring expense not found")
+		return nil, false
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch recurring expense")
+		return nil, false
+	}
+
+	if rec.Expense.CreatedBy == callerID {
+		return rec, true
+	}
+	if rec.Expense.GroupID == nil {
+		apierror.Write(w, apierror.Forbidden, "Only the creator can change a personal recurring expense")
+		return nil, false
+	}
+	if _, ok := authorizeGroupAction(w, r, h.groups, *rec.Expense.GroupID, callerID, models.ActionEditExpense); !ok {
+		return nil, false
+	}
+	return rec, true
+}
+
+// resumeFrom is the first date a template's schedule should be picked up from: its next occurrence,
+// or the day after the last one created if the schedule had ended.
+func (h *RecurringHandler) resumeFrom(ctx context.Context, rec *RecurringExpense) (recurrence.Date, error) {
+	if rec.NextOccurrence != nil {
+		return *rec.NextOccurrence, nil
+	}
+	last, err := h.recurring.LastOccurrence(ctx, rec.ID)
+	if err != nil {
+		return recurrence.Date{}, err
+	}
+	if last != nil {
+		return last.AddDays(1), nil
+	}
+	return rec.Start, nil
+}
+
+// writeRecurringAfterRun creates whatever the change made due, leaving failures to the scheduler, and
+// then writes the template.
+func (h *RecurringHandler) writeRecurringAfterRun(w http.ResponseWriter, r *http.Request, id, status int) {
+	if _, err := h.materializeRecurring(r.Context(), id, time.Now()); err != nil {
+		log.Printf("recurring expense %d: %v", id, err)
+	}
+	h.writeRecurring(w, r, id, status)
+}
+
+func (h *RecurringHandler) writeRecurring(w http.ResponseWriter, r *http.Request, id, status int) {
+	rec, err := h.recurring.Get(r.Context(), id)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch recurring expense")
+		return
+	}
+	if rec.Occurrences, err = h.recurring.Occurrences(r.Context(), id); err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch recurring expense")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rec)
+}
+
+func recurringID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid recurring expense ID")
+		return 0, false
+	}
+	return id, true
+}
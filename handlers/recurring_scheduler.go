@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"log"
+	"time"
+)
+
+// maxCatchUp bounds how many occurrences one template materializes per run; later runs do the rest.
+const maxCatchUp = 100
+
+// firstZone is the time zone each day starts in first.
+var firstZone = time.FixedZone("UTC+14", 14*60*60)
+
+// RunRecurringScheduler materializes due recurring expenses straight away and then every interval,
+// until ctx is cancelled. Several instances can share one store: templates are claimed with TryLock
+// and each date is created at most once.
+func RunRecurringScheduler(ctx context.Context, repos repository.Repositories, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := MaterializeRecurringExpenses(ctx, repos, time.Now())
+		if err != nil {
+			log.Printf("Error materializing recurring expenses: %v", err)
+		} else if n > 0 {
+			log.Printf("Created %d recurring expenses", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaterializeRecurringExpenses creates the expenses of every unpaused template due by now, each going
+// by the date in its own time zone, and returns how many it created. A template that fails is retried
+// on the next run; the others still go ahead.
+func MaterializeRecurringExpenses(ctx context.Context, repos repository.Repositories, now time.Time) (int, error) {
+	ids, err := repos.Recurring.Due(ctx, recurrence.Day(now.In(firstZone)))
+	if err != nil {
+		return 0, err
+	}
+
+	h := NewRecurringHandler(repos)
+	created := 0
+	var errs []error
+	for _, id := range ids {
+		n, err := h.materializeRecurring(ctx, id, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recurring expense %d: %w", id, err))
+			continue
+		}
+		created += n
+	}
+	return created, errors.Join(errs...)
+}
+
+// materializeRecurring handles one template's dates up to today where it is, in a single transaction,
+// advancing its next occurrence past them.
+func (h *RecurringHandler) materializeRecurring(ctx context.Context, id int, now time.Time) (int, error) {
+	created := 0
+	err := h.tx.WithinTx(ctx, func(ctx context.Context) error {
+		created = 0
+		rec, err := h.recurring.TryLock(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil // deleted, or another run holds it
+		} else if err != nil {
+			return err
+		}
+		if rec.Paused || rec.NextOccurrence == nil {
+			return nil
+		}
+		today, err := h.recurringToday(ctx, rec, now)
+		if err != nil {
+			return err
+		}
+
+		next := rec.NextOccurrence
+		for i := 0; next != nil && !next.After(today.Time) && i < maxCatchUp; i++ {
+			ok, err := h.materializeOccurrence(ctx, rec, *next)
+			if err != nil {
+				return err
+			}
+			if ok {
+				created++
+			}
+
+			next = nil
+			if day, ok := rec.Schedule.Next(rec.NextOccurrence.AddDays(1)); ok {
+				next = &day
+			}
+			rec.NextOccurrence = next
+		}
+
+		return h.recurring.SetNextOccurrence(ctx, id, next)
+	})
+	return created, err
+}
+
+// recurringToday is the date now falls on where the template's expenses are dated: in its time zone,
+// or its payer's if it names none.
+func (h *RecurringHandler) recurringToday(ctx context.Context, rec *RecurringExpense, now time.Time) (recurrence.Date, error) {
+	var loc *time.Location
+	var err error
+	if rec.Expense.TimeZone != "" {
+		loc, err = time.LoadLocation(rec.Expense.TimeZone)
+	} else {
+		loc, err = userLocation(ctx, h.users, payerID(rec.Expense.Contributors))
+	}
+	if err != nil {
+		return recurrence.Date{}, err
+	}
+	return recurrence.Day(now.In(loc)), nil
+}
+
+// materializeOccurrence creates the expense for a date not handled yet, recording the occurrence as
+// failed if the expense no longer passes validation.
+func (h *RecurringHandler) materializeOccurrence(ctx context.Context, rec *RecurringExpense, date recurrence.Date) (bool, error) {
+	occurrence := RecurringOccurrence{Date: date, Status: models.OccurrenceCreated}
+	err := h.recurring.AddOccurrence(ctx, rec.ID, occurrence)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	expense := rec.Expense
+	expense.ExpenseDate = &date
+	problem, err := h.checkOccurrence(ctx, &expense)
+	if err != nil {
+		return false, err
+	}
+	if problem != nil {
+		reason := problem.Error()
+		occurrence.Status, occurrence.Error = models.OccurrenceFailed, &reason
+		return false, h.recurring.UpdateOccurrence(ctx, rec.ID, occurrence)
+	}
+
+	if err := h.snapshotRate(ctx, &expense, date.Time); err != nil {
+		return false, err
+	}
+	if err := h.expenses.Create(ctx, &expense); err != nil {
+		return false, err
+	}
+	occurrence.ExpenseID = &expense.ID
+	err = h.recurring.UpdateOccurrence(ctx, rec.ID, occurrence)
+	return err == nil, err
+}
+
+// checkOccurrence repeats prepareExpense's checks for an expense created without a request, filling in
+// its split; problem says why it cannot be created.
+func (s expenseStore) checkOccurrence(ctx context.Context, expense *Expense) (problem, err error) {
+	if errs := validateExpense(*expense); len(errs) > 0 {
+		return errs, nil
+	}
+	if errs, err := s.resolveCategory(ctx, expense); err != nil {
+		return nil, err
+	} else if len(errs) > 0 {
+		return errs, nil
+	}
+	if _, errs, err := s.fillTimeZone(ctx, expense); err != nil {
+		return nil, err
+	} else if len(errs) > 0 {
+		return errs, nil
+	}
+
+	if expense.GroupID != nil {
+		_, member, err := s.groups.Role(ctx, *expense.GroupID, expense.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		if !member {
+			return fmt.Errorf("user %d is no longer a member of the group", expense.CreatedBy), nil
+		}
+
+		userIDs := make([]int, len(expense.Contributors))
+		for i, c := range expense.Contributors {
+			userIDs[i] = c.UserID
+		}
+		missing, err := s.groups.NonMembers(ctx, *expense.GroupID, userIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("users %v are not members of the group", missing), nil
+		}
+	}
+
+	return fillAmountsOwed(expense), nil
+}
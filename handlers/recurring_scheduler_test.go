@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository/memory"
+)
+
+func TestMaterializeRecurringExpensesUsesTemplateZone(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	var users [2]models.User
+	for i, name := range []string{"alice", "bob"} {
+		users[i] = models.User{Name: name, Email: name + "@example.com", TimeZone: "UTC"}
+		if err := repos.Users.Create(ctx, &users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := recurrence.Date{Time: time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC)}
+	templates := map[string]int{}
+	for _, zone := range []string{"Pacific/Kiritimati", "Pacific/Pago_Pago"} {
+		rec := &models.RecurringExpense{
+			Expense: models.Expense{
+				Description: "Rent",
+				Amount:      1000,
+				SplitType:   "equal",
+				ExpenseType: "personal",
+				CreatedBy:   users[0].ID,
+				Contributors: []models.Contributor{
+					{UserID: users[0].ID, PaidAmount: 1000},
+					{UserID: users[1].ID},
+				},
+				TimeZone: zone,
+			},
+			Schedule:       recurrence.Schedule{Frequency: recurrence.Daily, Every: 1, Start: start},
+			NextOccurrence: &start,
+		}
+		if err := repos.Recurring.Create(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		templates[zone] = rec.ID
+	}
+
+	// Noon UTC on the 30th is already the 31st in Kiritimati (UTC+14) but still the 30th in Pago Pago (UTC-11).
+	now := time.Date(2024, time.March, 30, 12, 0, 0, 0, time.UTC)
+	created, err := MaterializeRecurringExpenses(ctx, repos, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 {
+		t.Fatalf("created %d expenses, want 1", created)
+	}
+
+	for zone, wantNext := range map[string]string{"Pacific/Kiritimati": "2024-04-01", "Pacific/Pago_Pago": "2024-03-31"} {
+		rec, err := repos.Recurring.Get(ctx, templates[zone])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.NextOccurrence == nil || rec.NextOccurrence.String() != wantNext {
+			t.Errorf("%s: next occurrence %v, want %s", zone, rec.NextOccurrence, wantNext)
+		}
+	}
+}
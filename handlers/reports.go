@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// monthLayout is how report months are written, in requests and responses.
+const monthLayout = "2006-01"
+
+type CategoryReport struct {
+	GroupID  int           `json:"group_id"`
+	Currency string        `json:"currency"` // every amount is in the group's base currency
+	Months   []MonthReport `json:"months"`
+}
+
+type MonthReport struct {
+	Month      string          `json:"month"`
+	Categories []CategorySpend `json:"categories"`
+}
+
+// CategorySpend is what a category cost in one month, in total and per user.
+type CategorySpend struct {
+	CategoryID *int         `json:"category_id"` // nil for uncategorized expenses
+	Category   string       `json:"category"`
+	Total      money.Amount `json:"total"`
+	Users      []UserSpend  `json:"users"`
+}
+
+type UserSpend struct {
+	UserID int          `json:"user_id"`
+	Amount money.Amount `json:"amount"`
+}
+
+// categoryEntry is one expense's shares, in the currency it was recorded in.
+type categoryEntry struct {
+	balanceEntry
+	month      string
+	categoryID *int
+	category   string
+}
+
+// ReportHandler serves spending reports.
+type ReportHandler struct {
+	groups   repository.GroupRepository
+	expenses repository.ExpenseRepository
+	rates    rates.ExchangeRateProvider
+}
+
+func NewReportHandler(repos repository.Repositories) *ReportHandler {
+	return &ReportHandler{groups: repos.Groups, expenses: repos.Expenses, rates: repos.ExchangeRates}
+}
+
+// GetCategoryReport reports what each member spent per category per month: their share of each
+// expense, whoever paid for it, converted to the group's base currency. ?from= and ?to= (YYYY-MM,
+// both inclusive) limit the months covered. An expense counts in the month of its expense date, the
+// day it happened in the time zone it was paid in, so late-evening expenses do not slip into the
+// next month for members elsewhere.
+func (h *ReportHandler) GetCategoryReport(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	var from, to *time.Time
+	for _, p := range []struct {
+		name   string
+		bound  **time.Time
+		months int
+	}{{"from", &from, 0}, {"to", &to, 1}} {
+		value := r.URL.Query().Get(p.name)
+		if value == "" {
+			continue
+		}
+		month, err := time.Parse(monthLayout, value)
+		if err != nil {
+			apierror.Write(w, apierror.InvalidRequest, "Invalid "+p.name+" month: use YYYY-MM")
+			return
+		}
+		month = month.AddDate(0, p.months, 0)
+		*p.bound = &month
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		apierror.Write(w, apierror.InvalidRequest, "from must not be after to")
+		return
+	}
+
+	group, err := h.groups.Get(r.Context(), groupID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch group")
+		return
+	}
+	base := group.BaseCurrency
+	entries, err := h.categoryEntries(r.Context(), groupID, from, to)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to build report")
+		return
+	}
+
+	type key struct {
+		month    string
+		category int // 0 for uncategorized
+	}
+	spends := map[key]*CategorySpend{}
+	byUser := map[key]map[int]money.Amount{}
+	for _, entry := range entries {
+		shares, err := convertBalances(h.rates, entry.balanceEntry, base)
+		if writeConversionError(w, err, "Failed to build report") {
+			return
+		}
+
+		k := key{month: entry.month}
+		if entry.categoryID != nil {
+			k.category = *entry.categoryID
+		}
+		if spends[k] == nil {
+			spends[k] = &CategorySpend{CategoryID: entry.categoryID, Category: entry.category}
+			byUser[k] = map[int]money.Amount{}
+		}
+		for _, share := range shares {
+			spends[k].Total += share.balance
+			byUser[k][share.userID] += share.balance
+		}
+	}
+
+	report := CategoryReport{GroupID: groupID, Currency: base, Months: []MonthReport{}}
+	keys := make([]key, 0, len(spends))
+	for k := range spends {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].month != keys[j].month {
+			return keys[i].month < keys[j].month
+		}
+		return spends[keys[i]].Category < spends[keys[j]].Category
+	})
+	for _, k := range keys {
+		if len(report.Months) == 0 || report.Months[len(report.Months)-1].Month != k.month {
+			report.Months = append(report.Months, MonthReport{Month: k.month})
+		}
+		spend := spends[k]
+		for userID, amount := range byUser[k] {
+			spend.Users = append(spend.Users, UserSpend{UserID: userID, Amount: amount})
+		}
+		sort.Slice(spend.Users, func(i, j int) bool { return spend.Users[i].UserID < spend.Users[j].UserID })
+
+		month := &report.Months[len(report.Months)-1]
+		month.Categories = append(month.Categories, *spend)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// categoryEntries reads every live expense of the group dated in [from, to), with each contributor's
+// share as a positive balance.
+func (h *ReportHandler) categoryEntries(ctx context.Context, groupID int, from, to *time.Time) ([]categoryEntry, error) {
+	expenses, err := h.expenses.GroupShares(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []categoryEntry
+	for _, e := range expenses {
+		if (from != nil && e.Date.Before(*from)) || (to != nil && !e.Date.Before(*to)) {
+			continue
+		}
+		entry := categoryEntry{
+			balanceEntry: balanceEntry{currency: e.Currency, date: e.Date.Time, snapshot: e.ExchangeRate},
+			month:        e.Date.Format(monthLayout),
+			categoryID:   e.CategoryID,
+			category:     e.Category,
+		}
+		if e.CategoryID == nil {
+			entry.category = "Uncategorized"
+		}
+		for _, share := range e.Shares {
+			entry.balances = append(entry.balances, userBalance{userID: share.UserID, balance: share.Owed})
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository/memory"
+	"github.com/gorilla/mux"
+)
+
+func TestCategoryReportMonthsFollowExpenseDates(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	user := &models.User{Name: "Alice", Email: "alice@example.com", TimeZone: "Asia/Kolkata"}
+	if err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Group{Name: "Trip", BaseCurrency: "INR"}
+	if err := repos.Groups.Create(ctx, group, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each is dated where it was paid, far from UTC, on the edge of a month.
+	for _, e := range []struct {
+		date time.Time
+		zone string
+	}{
+		{time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC), "Pacific/Kiritimati"},
+		{time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), "Pacific/Pago_Pago"},
+	} {
+		date := recurrence.Date{Time: e.date}
+		expense := &models.Expense{
+			Description:  "Dinner",
+			Amount:       100,
+			Currency:     "INR",
+			SplitType:    "equal",
+			ExpenseType:  "group",
+			CreatedBy:    user.ID,
+			GroupID:      &group.ID,
+			Contributors: []models.Contributor{{UserID: user.ID, PaidAmount: 100}},
+			AmountsOwed:  []models.AmountOwed{{UserID: user.ID, Owed: 100}},
+			ExpenseDate:  &date,
+			TimeZone:     e.zone,
+		}
+		if err := repos.Expenses.Create(ctx, expense); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/group/1/reports/categories?from=2024-03&to=2024-04", nil)
+	req = mux.SetURLVars(req, map[string]string{"groupId": strconv.Itoa(group.ID)})
+	rec := httptest.NewRecorder()
+	NewReportHandler(repos).GetCategoryReport(rec, req)
+
+	var report CategoryReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode %d response: %v", rec.Code, err)
+	}
+	if len(report.Months) != 2 || report.Months[0].Month != "2024-03" || report.Months[1].Month != "2024-04" {
+		t.Fatalf("months: got %+v", report.Months)
+	}
+	for _, month := range report.Months {
+		if len(month.Categories) != 1 || month.Categories[0].Total != 100 {
+			t.Errorf("%s: got %+v", month.Month, month.Categories)
+		}
+	}
+}
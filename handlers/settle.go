@@ -1,67 +1,118 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
 	"github.com/ashishsonamm/setu-splitwise/models"
-	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
 	"github.com/gorilla/mux"
+	"io"
+	"math/big"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
-func SettlePersonalBalance(w http.ResponseWriter, r *http.Request) {
+// settlementResult is what a settlement handler reports back once the payment is recorded.
+type settlementResult struct {
+	ID          int
+	Settled     money.Amount
+	Outstanding money.Amount // owed before this payment, less payments already awaiting confirmation
+	Remaining   money.Amount // still owed once this payment is confirmed
+	Overpaid    money.Amount
+	Currency    string          // of the amounts above: the currency the balance is kept in
+	Paid        money.Money     // what was actually paid, in the currency it was paid in
+	Rate        *rates.Snapshot // from Paid.Currency to Currency, when they differ
+	ExpiresAt   *time.Time
+}
+
+// SettlementHandler records settlements and the creditor's answers to them.
+type SettlementHandler struct {
+	users repository.UserRepository
+	tx    repository.Transactor
+	ledger
+}
+
+func NewSettlementHandler(repos repository.Repositories) *SettlementHandler {
+	return &SettlementHandler{users: repos.Users, tx: repos.Tx, ledger: newLedger(repos)}
+}
+
+func (h *SettlementHandler) SettlePersonalBalance(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.PersonalExpenseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+
+	if req.PayerID != 0 && req.PayerID != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot settle on behalf of another user")
+		return
+	}
+	req.PayerID = callerID
+
+	if req.PayeeID <= 0 || req.PayeeID == req.PayerID {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid payee")
 		return
 	}
 
-	query := `
-        SELECT 
-            SUM(ao.balance) AS balance
-        FROM 
-            amounts_owed ao
-        JOIN 
-            expenses e ON ao.expense_id = e.id
-        WHERE 
-            e.expense_type = 'personal' AND (ao.user_id = $1 OR ao.user_id = $2)
-        GROUP BY 
-            ao.user_id
-        HAVING 
-            SUM(ao.balance) < 0
-    `
-
-	var debtorBalance, creditorBalance float64
-	err := utils.DB.QueryRow(query, req.PayerID, req.PayeeID).Scan(&debtorBalance)
+	currency, err := money.NormalizeCurrency(req.Currency)
 	if err != nil {
-		http.Error(w, "Failed to fetch personal balance", http.StatusInternalServerError)
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
 		return
 	}
 
-	creditorBalance = -debtorBalance
+	ttl, err := confirmationTTL(req.ExpiresInHours)
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
 
-	if debtorBalance < 0 && creditorBalance > 0 {
-		_, err = utils.DB.Exec(
-			"INSERT INTO personal_settlements (debtor_id, creditor_id, amount) VALUES ($1, $2, $3)",
-			req.PayerID, req.PayeeID, -debtorBalance,
-		)
+	var result settlementResult
+	err = h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		if err := h.settlements.LockDebtor(ctx, req.PayerID); err != nil {
+			return err
+		}
+
+		outstanding, err := h.personalOutstanding(ctx, req.PayerID, req.PayeeID)
 		if err != nil {
-			http.Error(w, "Failed to create personal settlement", http.StatusInternalServerError)
-			return
+			return err
+		}
+		pending, err := h.pendingAmount(ctx, "personal", nil, req.PayerID, req.PayeeID, personalCurrency)
+		if err != nil {
+			return err
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message":   "Personal balance settled",
-			"settled":   -debtorBalance,
-			"remaining": 0,
-		})
-	} else {
-		http.Error(w, "No balance to settle", http.StatusBadRequest)
+		result, err = settleIn(h.rates, outstanding-pending, req.Amount, currency, personalCurrency, req.AllowOverpayment)
+		if err != nil {
+			return err
+		}
+
+		return h.recordSettlement(ctx, &models.Settlement{Type: "personal", DebtorID: req.PayerID, CreditorID: req.PayeeID}, &result, ttl, callerID)
+	})
+	if writeSettlementError(w, err, "Failed to create personal settlement") {
+		return
 	}
+
+	writeSettlementResult(w, "Personal settlement recorded; waiting for the payee to confirm it", result)
 }
 
-func SettleGroupBalanceBetweenUsers(w http.ResponseWriter, r *http.Request) {
+func (h *SettlementHandler) SettleGroupBalanceBetweenUsers(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	groupIDStr := mux.Vars(r)["groupId"]
 	user1IDStr := mux.Vars(r)["user1Id"]
 	user2IDStr := mux.Vars(r)["user2Id"]
@@ -70,51 +121,262 @@ func SettleGroupBalanceBetweenUsers(w http.ResponseWriter, r *http.Request) {
 	user1ID, err2 := strconv.Atoi(user1IDStr)
 	user2ID, err3 := strconv.Atoi(user2IDStr)
 	if err != nil || err2 != nil || err3 != nil {
-		http.Error(w, "Invalid group or user ID", http.StatusBadRequest)
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group or user ID")
+		return
+	}
+
+	// user1 is the debtor paying user2, so only user1 may record the payment.
+	if user1ID != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot settle on behalf of another user")
+		return
+	}
+	if user2ID == user1ID {
+		apierror.Write(w, apierror.InvalidRequest, "Cannot settle with yourself")
+		return
+	}
+
+	if !requireMembers(w, r, h.groups, groupID, []int{user2ID}) {
+		return
+	}
+
+	// The body is optional: without one the whole outstanding balance is settled.
+	var req models.GroupSettlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
 		return
 	}
 
-	query := `
-        SELECT 
-            SUM(ao.balance) AS user1_balance, 
-            SUM(ao2.balance) AS user2_balance
-        FROM 
-            amounts_owed ao
-        JOIN 
-            amounts_owed ao2 ON ao.expense_id = ao2.expense_id
-        JOIN 
-            expenses e ON ao.expense_id = e.id
-        WHERE 
-            e.group_id = $1 AND ao.user_id = $2 AND ao2.user_id = $3
-        GROUP BY 
-            ao.user_id, ao2.user_id
-    `
-
-	var user1Balance, user2Balance float64
-	err = utils.DB.QueryRow(query, groupID, user1ID, user2ID).Scan(&user1Balance, &user2Balance)
+	ttl, err := confirmationTTL(req.ExpiresInHours)
 	if err != nil {
-		http.Error(w, "Failed to fetch group balances", http.StatusInternalServerError)
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
 		return
 	}
 
-	if user1Balance < 0 && user2Balance > 0 {
-		amount := min(-user1Balance, user2Balance)
-		_, err = utils.DB.Exec(
-			"INSERT INTO group_settlements (group_id, debtor_id, creditor_id, amount) VALUES ($1, $2, $3, $4)",
-			groupID, user1ID, user2ID, amount,
-		)
-		if err != nil {
-			http.Error(w, "Failed to create group settlement", http.StatusInternalServerError)
+	currency := ""
+	if req.Currency != "" {
+		if currency, err = money.NormalizeCurrency(req.Currency); err != nil {
+			apierror.Write(w, apierror.InvalidRequest, err.Error())
 			return
 		}
+	}
+
+	var result settlementResult
+	err = h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		if err := h.settlements.LockDebtor(ctx, user1ID); err != nil {
+			return err
+		}
+
+		balances, base, err := h.groupBalances(ctx, groupID)
+		if err != nil {
+			return err
+		}
+		if currency == "" {
+			currency = base
+		}
+		outstanding := pairOutstanding(balances[user1ID], balances[user2ID])
+		pending, err := h.pendingAmount(ctx, "group", &groupID, user1ID, user2ID, base)
+		if err != nil {
+			return err
+		}
+
+		result, err = settleIn(h.rates, outstanding-pending, req.Amount, currency, base, req.AllowOverpayment)
+		if err != nil {
+			return err
+		}
+
+		return h.recordSettlement(ctx, &models.Settlement{Type: "group", GroupID: &groupID, DebtorID: user1ID, CreditorID: user2ID}, &result, ttl, callerID)
+	})
+	if writeSettlementError(w, err, "Failed to create group settlement") {
+		return
+	}
+
+	writeSettlementResult(w, "Group settlement recorded; waiting for the creditor to confirm it", result)
+}
+
+// recordSettlement stores s as a pending payment of what result says was paid, expiring after ttl
+// hours unless ttl is nil, and fills in result's ID and expiry.
+func (h *SettlementHandler) recordSettlement(ctx context.Context, s *models.Settlement, result *settlementResult, ttl *int, callerID int) error {
+	s.Amount = result.Paid.Amount
+	s.Currency = result.Paid.Currency
+	s.ExchangeRate = result.Rate
+	s.Status = models.SettlementPending
+	s.CreatedBy = &callerID
+	if ttl != nil {
+		expiresAt := time.Now().Add(time.Duration(*ttl) * time.Hour)
+		s.ExpiresAt = &expiresAt
+	}
+	if err := h.settlements.Create(ctx, s); err != nil {
+		return err
+	}
+	result.ID, result.ExpiresAt = s.ID, s.ExpiresAt
+	return nil
+}
+
+var (
+	errNothingToSettle  = errors.New("no balance to settle")
+	errInvalidSettle    = errors.New("settlement amount must be greater than zero")
+	errOverpaymentLimit = errors.New("settlement amount exceeds the outstanding balance")
+)
+
+// resolveSettlementAmount picks how much to record: the requested amount, or the whole outstanding
+// balance.
+func resolveSettlementAmount(outstanding money.Amount, requested *money.Amount, allowOverpayment bool) (settlementResult, error) {
+	if outstanding < 0 {
+		outstanding = 0
+	}
+	result := settlementResult{Outstanding: outstanding}
+
+	if requested == nil {
+		if outstanding <= 0 {
+			return result, errNothingToSettle
+		}
+		result.Settled = outstanding
+		return result, nil
+	}
+
+	if *requested <= 0 {
+		return result, errInvalidSettle
+	}
+	if *requested > outstanding {
+		if !allowOverpayment {
+			return result, fmt.Errorf("%w: %s is owed but %s was offered", errOverpaymentLimit, outstanding, *requested)
+		}
+		result.Overpaid = *requested - outstanding
+	}
+	result.Settled = *requested
+	result.Remaining = outstanding - result.Settled + result.Overpaid
+	return result, nil
+}
+
+// settleIn resolves a payment made in currency against a balance kept in base at p's rate for today;
+// Paid is what to record in currency and Rate the rate to record with it.
+func settleIn(p rates.ExchangeRateProvider, outstanding money.Amount, requested *money.Amount, currency, base string, allowOverpayment bool) (settlementResult, error) {
+	rate := big.NewRat(1, 1)
+	if currency != base {
+		var err error
+		if rate, err = p.Rate(currency, base, time.Now()); err != nil {
+			return settlementResult{}, err
+		}
+	}
+
+	var requestedInBase *money.Amount
+	if requested != nil {
+		converted, err := money.Convert(*requested, rate)
+		if err != nil {
+			return settlementResult{}, err
+		}
+		requestedInBase = &converted
+	}
+
+	result, err := resolveSettlementAmount(outstanding, requestedInBase, allowOverpayment)
+	if err != nil {
+		return result, err
+	}
+	result.Currency = base
+	result.Paid.Currency = currency
+	if currency != base {
+		result.Rate = &rates.Snapshot{Currency: base, Rate: rate}
+	}
+	if requested != nil {
+		result.Paid.Amount = *requested
+		return result, nil
+	}
+	result.Paid.Amount, err = money.Convert(result.Settled, new(big.Rat).Inv(rate))
+	return result, err
+}
+
+// defaultConfirmationTTL is how many hours a settlement stays pending by default: one week.
+const defaultConfirmationTTL = 7 * 24
+
+// maxConfirmationTTL caps expires_in_hours at 90 days.
+const maxConfirmationTTL = 90 * 24
+
+// confirmationTTL is how many hours a new settlement stays pending, or nil if it never expires.
+func confirmationTTL(requested *int) (*int, error) {
+	if requested != nil {
+		if *requested <= 0 || *requested > maxConfirmationTTL {
+			return nil, fmt.Errorf("expires_in_hours must be between 1 and %d", maxConfirmationTTL)
+		}
+		return requested, nil
+	}
+
+	hours := defaultConfirmationTTL
+	if value := os.Getenv("SETTLEMENT_CONFIRMATION_TTL_HOURS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			hours = n
+		}
+	}
+	if hours == 0 {
+		return nil, nil
+	}
+	return &hours, nil
+}
+
+// pendingAmount is what debtor has offered creditor that still awaits confirmation, in currency base.
+// It is held back from the outstanding balance so that the same debt cannot be offered twice.
+func (l ledger) pendingAmount(ctx context.Context, kind string, groupID *int, debtorID, creditorID int, base string) (money.Amount, error) {
+	settlements, err := l.settlements.List(ctx, repository.SettlementFilter{
+		Type:                 kind,
+		GroupID:              groupID,
+		DebtorID:             &debtorID,
+		CreditorID:           &creditorID,
+		AwaitingConfirmation: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var pending money.Amount
+	for _, s := range settlements {
+		converted, err := rates.Convert(l.rates, s.Amount, s.Currency, base, s.CreatedAt, s.ExchangeRate)
+		if err != nil {
+			return 0, err
+		}
+		pending += converted
+	}
+	return pending, nil
+}
+
+// writeSettlementError writes the response for err, returning false when it is nil.
+func writeSettlementError(w http.ResponseWriter, err error, fallback string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errNothingToSettle):
+		apierror.Write(w, apierror.NothingToSettle, "No balance to settle")
+	case errors.Is(err, errInvalidSettle):
+		apierror.Write(w, apierror.InvalidRequest, "Settlement amount must be greater than zero")
+	case errors.Is(err, errOverpaymentLimit):
+		apierror.Write(w, apierror.OverpaymentLimit, err.Error()+"; set allow_overpayment to pay more")
+	case errors.Is(err, rates.ErrNoRate):
+		apierror.Write(w, apierror.ExchangeRateUnavailable, err.Error())
+	default:
+		apierror.WriteInternal(w, err, fallback)
+	}
+	return true
+}
+
+func writeSettlementResult(w http.ResponseWriter, message string, result settlementResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       message,
+		"settlement_id": result.ID,
+		"status":        models.SettlementPending,
+		"expires_at":    result.ExpiresAt,
+		"settled":       result.Settled,
+		"outstanding":   result.Outstanding,
+		"remaining":     result.Remaining,
+		"overpaid":      result.Overpaid,
+		"currency":      result.Currency,
+		"paid":          result.Paid,
+	})
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message":   "Group balance settled",
-			"settled":   amount,
-			"remaining": 0,
-		})
-	} else {
-		http.Error(w, "No balance to settle", http.StatusBadRequest)
+// pairOutstanding is how much a debtor still owes a creditor in a group: the smaller of their balances.
+func pairOutstanding(debtorBalance, creditorBalance money.Amount) money.Amount {
+	if debtorBalance >= 0 || creditorBalance <= 0 {
+		return 0
 	}
+	return min(-debtorBalance, creditorBalance)
 }
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetGroupSettlements lists a group's settlements, newest first, optionally within ?from=&to= dates
+// in the caller's time zone.
+func (h *SettlementHandler) GetGroupSettlements(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+		return
+	}
+
+	loc, ok := callerLocation(w, r, h.users, callerID)
+	if !ok {
+		return
+	}
+	filter := repository.SettlementFilter{Type: "group", GroupID: &groupID}
+	if filter.From, filter.To, err = parseDateRange(r, loc); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	h.writeSettlementList(w, r, filter, loc)
+}
+
+// GetUserSettlements lists every settlement the caller paid or received. ?with= narrows it to one
+// other user, ?type=group|personal to one kind, and ?from=&to= to a date range in the caller's time zone.
+func (h *SettlementHandler) GetUserSettlements(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid user ID")
+		return
+	}
+	if userID != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot view another user's settlements")
+		return
+	}
+
+	filter := repository.SettlementFilter{UserID: &userID}
+	query := r.URL.Query()
+	if with := query.Get("with"); with != "" {
+		otherID, err := strconv.Atoi(with)
+		if err != nil {
+			apierror.Write(w, apierror.InvalidRequest, "Invalid user ID in with")
+			return
+		}
+		filter.OtherUserID = &otherID
+	}
+	if kind := query.Get("type"); kind != "" {
+		if !isSettlementKind(kind) {
+			apierror.Write(w, apierror.InvalidRequest, "type must be group or personal")
+			return
+		}
+		filter.Type = kind
+	}
+	loc, ok := callerLocation(w, r, h.users, callerID)
+	if !ok {
+		return
+	}
+	if filter.From, filter.To, err = parseDateRange(r, loc); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	h.writeSettlementList(w, r, filter, loc)
+}
+
+// GetPendingSettlements lists the settlements waiting for the caller to confirm or reject them,
+// newest first.
+func (h *SettlementHandler) GetPendingSettlements(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	loc, ok := callerLocation(w, r, h.users, callerID)
+	if !ok {
+		return
+	}
+	h.writeSettlementList(w, r, repository.SettlementFilter{CreditorID: &callerID, Status: models.SettlementPending}, loc)
+}
+
+// writeSettlementList writes the settlements matching filter, with their timestamps shown in loc.
+func (h *SettlementHandler) writeSettlementList(w http.ResponseWriter, r *http.Request, filter repository.SettlementFilter, loc *time.Location) {
+	if err := h.settlements.ExpirePending(r.Context()); err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch settlements")
+		return
+	}
+
+	settlements, err := h.settlements.List(r.Context(), filter)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Failed to fetch settlements")
+		return
+	}
+	for i := range settlements {
+		settlements[i].InLocation(loc)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlements)
+}
+
+// ReverseSettlement undoes a confirmed settlement by recording an equal payment in the opposite
+// direction. The original row is kept, so the history shows both. A reversal by the debtor only puts
+// their own debt back and counts straight away; one by the creditor is pending until the debtor, its
+// creditor, confirms it.
+func (h *SettlementHandler) ReverseSettlement(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	kind, settlementID, ok := settlementPathParams(w, r)
+	if !ok {
+		return
+	}
+
+	var reversalID int
+	var status models.SettlementStatus
+	err := h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		original, err := h.lockSettlement(ctx, kind, settlementID)
+		if err != nil {
+			return err
+		}
+		if callerID != original.DebtorID && callerID != original.CreditorID {
+			return errNotSettlementParty
+		}
+		if original.ReversalOf != nil || original.ReversedBy != nil {
+			return fmt.Errorf("%w: settlement has already been reversed", errSettlementState)
+		}
+		if original.Status != models.SettlementConfirmed {
+			return fmt.Errorf("%w: only confirmed settlements can be reversed", errSettlementState)
+		}
+
+		status = models.SettlementConfirmed
+		if callerID == original.CreditorID {
+			status = models.SettlementPending
+		}
+
+		// The reversal copies the original's amount, currency and exchange rate so the two cancel exactly.
+		reversal := models.Settlement{
+			Type:         kind,
+			GroupID:      original.GroupID,
+			DebtorID:     original.CreditorID,
+			CreditorID:   original.DebtorID,
+			Amount:       original.Amount,
+			Currency:     original.Currency,
+			ExchangeRate: original.ExchangeRate,
+			Status:       status,
+			ReversalOf:   &original.ID,
+			CreatedBy:    &callerID,
+		}
+		if err := h.settlements.Create(ctx, &reversal); err != nil {
+			return err
+		}
+		reversalID = reversal.ID
+		return nil
+	})
+	if writeSettlementChangeError(w, err, "Failed to reverse settlement") {
+		return
+	}
+
+	message := "Settlement reversed"
+	if status == models.SettlementPending {
+		message = "Reversal recorded; waiting for the debtor to confirm it"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message, "settlement_id": settlementID, "reversal_id": reversalID, "status": status})
+}
+
+// DisputeSettlement lets the creditor flag a confirmed payment they did not receive after all. Until
+// they confirm it again, it no longer counts towards balances.
+func (h *SettlementHandler) DisputeSettlement(w http.ResponseWriter, r *http.Request) {
+	var req models.SettlementStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		apierror.Write(w, apierror.InvalidRequest, "A reason for the dispute is required")
+		return
+	}
+
+	h.changeSettlementStatus(w, r, []models.SettlementStatus{models.SettlementConfirmed}, models.SettlementDisputed, strings.TrimSpace(req.Reason), "Settlement disputed")
+}
+
+// ConfirmSettlement is the creditor accepting a payment, either one awaiting confirmation or one they
+// disputed earlier. From then on it counts towards balances.
+func (h *SettlementHandler) ConfirmSettlement(w http.ResponseWriter, r *http.Request) {
+	h.changeSettlementStatus(w, r, []models.SettlementStatus{models.SettlementPending, models.SettlementDisputed}, models.SettlementConfirmed, "", "Settlement confirmed")
+}
+
+// RejectSettlement is the creditor refusing a pending payment. The body, with an optional reason, may
+// be omitted. A rejected settlement never counts; the debtor records a new one if needed.
+func (h *SettlementHandler) RejectSettlement(w http.ResponseWriter, r *http.Request) {
+	var req models.SettlementStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request body")
+		return
+	}
+
+	h.changeSettlementStatus(w, r, []models.SettlementStatus{models.SettlementPending}, models.SettlementRejected, strings.TrimSpace(req.Reason), "Settlement rejected")
+}
+
+// changeSettlementStatus moves a settlement the caller is the creditor of from one of the from
+// statuses to to, storing reason, if any, as its status reason.
+func (h *SettlementHandler) changeSettlementStatus(w http.ResponseWriter, r *http.Request, from []models.SettlementStatus, to models.SettlementStatus, reason, message string) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	kind, settlementID, ok := settlementPathParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		if err := h.settlements.ExpirePending(ctx); err != nil {
+			return err
+		}
+
+		settlement, err := h.lockSettlement(ctx, kind, settlementID)
+		if err != nil {
+			return err
+		}
+		if callerID != settlement.CreditorID {
+			return errNotSettlementCreditor
+		}
+		if settlement.ReversedBy != nil || (settlement.ReversalOf != nil && settlement.Status != models.SettlementPending) {
+			return fmt.Errorf("%w: reversed settlements cannot change status", errSettlementState)
+		}
+		if !hasStatus(from, settlement.Status) {
+			return fmt.Errorf("%w: settlement is %s", errSettlementState, settlement.Status)
+		}
+
+		var statusReason *string
+		if reason != "" {
+			statusReason = &reason
+		}
+		return h.settlements.SetStatus(ctx, kind, settlementID, to, statusReason)
+	})
+	if writeSettlementChangeError(w, err, "Failed to update settlement") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message, "settlement_id": settlementID, "status": to})
+}
+
+func hasStatus(statuses []models.SettlementStatus, status models.SettlementStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errSettlementNotFound    = errors.New("settlement not found")
+	errNotSettlementParty    = errors.New("only the debtor or creditor can change this settlement")
+	errNotSettlementCreditor = errors.New("only the creditor can change this settlement's status")
+	errSettlementState       = errors.New("settlement cannot be changed")
+)
+
+// writeSettlementChangeError writes the response for err, returning false when it is nil.
+func writeSettlementChangeError(w http.ResponseWriter, err error, fallback string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errSettlementNotFound):
+		apierror.Write(w, apierror.SettlementNotFound, "Settlement not found")
+	case errors.Is(err, errNotSettlementParty), errors.Is(err, errNotSettlementCreditor):
+		apierror.Write(w, apierror.Forbidden, err.Error())
+	case errors.Is(err, errSettlementState):
+		apierror.Write(w, apierror.Conflict, err.Error())
+	default:
+		apierror.WriteInternal(w, err, fallback)
+	}
+	return true
+}
+
+func isSettlementKind(kind string) bool {
+	return kind == "group" || kind == "personal"
+}
+
+func settlementPathParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	kind := mux.Vars(r)["kind"]
+	if !isSettlementKind(kind) {
+		apierror.Write(w, apierror.InvalidRequest, "Settlement type must be group or personal")
+		return "", 0, false
+	}
+	settlementID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid settlement ID")
+		return "", 0, false
+	}
+	return kind, settlementID, true
+}
+
+// lockSettlement locks one settlement for the rest of the transaction and returns it.
+func (h *SettlementHandler) lockSettlement(ctx context.Context, kind string, settlementID int) (*models.Settlement, error) {
+	settlement, err := h.settlements.Lock(ctx, kind, settlementID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errSettlementNotFound
+	}
+	return settlement, err
+}
+
+// parseDateRange reads ?from= and ?to= as RFC 3339 timestamps or YYYY-MM-DD days in loc, a bare ?to=
+// date including that whole day, and returns the bounds in UTC.
+func parseDateRange(r *http.Request, loc *time.Location) (from, to *time.Time, err error) {
+	parse := func(name string, endOfDay bool) (*time.Time, error) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+		t, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 timestamp", name)
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		t = t.UTC()
+		return &t, nil
+	}
+
+	if from, err = parse("from", false); err != nil {
+		return nil, nil, err
+	}
+	if to, err = parse("to", true); err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
@@ -1,26 +1,144 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
 	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
 	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// UserHandler serves sign-up, login and account settings.
+type UserHandler struct {
+	users repository.UserRepository
+}
+
+func NewUserHandler(repos repository.Repositories) *UserHandler {
+	return &UserHandler{users: repos.Users}
+}
+
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	if req.Password == "" {
+		apierror.Write(w, apierror.InvalidRequest, "Password is required")
 		return
 	}
 
-	query := `INSERT INTO users (name, email, password) VALUES ($1, $2, $3) RETURNING id`
-	err := utils.DB.QueryRow(query, user.Name, user.Email, user.Password).Scan(&user.ID)
+	timeZone, err := parseTimeZone(req.TimeZone)
 	if err != nil {
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	hash, err := utils.HashPassword(req.Password)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		apierror.Write(w, apierror.InvalidRequest, "Password must be at most 72 bytes")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to create user")
+		return
+	}
+
+	user := models.User{Name: req.Name, Email: req.Email, Password: hash, TimeZone: timeZone}
+	err = h.users.Create(r.Context(), &user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		apierror.Write(w, apierror.Conflict, "A user with this email already exists")
+		return
+	} else if err != nil {
+		apierror.WriteInternal(w, err, "Failed to create user")
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{"message": "User created successfully", "user_id": user.ID})
 }
+
+// UpdateUserTimeZone sets the time zone the caller's days and months are counted in: it decides what
+// "today" is for their new expenses and where date ranges in their listings and reports begin and end.
+func (h *UserHandler) UpdateUserTimeZone(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid user ID")
+		return
+	}
+	if userID != callerID {
+		apierror.Write(w, apierror.Forbidden, "Cannot change another user's time zone")
+		return
+	}
+
+	var req models.UpdateTimeZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.InvalidRequest, "Invalid request payload")
+		return
+	}
+	if strings.TrimSpace(req.TimeZone) == "" {
+		apierror.Write(w, apierror.InvalidRequest, "time_zone is required")
+		return
+	}
+	timeZone, err := parseTimeZone(req.TimeZone)
+	if err != nil {
+		apierror.Write(w, apierror.InvalidRequest, err.Error())
+		return
+	}
+
+	if err := h.users.SetTimeZone(r.Context(), userID, timeZone); err != nil {
+		apierror.WriteInternal(w, err, "Failed to update time zone")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Time zone updated successfully", "time_zone": timeZone})
+}
+
+// parseTimeZone checks name is an IANA time zone such as "Europe/Paris", returning "UTC" for an empty one.
+func parseTimeZone(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "UTC", nil
+	}
+	// time.LoadLocation also accepts "Local", which would mean the server's zone.
+	if _, err := time.LoadLocation(name); err != nil || name == "Local" {
+		return "", fmt.Errorf("unknown time zone %q: use an IANA name such as Asia/Kolkata", name)
+	}
+	return name, nil
+}
+
+// callerLocation loads the caller's time zone, writing a 500 if it cannot.
+func callerLocation(w http.ResponseWriter, r *http.Request, users repository.UserRepository, callerID int) (*time.Location, bool) {
+	loc, err := userLocation(r.Context(), users, callerID)
+	if err != nil {
+		apierror.WriteInternal(w, err, "Server error")
+		return nil, false
+	}
+	return loc, true
+}
+
+// userLocation returns the user's configured time zone, or UTC for an unknown user.
+func userLocation(ctx context.Context, users repository.UserRepository, userID int) (*time.Location, error) {
+	user, err := users.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return time.UTC, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(user.TimeZone)
+}
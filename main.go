@@ -1,19 +1,70 @@
 package main
 
 import (
+	"context"
+	"github.com/ashishsonamm/setu-splitwise/blobstore"
+	"github.com/ashishsonamm/setu-splitwise/handlers"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/repository/memory"
+	"github.com/ashishsonamm/setu-splitwise/repository/postgres"
 	"github.com/ashishsonamm/setu-splitwise/routes"
 	"github.com/ashishsonamm/setu-splitwise/utils"
 	"github.com/joho/godotenv"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata" // users' time zones must resolve even where the host has no zoneinfo
 )
 
+// defaultRecurringInterval is how often due recurring expenses are looked for.
+const defaultRecurringInterval = 15 * time.Minute
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error loading .env file")
 	}
-	utils.InitDB()
-	router := routes.RegisterRoutes()
+
+	// STORAGE=memory runs without a database, keeping everything in memory until the server stops.
+	var repos repository.Repositories
+	switch storage := os.Getenv("STORAGE"); storage {
+	case "", "postgres":
+		utils.InitDB()
+		repos = postgres.New(utils.DB)
+	case "memory":
+		repos = memory.New()
+		log.Println("Keeping data in memory; it is lost when the server stops")
+	default:
+		log.Fatalf("Invalid STORAGE %q: use postgres or memory", storage)
+	}
+	// Every handler and the scheduler look rates up through this one cache.
+	repos.ExchangeRates = rates.NewCache(repos.ExchangeRates)
+
+	blobs, err := blobstore.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring the attachment store: %v", err)
+	}
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		n, err := rates.ImportFile(repos.ExchangeRates, path)
+		if err != nil {
+			log.Fatalf("Error importing exchange rates: %v", err)
+		}
+		log.Printf("Imported %d exchange rates from %s", n, path)
+	}
+
+	interval := defaultRecurringInterval
+	if value := os.Getenv("RECURRING_EXPENSES_INTERVAL"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			log.Fatalf("Invalid RECURRING_EXPENSES_INTERVAL %q: use a duration like 15m, or 0 to disable", value)
+		}
+	}
+	if interval > 0 {
+		go handlers.RunRecurringScheduler(context.Background(), repos, interval)
+	}
+
+	router := routes.RegisterRoutes(repos, blobs)
 	log.Fatal(http.ListenAndServe(":8080", router))
 }
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// RequireAdmin rejects requests from users who are not site administrators. It must run after
+// JWTAuth.
+func RequireAdmin(users repository.UserRepository) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok {
+				apierror.Write(w, apierror.Unauthenticated, "Missing or invalid token")
+				return
+			}
+
+			user, err := users.Get(r.Context(), userID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				apierror.WriteError(w, err)
+				return
+			}
+			if user == nil || !user.IsAdmin {
+				apierror.Write(w, apierror.Forbidden, "Administrator access required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
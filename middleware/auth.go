@@ -1,27 +1,51 @@
 package middleware
 
 import (
+	"context"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
 	"github.com/ashishsonamm/setu-splitwise/utils"
 	"net/http"
 	"strings"
 )
 
+type contextKey int
+
+const userIDKey contextKey = iota
+
 func JWTAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+			apierror.Write(w, apierror.Unauthenticated, "Missing or invalid token")
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		_, err := utils.ParseJWT(tokenString)
+		claims, err := utils.ParseJWT(tokenString)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			apierror.Write(w, apierror.Unauthenticated, "Invalid token")
+			return
+		}
+
+		// MapClaims decodes JSON numbers as float64.
+		userID, ok := claims["user_id"].(float64)
+		if !ok || userID <= 0 || userID != float64(int(userID)) {
+			apierror.Write(w, apierror.Unauthenticated, "Invalid token")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), int(userID))))
 	})
 }
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID.
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID set by JWTAuth.
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// GroupMember rejects requests to /group/{groupId}/... routes unless the authenticated user belongs
+// to that group. It must run after JWTAuth.
+func GroupMember(groups repository.GroupRepository) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok {
+				apierror.Write(w, apierror.Unauthenticated, "Missing or invalid token")
+				return
+			}
+
+			groupID, err := strconv.Atoi(mux.Vars(r)["groupId"])
+			if err != nil {
+				apierror.Write(w, apierror.InvalidRequest, "Invalid group ID")
+				return
+			}
+
+			if _, err := groups.Get(r.Context(), groupID); errors.Is(err, repository.ErrNotFound) {
+				apierror.Write(w, apierror.GroupNotFound, "Group not found")
+				return
+			} else if err != nil {
+				apierror.WriteError(w, err)
+				return
+			}
+
+			_, member, err := groups.Role(r.Context(), groupID, userID)
+			if err != nil {
+				apierror.WriteError(w, err)
+				return
+			}
+			if !member {
+				apierror.Write(w, apierror.Forbidden, "You are not a member of this group")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
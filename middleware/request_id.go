@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"net/http"
+)
+
+// maxRequestIDLength bounds a client-supplied request ID; longer ones are replaced.
+const maxRequestIDLength = 64
+
+// RequestID gives every request an ID, echoed in the X-Request-ID response header and in error
+// bodies so a failure a client reports can be found in the logs. A well-formed ID sent by the client
+// or a proxy in front of us is kept; otherwise a random one is made.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(apierror.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(apierror.RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID allows letters, digits, '-', '_' and '.', so an ID is safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
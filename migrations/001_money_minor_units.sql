@@ -0,0 +1,46 @@
+-- Convert every money column from FLOAT major units to exact BIGINT minor units (paise/cents).
+-- Existing values are rounded to the nearest minor unit.
+
+BEGIN;
+
+ALTER TABLE expenses
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'INR';
+
+ALTER TABLE contributors
+    ALTER COLUMN contribution_amount TYPE BIGINT USING ROUND(contribution_amount * 100)::BIGINT,
+    ALTER COLUMN paid_amount TYPE BIGINT USING ROUND(paid_amount * 100)::BIGINT,
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT;
+
+ALTER TABLE amounts_owed
+    ALTER COLUMN owed TYPE BIGINT USING ROUND(owed * 100)::BIGINT,
+    ALTER COLUMN balance TYPE BIGINT USING ROUND(balance * 100)::BIGINT;
+
+ALTER TABLE group_settlements
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT;
+
+ALTER TABLE personal_settlements
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT;
+
+-- Rounding each contributor independently can leave an expense a paisa off its total.
+-- Push any such residue onto the contributor with the lowest id so every expense balances again.
+UPDATE contributors c
+SET contribution_amount = c.contribution_amount + diff.residue
+FROM (
+    SELECT e.id AS expense_id,
+           e.amount - SUM(c2.contribution_amount) AS residue,
+           MIN(c2.id) AS first_contributor
+    FROM expenses e
+    JOIN contributors c2 ON c2.expense_id = e.id
+    GROUP BY e.id, e.amount
+    HAVING e.amount <> SUM(c2.contribution_amount)
+) diff
+WHERE c.id = diff.first_contributor;
+
+UPDATE amounts_owed ao
+SET owed = c.contribution_amount,
+    balance = c.paid_amount - c.contribution_amount
+FROM contributors c
+WHERE c.expense_id = ao.expense_id AND c.user_id = ao.user_id;
+
+COMMIT;
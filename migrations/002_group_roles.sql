@@ -0,0 +1,26 @@
+-- Add owner/admin/member roles to group memberships.
+
+BEGIN;
+
+ALTER TABLE group_users
+    ADD COLUMN role VARCHAR(10) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member'));
+
+-- Groups that recorded a creator: make sure the creator is a member and owns the group.
+INSERT INTO group_users (group_id, user_id, role)
+SELECT id, created_by, 'owner' FROM groups WHERE created_by IS NOT NULL
+ON CONFLICT (group_id, user_id) DO UPDATE SET role = 'owner';
+
+-- Everything else: the longest-standing member becomes the owner.
+UPDATE group_users gu
+SET role = 'owner'
+FROM (
+    SELECT DISTINCT ON (group_id) id
+    FROM group_users
+    WHERE group_id NOT IN (SELECT group_id FROM group_users WHERE role = 'owner')
+    ORDER BY group_id, joined_at, id
+) first_member
+WHERE gu.id = first_member.id;
+
+CREATE UNIQUE INDEX group_users_one_owner ON group_users (group_id) WHERE role = 'owner';
+
+COMMIT;
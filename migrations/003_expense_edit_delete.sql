@@ -0,0 +1,20 @@
+-- Soft delete for expenses and a snapshot of every expense version replaced by an edit or delete.
+
+BEGIN;
+
+ALTER TABLE expenses
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE TABLE expense_revisions (
+    id SERIAL PRIMARY KEY,
+    expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    snapshot JSONB NOT NULL,
+    actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (expense_id, revision)
+);
+
+COMMIT;
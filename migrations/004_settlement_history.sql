@@ -0,0 +1,21 @@
+-- Settlement status (for disputes), compensating reversal entries, and who recorded each settlement.
+
+BEGIN;
+
+ALTER TABLE group_settlements
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'confirmed' CHECK (status IN ('confirmed', 'disputed')),
+    ADD COLUMN dispute_reason TEXT,
+    ADD COLUMN reversal_of INT UNIQUE REFERENCES group_settlements(id) ON DELETE CASCADE,
+    ADD COLUMN created_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE personal_settlements
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'confirmed' CHECK (status IN ('confirmed', 'disputed')),
+    ADD COLUMN dispute_reason TEXT,
+    ADD COLUMN reversal_of INT UNIQUE REFERENCES personal_settlements(id) ON DELETE CASCADE,
+    ADD COLUMN created_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+-- Settlements were always recorded by the debtor.
+UPDATE group_settlements SET created_by = debtor_id;
+UPDATE personal_settlements SET created_by = debtor_id;
+
+COMMIT;
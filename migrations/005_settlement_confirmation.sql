@@ -0,0 +1,25 @@
+-- Two-sided settlements: new payments wait in 'pending' until the creditor confirms or rejects them,
+-- and lapse to 'expired' if they do neither in time. Existing rows stay confirmed.
+
+BEGIN;
+
+ALTER TABLE group_settlements DROP CONSTRAINT group_settlements_status_check;
+ALTER TABLE group_settlements
+    ALTER COLUMN status SET DEFAULT 'pending',
+    ADD CONSTRAINT group_settlements_status_check CHECK (status IN ('pending', 'confirmed', 'rejected', 'expired', 'disputed')),
+    ADD COLUMN expires_at TIMESTAMP,
+    ADD COLUMN responded_at TIMESTAMP;
+ALTER TABLE group_settlements RENAME COLUMN dispute_reason TO status_reason;
+
+ALTER TABLE personal_settlements DROP CONSTRAINT personal_settlements_status_check;
+ALTER TABLE personal_settlements
+    ALTER COLUMN status SET DEFAULT 'pending',
+    ADD CONSTRAINT personal_settlements_status_check CHECK (status IN ('pending', 'confirmed', 'rejected', 'expired', 'disputed')),
+    ADD COLUMN expires_at TIMESTAMP,
+    ADD COLUMN responded_at TIMESTAMP;
+ALTER TABLE personal_settlements RENAME COLUMN dispute_reason TO status_reason;
+
+CREATE INDEX group_settlements_pending_idx ON group_settlements (creditor_id) WHERE status = 'pending';
+CREATE INDEX personal_settlements_pending_idx ON personal_settlements (creditor_id) WHERE status = 'pending';
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Multi-currency: a base currency per group, the currency each settlement was paid in, dated
+-- exchange rates, and site administrators who may load them. Expenses gain created_at so they can be
+-- converted at the rate of the day they were recorded; existing rows get the migration time.
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE groups ADD COLUMN base_currency CHAR(3) NOT NULL DEFAULT 'INR';
+
+ALTER TABLE expenses ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE group_settlements ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'INR';
+ALTER TABLE personal_settlements ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'INR';
+
+CREATE TABLE exchange_rates (
+    base_currency CHAR(3) NOT NULL,
+    quote_currency CHAR(3) NOT NULL,
+    rate_date DATE NOT NULL,
+    rate NUMERIC(24, 12) NOT NULL CHECK (rate > 0),
+    PRIMARY KEY (base_currency, quote_currency, rate_date)
+);
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- The exchange rate each expense and settlement was converted with when it was recorded, so that
+-- re-importing rates never changes historical balances. NULL means no rate was known at the time.
+
+BEGIN;
+
+ALTER TABLE expenses
+    ADD COLUMN exchange_rate NUMERIC(24, 12) CHECK (exchange_rate > 0),
+    ADD COLUMN rate_currency CHAR(3);
+
+ALTER TABLE group_settlements
+    ADD COLUMN exchange_rate NUMERIC(24, 12) CHECK (exchange_rate > 0),
+    ADD COLUMN rate_currency CHAR(3);
+
+ALTER TABLE personal_settlements
+    ADD COLUMN exchange_rate NUMERIC(24, 12) CHECK (exchange_rate > 0),
+    ADD COLUMN rate_currency CHAR(3);
+
+COMMIT;
@@ -0,0 +1,36 @@
+-- Recurring expense templates and the occurrences the scheduler has materialized from them. An
+-- occurrence row exists for every due date that has been handled, whether an expense was created,
+-- the date was skipped or creating it failed; the unique key keeps materialization idempotent.
+
+BEGIN;
+
+CREATE TABLE recurring_expenses (
+    id SERIAL PRIMARY KEY,
+    template JSONB NOT NULL,
+    group_id INT REFERENCES groups(id) ON DELETE CASCADE,
+    created_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly', 'custom')),
+    every INT NOT NULL DEFAULT 1 CHECK (every > 0),
+    cron VARCHAR(100),
+    start_date DATE NOT NULL,
+    end_date DATE CHECK (end_date >= start_date),
+    next_occurrence DATE,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX recurring_expenses_due_idx ON recurring_expenses (next_occurrence) WHERE NOT paused;
+
+CREATE TABLE recurring_occurrences (
+    id SERIAL PRIMARY KEY,
+    recurring_id INT NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+    occurs_on DATE NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('created', 'skipped', 'failed')),
+    expense_id INT REFERENCES expenses(id) ON DELETE SET NULL,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (recurring_id, occurs_on)
+);
+
+COMMIT;
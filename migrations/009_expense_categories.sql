@@ -0,0 +1,33 @@
+-- Expense categories and tags. Categories without a group are the system defaults every group and
+-- personal expense can use; groups add their own on top. Names are unique case-insensitively within
+-- the defaults and within each group.
+
+BEGIN;
+
+CREATE TABLE categories (
+    id SERIAL PRIMARY KEY,
+    group_id INT REFERENCES groups(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX categories_system_name ON categories (LOWER(name)) WHERE group_id IS NULL;
+CREATE UNIQUE INDEX categories_group_name ON categories (group_id, LOWER(name)) WHERE group_id IS NOT NULL;
+
+INSERT INTO categories (name) VALUES
+    ('Food'), ('Groceries'), ('Travel'), ('Transport'), ('Rent'), ('Utilities'),
+    ('Entertainment'), ('Shopping'), ('Health'), ('Other');
+
+ALTER TABLE expenses ADD COLUMN category_id INT REFERENCES categories(id) ON DELETE SET NULL;
+CREATE INDEX expenses_category_idx ON expenses (category_id);
+
+CREATE TABLE expense_tags (
+    expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (expense_id, tag)
+);
+
+CREATE INDEX expense_tags_tag_idx ON expense_tags (tag);
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Itemized expenses: the receipt's line items, each shared equally by the users it is assigned to,
+-- plus the tax, tip and discount spread across them in proportion to their items.
+
+BEGIN;
+
+ALTER TABLE expenses
+    ADD COLUMN tax BIGINT NOT NULL DEFAULT 0 CHECK (tax >= 0),
+    ADD COLUMN tip BIGINT NOT NULL DEFAULT 0 CHECK (tip >= 0),
+    ADD COLUMN discount BIGINT NOT NULL DEFAULT 0 CHECK (discount >= 0);
+
+CREATE TABLE expense_items (
+    id SERIAL PRIMARY KEY,
+    expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    assigned_to INT[] NOT NULL,
+    UNIQUE (expense_id, position)
+);
+
+COMMIT;
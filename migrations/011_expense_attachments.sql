@@ -0,0 +1,25 @@
+-- Receipt attachments: the files themselves live in the blob store (see blobstore.FromEnv); this
+-- table keeps where, what they are and, for images, their size and thumbnail.
+
+BEGIN;
+
+CREATE TABLE expense_attachments (
+    id SERIAL PRIMARY KEY,
+    expense_id INT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    storage_key TEXT NOT NULL UNIQUE,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    checksum CHAR(64) NOT NULL,
+    width INT,
+    height INT,
+    thumbnail_key TEXT,
+    thumbnail_width INT,
+    thumbnail_height INT,
+    uploaded_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX expense_attachments_expense_id_idx ON expense_attachments (expense_id);
+
+COMMIT;
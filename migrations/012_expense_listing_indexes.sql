@@ -0,0 +1,17 @@
+-- Indexes behind the paginated group expense list: one per sort order (each ending in id, the
+-- tie-break the cursor relies on), contributor lookups for the payer/participant filters and the
+-- per-page detail join, and trigrams for description search.
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX expenses_group_created_idx ON expenses (group_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX expenses_group_amount_idx ON expenses (group_id, amount, id) WHERE deleted_at IS NULL;
+CREATE INDEX expenses_description_trgm_idx ON expenses USING GIN (description gin_trgm_ops);
+
+CREATE INDEX contributors_expense_idx ON contributors (expense_id);
+CREATE INDEX contributors_user_expense_idx ON contributors (user_id, expense_id);
+CREATE INDEX amounts_owed_expense_idx ON amounts_owed (expense_id);
+
+COMMIT;
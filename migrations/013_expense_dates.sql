@@ -0,0 +1,30 @@
+-- Expense dates: the day an expense happened (a calendar date in the payer's time zone) kept apart
+-- from when it was recorded and last changed, plus each user's time zone for date ranges and "today".
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
+
+ALTER TABLE expenses
+    ADD COLUMN expense_date DATE,
+    ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC',
+    ADD COLUMN updated_at TIMESTAMP;
+
+-- Until now the creation time stood in for the date; recurring occurrences were recorded at
+-- midnight of the day they fell on, so this keeps their dates too.
+UPDATE expenses SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE expenses SET expense_date = created_at::date, updated_at = created_at;
+UPDATE expenses e SET updated_at = GREATEST(e.updated_at, r.changed_at)
+FROM (SELECT expense_id, MAX(created_at) AS changed_at FROM expense_revisions GROUP BY expense_id) r
+WHERE r.expense_id = e.id;
+
+ALTER TABLE expenses
+    ALTER COLUMN expense_date SET NOT NULL,
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN updated_at SET NOT NULL;
+
+DROP INDEX expenses_group_created_idx;
+CREATE INDEX expenses_group_date_idx ON expenses (group_id, expense_date, id) WHERE deleted_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Store split percentages and shares as exact hundredths (33.33% is 3333) instead of FLOAT.
+-- Existing values are rounded to the nearest hundredth, as splits were already weighted.
+
+BEGIN;
+
+ALTER TABLE contributors
+    ALTER COLUMN percentage TYPE BIGINT USING ROUND(percentage * 100)::BIGINT,
+    ALTER COLUMN share TYPE BIGINT USING ROUND(share * 100)::BIGINT;
+
+COMMIT;
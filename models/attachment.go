@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Attachment is a receipt file attached to an expense. Width, Height and Thumbnail are set for images only.
+type Attachment struct {
+	ID          int                  `json:"id"`
+	ExpenseID   int                  `json:"expense_id"`
+	FileName    string               `json:"file_name"`
+	ContentType string               `json:"content_type"`
+	Size        int64                `json:"size_bytes"`
+	Checksum    string               `json:"checksum"` // SHA-256 of the file, hex
+	Width       *int                 `json:"width,omitempty"`
+	Height      *int                 `json:"height,omitempty"`
+	Thumbnail   *AttachmentThumbnail `json:"thumbnail,omitempty"`
+	UploadedBy  *int                 `json:"uploaded_by"`
+	CreatedAt   time.Time            `json:"created_at"`
+	DownloadURL string               `json:"download_url"`
+
+	StorageKey   string  `json:"-"` // where the file is kept in the blob store
+	ThumbnailKey *string `json:"-"` // set with Thumbnail
+}
+
+type AttachmentThumbnail struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// Category classifies expenses for reporting. System categories have no GroupID and are available
+// everywhere; a group's custom categories only to its own expenses.
+type Category struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	GroupID *int   `json:"group_id"`
+}
+
+type CreateCategoryRequest struct {
+	Name string `json:"name"`
+}
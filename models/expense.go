@@ -1,27 +1,112 @@
 package models
 
+import (
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+)
+
+type Expense struct {
+	ID           int           `json:"id"`
+	Description  string        `json:"description"`
+	Amount       money.Amount  `json:"amount"`
+	Currency     string        `json:"currency"`     // ISO 4217 code, defaults to the group's base currency or money.DefaultCurrency
+	SplitType    string        `json:"split_type"`   // Types like "equal", "percentage", "share-wise", "absolute"
+	ExpenseType  string        `json:"expense_type"` // "group" or "personal"
+	CreatedBy    int           `json:"created_by"`   // User ID of the person who created the expense
+	GroupID      *int          `json:"group_id"`     // Group ID, if applicable
+	Contributors []Contributor `json:"contributors"` // List of users who contributed to this expense
+	AmountsOwed  []AmountOwed  `json:"amounts_owed"` // List of users and the amount they owe or are owed, in contributor order
+
+	CategoryID *int     `json:"category_id,omitempty"` // a system category or one of the group's own
+	Category   string   `json:"category,omitempty"`    // category name; accepted instead of category_id
+	Tags       []string `json:"tags,omitempty"`        // free-form labels, stored lower-case
+
+	// Itemized split only: the receipt, with tax and tip added and the discount taken off in proportion
+	// to each contributor's items.
+	Items    []LineItem   `json:"items,omitempty"`
+	Tax      money.Amount `json:"tax,omitempty"`
+	Tip      money.Amount `json:"tip,omitempty"`
+	Discount money.Amount `json:"discount,omitempty"`
+
+	// The day the expense happened, where it was paid. Defaults to today in the payer's time zone.
+	ExpenseDate *recurrence.Date `json:"expense_date,omitempty"`
+	TimeZone    string           `json:"time_zone,omitempty"` // IANA name, defaults to the payer's
+
+	CreatedAt    *time.Time      `json:"created_at,omitempty"`    // set by the server
+	UpdatedAt    *time.Time      `json:"updated_at,omitempty"`    // set by the server
+	ExchangeRate *rates.Snapshot `json:"exchange_rate,omitempty"` // rate to the group's base currency, taken when recorded
+}
+
+type Contributor struct {
+	UserID     int              `json:"user_id"`
+	PaidAmount money.Amount     `json:"paid_amount"`          // Amount paid by the user for this expense
+	Percentage money.Hundredths `json:"percentage,omitempty"` // Percentage for percentage-based split
+	Share      money.Hundredths `json:"share,omitempty"`      // Share for share-wise split
+	Amount     money.Amount     `json:"amount,omitempty"`     // Absolute amount for absolute-based split
+}
+
+type AmountOwed struct {
+	UserID  int          `json:"user_id"`
+	Owed    money.Amount `json:"owed"`
+	Balance money.Amount `json:"balance"`
+}
+
+// LineItem is one line of an itemized receipt, shared equally by the users it is assigned to.
+type LineItem struct {
+	Description string       `json:"description"`
+	Amount      money.Amount `json:"amount"`
+	AssignedTo  []int        `json:"assigned_to"` // user IDs, all of them contributors
+}
+
+// ExpenseRevision is the expense as it looked before a change, plus who made that change and when.
+type ExpenseRevision struct {
+	Revision  int
+	Action    string // "update", "delete" or "restore"
+	ActorID   *int
+	CreatedAt time.Time
+	Snapshot  Expense
+}
+
 type GroupExpense struct {
-	ID        int     `json:"id"`
-	GroupID   int     `json:"group_id"`
-	Amount    float64 `json:"amount"`
-	SplitType string  `json:"split_type"`
+	ID        int          `json:"id"`
+	GroupID   int          `json:"group_id"`
+	Amount    money.Amount `json:"amount"`
+	SplitType string       `json:"split_type"`
 }
 
 type GroupExpenseRequest struct {
 	GroupID       int                  `json:"group_id"`
-	Amount        float64              `json:"amount"`
+	Amount        money.Amount         `json:"amount"`
 	SplitType     string               `json:"split_type"`
 	UserWhoPaid   int                  `json:"user_who_paid"`
 	UserAmountMap []UserAmountMapEntry `json:"user_amount_map"`
 }
 
+// PersonalExpenseRequest records a payment from PayerID to PayeeID outside any group. Amount is
+// optional and defaults to everything the payer owes; ExpiresInHours overrides how long the payee
+// has to confirm it.
 type PersonalExpenseRequest struct {
-	PayerID int     `json:"payer_id"`
-	PayeeID int     `json:"payee_id"`
-	Amount  float64 `json:"amount"`
+	PayerID          int           `json:"payer_id"`
+	PayeeID          int           `json:"payee_id"`
+	Amount           *money.Amount `json:"amount"`
+	Currency         string        `json:"currency"` // what the payment is made in; defaults to money.DefaultCurrency
+	AllowOverpayment bool          `json:"allow_overpayment"`
+	ExpiresInHours   *int          `json:"expires_in_hours"`
+}
+
+// GroupSettlementRequest is the optional body of a group settlement. Without an amount the full
+// outstanding balance is settled.
+type GroupSettlementRequest struct {
+	Amount           *money.Amount `json:"amount"`
+	Currency         string        `json:"currency"` // what the payment is made in; defaults to the group's base currency
+	AllowOverpayment bool          `json:"allow_overpayment"`
+	ExpiresInHours   *int          `json:"expires_in_hours"` // how long the creditor has to confirm
 }
 
 type UserAmountMapEntry struct {
-	UserID int     `json:"user_id"`
-	Amount float64 `json:"amount"`
+	UserID int          `json:"user_id"`
+	Amount money.Amount `json:"amount"`
 }
@@ -1,11 +1,31 @@
 package models
 
+import "time"
+
 type Group struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	BaseCurrency string     `json:"base_currency"`        // balances are reported in this currency; defaults to money.DefaultCurrency
+	CreatedAt    *time.Time `json:"created_at,omitempty"` // set by the server
 }
 
 type AddOrRemoveUserToGroupRequest struct {
 	GroupID int `json:"groupId"`
 	UserID  int `json:"userId"`
 }
+
+type RenameGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type ChangeCurrencyRequest struct {
+	BaseCurrency string `json:"base_currency"`
+}
+
+type ChangeRoleRequest struct {
+	Role Role `json:"role"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID int `json:"userId"`
+}
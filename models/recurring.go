@@ -0,0 +1,34 @@
+package models
+
+import "github.com/ashishsonamm/setu-splitwise/recurrence"
+
+// RecurringExpense is a template the scheduler turns into an ordinary expense on every date its
+// schedule falls on.
+type RecurringExpense struct {
+	ID      int     `json:"id"`
+	Expense Expense `json:"expense"` // what POST /api/expense would take; created_by and group_id are fixed at creation
+	recurrence.Schedule
+	NextOccurrence *recurrence.Date      `json:"next_occurrence"` // nil once the schedule has ended
+	Paused         bool                  `json:"paused"`
+	Occurrences    []RecurringOccurrence `json:"occurrences,omitempty"`
+}
+
+const (
+	OccurrenceCreated = "created"
+	OccurrenceSkipped = "skipped"
+	OccurrenceFailed  = "failed"
+)
+
+// RecurringOccurrence is a due date that has been handled.
+type RecurringOccurrence struct {
+	Date      recurrence.Date `json:"date"`
+	Status    string          `json:"status"` // OccurrenceCreated, OccurrenceSkipped or OccurrenceFailed
+	ExpenseID *int            `json:"expense_id,omitempty"`
+	Error     *string         `json:"error,omitempty"` // why the expense could not be created
+}
+
+// SkipOccurrenceRequest names the occurrence of a recurring expense to skip; the next one when Date
+// is omitted.
+type SkipOccurrenceRequest struct {
+	Date *recurrence.Date `json:"date"`
+}
@@ -0,0 +1,66 @@
+package models
+
+// Role is a member's standing within a group. Roles are ordered: owner > admin > member.
+type Role string
+
+const (
+	RoleMember Role = "member"
+	RoleAdmin  Role = "admin"
+	RoleOwner  Role = "owner"
+)
+
+var roleRank = map[Role]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// AtLeast reports whether r is the same as or above min.
+func (r Role) AtLeast(min Role) bool {
+	return roleRank[r] >= roleRank[min]
+}
+
+// Outranks reports whether r is strictly above other.
+func (r Role) Outranks(other Role) bool {
+	return roleRank[r] > roleRank[other]
+}
+
+// GroupAction names something a member can do to a group that needs more than plain membership.
+type GroupAction string
+
+const (
+	ActionAddMember         GroupAction = "add_member"
+	ActionRemoveMember      GroupAction = "remove_member"
+	ActionChangeRole        GroupAction = "change_role"
+	ActionTransferOwnership GroupAction = "transfer_ownership"
+	ActionRenameGroup       GroupAction = "rename_group"
+	ActionChangeCurrency    GroupAction = "change_currency"
+	ActionEditExpense       GroupAction = "edit_expense"
+	ActionDeleteExpense     GroupAction = "delete_expense"
+	ActionDeleteCategory    GroupAction = "delete_category"
+)
+
+// GroupPolicy is the minimum role required for each group action. New actions declare their
+// requirement here rather than hard-coding role checks in handlers.
+var GroupPolicy = map[GroupAction]Role{
+	ActionAddMember:         RoleAdmin,
+	ActionRemoveMember:      RoleAdmin,
+	ActionChangeRole:        RoleOwner,
+	ActionTransferOwnership: RoleOwner,
+	ActionRenameGroup:       RoleAdmin,
+	ActionChangeCurrency:    RoleAdmin,
+	ActionEditExpense:       RoleAdmin,
+	ActionDeleteExpense:     RoleAdmin,
+	ActionDeleteCategory:    RoleAdmin,
+}
+
+// Can reports whether a member with role r may perform the action. Unknown actions are denied.
+func (r Role) Can(action GroupAction) bool {
+	required, ok := GroupPolicy[action]
+	return ok && r.AtLeast(required)
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+)
+
+// SettlementStatus tracks whether a recorded payment counts towards balances. Only confirmed
+// settlements do.
+type SettlementStatus string
+
+const (
+	// SettlementPending is how the debtor records a payment; it waits for the creditor to confirm it.
+	SettlementPending   SettlementStatus = "pending"
+	SettlementConfirmed SettlementStatus = "confirmed"
+	SettlementRejected  SettlementStatus = "rejected"
+	// SettlementExpired is a pending settlement the creditor did not answer before it expired.
+	SettlementExpired SettlementStatus = "expired"
+	// SettlementDisputed is set by the creditor when they say a confirmed payment never arrived.
+	// Disputed settlements are left out of balances until the creditor confirms them again.
+	SettlementDisputed SettlementStatus = "disputed"
+)
+
+// Settlement is a payment recorded between two users, either inside a group or personally.
+type Settlement struct {
+	ID           int              `json:"id"`
+	Type         string           `json:"type"` // "group" or "personal"
+	GroupID      *int             `json:"group_id,omitempty"`
+	DebtorID     int              `json:"debtor_id"`
+	CreditorID   int              `json:"creditor_id"`
+	Amount       money.Amount     `json:"amount"`
+	Currency     string           `json:"currency"`
+	Status       SettlementStatus `json:"status"`
+	ReversalOf   *int             `json:"reversal_of,omitempty"` // set on compensating entries
+	ReversedBy   *int             `json:"reversed_by,omitempty"` // ID of the entry that reversed this one
+	CreatedBy    *int             `json:"created_by,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	ExpiresAt    *time.Time       `json:"expires_at,omitempty"`    // when a pending settlement lapses
+	RespondedAt  *time.Time       `json:"responded_at,omitempty"`  // when the creditor last changed the status
+	StatusReason *string          `json:"status_reason,omitempty"` // why it was disputed or rejected
+	ExchangeRate *rates.Snapshot  `json:"-"`                       // from Currency to the balance's currency, taken when recorded
+}
+
+// InLocation shows the settlement's timestamps in loc, such as the time zone of the user viewing it.
+func (s *Settlement) InLocation(loc *time.Location) {
+	s.CreatedAt = s.CreatedAt.In(loc)
+	for _, t := range []**time.Time{&s.ExpiresAt, &s.RespondedAt} {
+		if *t != nil {
+			local := (*t).In(loc)
+			*t = &local
+		}
+	}
+}
+
+// SettlementStatusRequest carries the creditor's reason for disputing or rejecting a settlement.
+type SettlementStatusRequest struct {
+	Reason string `json:"reason"`
+}
@@ -2,9 +2,22 @@ package models
 
 type User struct {
 	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"-"`         // bcrypt hash, never serialized
+	TimeZone string `json:"time_zone"` // IANA name such as "Asia/Kolkata"
+	IsAdmin  bool   `json:"-"`         // site administrator
+}
+
+type CreateUserRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	TimeZone string `json:"time_zone,omitempty"` // defaults to UTC
+}
+
+type UpdateTimeZoneRequest struct {
+	TimeZone string `json:"time_zone"`
 }
 
 type LoginRequest struct {
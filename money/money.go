@@ -0,0 +1,255 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of minor units in one major unit (paise per rupee, cents per dollar).
+const Scale = 100
+
+// DefaultCurrency is used when an expense or settlement does not specify one.
+const DefaultCurrency = "INR"
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Amount is a monetary value stored as an exact number of minor units.
+// On the wire it is a decimal number with at most two fractional digits.
+type Amount int64
+
+// Money is an amount together with its ISO 4217 currency code.
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Parse converts a decimal string such as "100", "-3.5" or "33.33" into minor units.
+// More than two fractional digits are rejected rather than silently rounded.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: more than two decimal places", ErrInvalidAmount)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseUint(whole, 10, 63)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	cents, err := strconv.ParseUint(frac, 10, 8)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	if units > (1<<63-1-cents)/Scale {
+		return 0, fmt.Errorf("%w: out of range", ErrInvalidAmount)
+	}
+
+	value := Amount(units*Scale + cents)
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// String formats the amount as a decimal with two fractional digits.
+func (a Amount) String() string {
+	sign := ""
+	v := uint64(a)
+	if a < 0 {
+		sign = "-"
+		v = uint64(-a)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/Scale, v%Scale)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and numeric strings without going through float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+		s = n.String()
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported", ErrInvalidAmount)
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Hundredths is a quantity other than money kept to two decimal places, such as a percentage or a
+// share: 33.33 is 3333. It is parsed and written exactly like an Amount.
+type Hundredths int64
+
+func (h Hundredths) String() string {
+	return Amount(h).String()
+}
+
+func (h Hundredths) MarshalJSON() ([]byte, error) {
+	return Amount(h).MarshalJSON()
+}
+
+func (h *Hundredths) UnmarshalJSON(data []byte) error {
+	return (*Amount)(h).UnmarshalJSON(data)
+}
+
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Sum adds up a list of amounts.
+func Sum(amounts []Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
+
+// Allocate splits total across the given non-negative weights so that the parts always add up to
+// total exactly. Each part first gets its proportional floor; the leftover minor units go one at a time
+// to the largest remainders, ties broken by position so the same input always yields the same split.
+func Allocate(total Amount, weights []int64) ([]Amount, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("no weights to allocate across")
+	}
+
+	var weightSum int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, errors.New("weights must not be negative")
+		}
+		if w > math.MaxInt64-weightSum {
+			return nil, errors.New("weights add up to more than the largest amount")
+		}
+		weightSum += w
+	}
+	if weightSum == 0 {
+		return nil, errors.New("weights must not all be zero")
+	}
+
+	negative := total < 0
+	remaining := total.Abs()
+
+	parts := make([]Amount, len(weights))
+	remainders := make([]int64, len(weights))
+	var allocated Amount
+	for i, w := range weights {
+		hi, lo := bits.Mul64(uint64(remaining), uint64(w))
+		quo, rem := bits.Div64(hi, lo, uint64(weightSum))
+		parts[i] = Amount(quo)
+		remainders[i] = int64(rem)
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+
+	for i := 0; allocated < remaining; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+
+	if negative {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts, nil
+}
+
+// Convert multiplies an amount by an exchange rate, rounding half away from zero to the nearest minor
+// unit. Every currency is assumed to have Scale minor units.
+func Convert(a Amount, rate *big.Rat) (Amount, error) {
+	if rate.Sign() <= 0 {
+		return 0, errors.New("exchange rate must be positive")
+	}
+
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), rate)
+	num, denom := product.Num(), product.Denom()
+	quo, rem := new(big.Int).QuoRem(num, denom, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(denom) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: converted amount is out of range", ErrInvalidAmount)
+	}
+	return Amount(quo.Int64()), nil
+}
+
+// Equal splits total into n parts that differ by at most one minor unit.
+func Equal(total Amount, n int) ([]Amount, error) {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return Allocate(total, weights)
+}
+
+// NormalizeCurrency upper-cases a currency code and falls back to DefaultCurrency when empty.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency code %q", code)
+		}
+	}
+	return code, nil
+}
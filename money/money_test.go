@@ -0,0 +1,168 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: "100", want: 10000},
+		{in: "33.33", want: 3333},
+		{in: "-3.5", want: -350},
+		{in: "+.5", want: 50},
+		{in: " 7. ", want: 700},
+		{in: "0.00", want: 0},
+		{in: "92233720368547758.07", want: math.MaxInt64},
+		{in: "-92233720368547758.07", want: -math.MaxInt64},
+		{in: "92233720368547758.08", wantErr: true},
+		{in: "100000000000000000", wantErr: true},
+		{in: "1.005", wantErr: true},
+		{in: "0.001", wantErr: true},
+		{in: "1e2", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "1.-5", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "12abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Parse(%q) = %d, %v; want ErrInvalidAmount", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	var decoded struct {
+		Number Amount  `json:"number"`
+		String Amount  `json:"string"`
+		Null   *Amount `json:"null"`
+	}
+	if err := json.Unmarshal([]byte(`{"number": 12.34, "string": "-0.5", "null": null}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Number != 1234 || decoded.String != -50 || decoded.Null != nil {
+		t.Fatalf("got %+v", decoded)
+	}
+
+	for _, in := range []string{`1e2`, `"1E2"`, `1.234`, `"abc"`, `true`, `"12.50`, `12.50"`, `"12"50"`, `NaN`} {
+		var a Amount
+		if err := json.Unmarshal([]byte(in), &a); err == nil {
+			t.Errorf("Unmarshal(%s) = %d; want an error", in, a)
+		}
+	}
+
+	encoded, err := json.Marshal(map[string]Amount{"a": -1, "b": 10000, "c": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"a":-0.01,"b":100.00,"c":0.05}` {
+		t.Fatalf("got %s", encoded)
+	}
+}
+
+func TestHundredthsJSON(t *testing.T) {
+	var decoded []Hundredths
+	if err := json.Unmarshal([]byte(`[33.33, "12.5", 100]`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 3 || decoded[0] != 3333 || decoded[1] != 1250 || decoded[2] != 10000 {
+		t.Fatalf("got %v", decoded)
+	}
+	// 33.333 must not round into 33.33.
+	for _, in := range []string{`33.333`, `"NaN"`, `"Inf"`, `1e300`, `92233720368547758.08`} {
+		var h Hundredths
+		if err := json.Unmarshal([]byte(in), &h); err == nil {
+			t.Errorf("Unmarshal(%s) = %d; want an error", in, h)
+		}
+	}
+	if encoded, _ := json.Marshal(Hundredths(3333)); string(encoded) != "33.33" {
+		t.Fatalf("got %s", encoded)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   Amount
+		weights []int64
+		want    []Amount
+		wantErr bool
+	}{
+		// The request's own example: 100 three ways is 33.34 + 33.33 + 33.33, never 99.99.
+		{name: "100 three ways", total: 10000, weights: []int64{1, 1, 1}, want: []Amount{3334, 3333, 3333}},
+		{name: "proportional", total: 1000, weights: []int64{1, 2, 2}, want: []Amount{200, 400, 400}},
+		{name: "largest remainder wins", total: 100, weights: []int64{3, 3, 4}, want: []Amount{30, 30, 40}},
+		{name: "ties go to the first", total: 2, weights: []int64{1, 1, 1}, want: []Amount{1, 1, 0}},
+		{name: "negative total", total: -10000, weights: []int64{1, 1, 1}, want: []Amount{-3334, -3333, -3333}},
+		{name: "zero weight gets nothing", total: 101, weights: []int64{0, 1, 1}, want: []Amount{0, 51, 50}},
+		{name: "zero total", total: 0, weights: []int64{1, 2}, want: []Amount{0, 0}},
+		{name: "largest amount", total: math.MaxInt64, weights: []int64{math.MaxInt64 / 2, math.MaxInt64 / 2}, want: []Amount{math.MaxInt64/2 + 1, math.MaxInt64 / 2}},
+		{name: "weights overflow", total: 100, weights: []int64{math.MaxInt64, 1}, wantErr: true},
+		{name: "all zero weights", total: 100, weights: []int64{0, 0}, wantErr: true},
+		{name: "negative weight", total: 100, weights: []int64{2, -1}, wantErr: true},
+		{name: "no weights", total: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allocate(tt.total, tt.weights)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v; want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			if Sum(got) != tt.total {
+				t.Fatalf("parts %v add up to %d, not %d", got, Sum(got), tt.total)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	for _, total := range []Amount{10000, 1, -7, 99999, 0} {
+		for n := 1; n <= 7; n++ {
+			parts, err := Equal(total, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != n || Sum(parts) != total {
+				t.Fatalf("Equal(%d, %d) = %v", total, n, parts)
+			}
+			for _, p := range parts {
+				if d := (p - parts[0]).Abs(); d > 1 {
+					t.Fatalf("Equal(%d, %d) = %v: parts differ by %d", total, n, parts, d)
+				}
+			}
+		}
+	}
+	if _, err := Equal(100, 0); err == nil {
+		t.Fatal("Equal across no parts succeeded")
+	}
+}
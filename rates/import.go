@@ -0,0 +1,206 @@
+package rates
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Format names an exchange-rate dump layout accepted by Parse.
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// Parse reads rates in any of the supported layouts:
+//
+//   - CSV with a header naming date, base, quote and rate columns, one rate per row;
+//   - ECB-style CSV (eurofxref-hist.csv): a Date column, then one column per currency quoted
+//     against the euro, with N/A for days a currency has no rate;
+//   - a JSON array of {"base", "quote", "date", "rate"} objects;
+//   - ECB-style JSON: {"base": "EUR", "date": "2024-01-02", "rates": {"USD": 1.0956}}, or the
+//     time-series form with "rates" keyed by date. base defaults to EUR.
+func Parse(r io.Reader, format Format) ([]Rate, error) {
+	switch format {
+	case FormatCSV:
+		return ParseCSV(r)
+	case FormatJSON:
+		return ParseJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported rate format %q", format)
+	}
+}
+
+// ParseCSV reads either CSV layout described on Parse, telling them apart by the header.
+func ParseCSV(r io.Reader) ([]Rate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["date"]; !ok {
+		return nil, errors.New("CSV header is missing the date column")
+	}
+	_, hasBase := columns["base"]
+	_, hasQuote := columns["quote"]
+	_, hasRate := columns["rate"]
+	if !hasBase && !hasQuote && !hasRate {
+		return parseECBCSV(reader, header, columns["date"])
+	}
+	for _, name := range []string{"base", "quote", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", name)
+		}
+	}
+
+	var rates []Rate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < len(header) {
+			return nil, fmt.Errorf("line %d: expected %d fields, got %d", line, len(header), len(record))
+		}
+		rate, err := NewRate(record[columns["base"]], record[columns["quote"]], record[columns["date"]], record[columns["rate"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+}
+
+// parseECBCSV reads the wide ECB layout once the header has been consumed.
+func parseECBCSV(reader *csv.Reader, header []string, dateColumn int) ([]Rate, error) {
+	var rates []Rate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if i == dateColumn || i >= len(header) || strings.TrimSpace(header[i]) == "" || value == "" || value == "N/A" {
+				continue
+			}
+			rate, err := NewRate(Pivot, header[i], record[dateColumn], value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			rates = append(rates, rate)
+		}
+	}
+}
+
+type ecbJSON struct {
+	Base  string                     `json:"base"`
+	Date  string                     `json:"date"`
+	Rates map[string]json.RawMessage `json:"rates"`
+}
+
+// ParseJSON reads either JSON layout described on Parse.
+func ParseJSON(r io.Reader) ([]Rate, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var rates []Rate
+		if err := json.Unmarshal(data, &rates); err != nil {
+			return nil, err
+		}
+		return rates, nil
+	}
+
+	var dump ecbJSON
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, err
+	}
+	if dump.Base == "" {
+		dump.Base = Pivot
+	}
+
+	// A single day maps currencies to rates; a time series maps dates to such maps.
+	byDate := map[string]map[string]json.RawMessage{}
+	if dump.Date != "" {
+		byDate[dump.Date] = dump.Rates
+	} else {
+		for date, raw := range dump.Rates {
+			var day map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &day); err != nil {
+				return nil, fmt.Errorf("rates for %s: %w", date, err)
+			}
+			byDate[date] = day
+		}
+	}
+
+	var rates []Rate
+	for _, date := range sortedKeys(byDate) {
+		for _, quote := range sortedKeys(byDate[date]) {
+			value := strings.Trim(string(byDate[date][quote]), `"`)
+			if strings.EqualFold(quote, dump.Base) {
+				continue
+			}
+			rate, err := NewRate(dump.Base, quote, date, value)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ImportFile loads a rate dump into s and returns how many rates it held. The layout is picked from
+// the file extension: .json for JSON, anything else as CSV.
+func ImportFile(s Storage, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	format := FormatCSV
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = FormatJSON
+	}
+
+	rates, err := Parse(f, format)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return len(rates), s.Save(context.Background(), rates)
+}
@@ -0,0 +1,103 @@
+package rates
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ecbCSV is eurofxref-hist.csv in miniature: newest first, N/A for days without a rate, and the
+// trailing comma the ECB puts on every line.
+const ecbCSV = `Date,USD,JPY,INR,
+2024-01-03,1.0919,155.52,N/A,
+2024-01-02,1.0956,155.94,91.2345,
+`
+
+const timeSeriesJSON = `{
+	"base": "EUR",
+	"rates": {
+		"2024-01-03": {"USD": 1.0919},
+		"2024-01-02": {"USD": 1.0956, "GBP": "0.86"}
+	}
+}`
+
+func day(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(DateLayout, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func rat(t *testing.T, s string) *big.Rat {
+	t.Helper()
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		t.Fatalf("bad rational %q", s)
+	}
+	return r
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		dump   string
+		want   []string // base/quote date rate, sorted
+	}{
+		{name: "ECB CSV", format: FormatCSV, dump: ecbCSV, want: []string{
+			"EUR/INR 2024-01-02 91.2345",
+			"EUR/JPY 2024-01-02 155.94",
+			"EUR/JPY 2024-01-03 155.52",
+			"EUR/USD 2024-01-02 1.0956",
+			"EUR/USD 2024-01-03 1.0919",
+		}},
+		{name: "one rate per row", format: FormatCSV, dump: "date,base,quote,rate\n2024-01-02,GBP,USD,1.27\n", want: []string{
+			"GBP/USD 2024-01-02 1.27",
+		}},
+		{name: "ECB time series", format: FormatJSON, dump: timeSeriesJSON, want: []string{
+			"EUR/GBP 2024-01-02 0.86",
+			"EUR/USD 2024-01-02 1.0956",
+			"EUR/USD 2024-01-03 1.0919",
+		}},
+		{name: "array", format: FormatJSON, dump: `[{"base": "USD", "quote": "JPY", "date": "2024-01-02", "rate": "141.5"}]`, want: []string{
+			"USD/JPY 2024-01-02 141.5",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(strings.NewReader(tt.dump), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(parsed))
+			for i, r := range parsed {
+				got[i] = fmt.Sprintf("%s/%s %s %s", r.Base, r.Quote, r.Date.Format(DateLayout), FormatRate(r.Value))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	dumps := map[string]string{
+		"no date column": "base,quote,rate\nEUR,USD,1.1\n",
+		"negative rate":  "date,base,quote,rate\n2024-01-02,EUR,USD,-1.1\n",
+		"bad date":       "date,base,quote,rate\n02/01/2024,EUR,USD,1.1\n",
+	}
+	for name, dump := range dumps {
+		if _, err := Parse(strings.NewReader(dump), FormatCSV); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if _, err := Parse(strings.NewReader(ecbCSV), "xml"); err == nil {
+		t.Error("an unknown format was accepted")
+	}
+}
@@ -0,0 +1,84 @@
+package rates
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Memory is Storage kept in memory. It answers lookups exactly as the exchange_rates table does.
+type Memory struct {
+	mu    sync.RWMutex
+	rates map[memoryKey]*big.Rat
+}
+
+type memoryKey struct {
+	base, quote string
+	date        string // DateLayout, as the rate_date column compares
+}
+
+func NewMemory() *Memory {
+	return &Memory{rates: make(map[memoryKey]*big.Rat)}
+}
+
+func (m *Memory) Rate(from, to string, date time.Time) (*big.Rat, error) {
+	return Cross(from, to, date, m.pairRate)
+}
+
+// Save stores rates, replacing any already stored for the same pair and date. Values are rounded as
+// the exchange_rates column would round them.
+func (m *Memory) Save(ctx context.Context, rates []Rate) error {
+	stored := make(map[memoryKey]*big.Rat, len(rates))
+	for _, rate := range rates {
+		value, err := ParseRate(FormatRate(rate.Value))
+		if err != nil {
+			return err
+		}
+		stored[memoryKey{base: rate.Base, quote: rate.Quote, date: rate.Date.Format(DateLayout)}] = value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, value := range stored {
+		m.rates[key] = value
+	}
+	return nil
+}
+
+// pairRate is the latest direct or inverted rate between two currencies on or before date.
+func (m *Memory) pairRate(from, to string, date time.Time) (*big.Rat, error) {
+	day := date.Format(DateLayout)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var best *big.Rat
+	var bestDay string
+	var bestInverse bool
+	for key, value := range m.rates {
+		var inverse bool
+		switch {
+		case key.base == from && key.quote == to:
+		case key.base == to && key.quote == from:
+			inverse = true
+		default:
+			continue
+		}
+		if key.date > day {
+			continue
+		}
+		if best == nil || key.date > bestDay || (key.date == bestDay && bestInverse && !inverse) {
+			best, bestDay, bestInverse = value, key.date, inverse
+		}
+	}
+	if best == nil {
+		return nil, ErrNoRate
+	}
+
+	rate := new(big.Rat).Set(best)
+	if bestInverse {
+		rate.Inv(rate)
+	}
+	return rate, nil
+}
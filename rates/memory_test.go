@@ -0,0 +1,112 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, format Format, dump string) *Memory {
+	t.Helper()
+	parsed, err := Parse(strings.NewReader(dump), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMemory()
+	if err := m.Save(context.Background(), parsed); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMemoryRate(t *testing.T) {
+	csv := load(t, FormatCSV, ecbCSV)
+	series := load(t, FormatJSON, timeSeriesJSON)
+
+	tests := []struct {
+		name     string
+		m        *Memory
+		from, to string
+		date     string
+		want     string // a big.Rat; empty for ErrNoRate
+	}{
+		{name: "direct", m: csv, from: "EUR", to: "USD", date: "2024-01-03", want: "1.0919"},
+		{name: "inverse", m: csv, from: "USD", to: "EUR", date: "2024-01-03", want: "10000/10919"},
+		{name: "same currency", m: csv, from: "CHF", to: "CHF", date: "2024-01-03", want: "1"},
+		{name: "N/A falls back a day", m: csv, from: "EUR", to: "INR", date: "2024-01-03", want: "91.2345"},
+		{name: "weekend uses Friday's", m: csv, from: "EUR", to: "JPY", date: "2024-01-06", want: "155.52"},
+		{name: "earlier date", m: csv, from: "EUR", to: "USD", date: "2024-01-02", want: "1.0956"},
+		{name: "through EUR", m: csv, from: "USD", to: "JPY", date: "2024-01-02", want: "155.94/1.0956"},
+		{name: "through EUR on mixed dates", m: csv, from: "USD", to: "INR", date: "2024-01-03", want: "91.2345/1.0919"},
+		{name: "before the first rate", m: csv, from: "EUR", to: "USD", date: "2024-01-01"},
+		{name: "unknown currency", m: csv, from: "USD", to: "CHF", date: "2024-01-03"},
+		{name: "time series", m: series, from: "EUR", to: "USD", date: "2024-01-03", want: "1.0919"},
+		{name: "time series string rate", m: series, from: "GBP", to: "EUR", date: "2024-01-03", want: "1/0.86"},
+		{name: "time series through EUR", m: series, from: "USD", to: "GBP", date: "2024-01-02", want: "0.86/1.0956"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Rate(tt.from, tt.to, day(t, tt.date))
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoRate) {
+					t.Fatalf("got %v, %v; want ErrNoRate", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := wantRat(t, tt.want)
+			if got.Cmp(want) != 0 {
+				t.Fatalf("got %s, want %s", got.RatString(), want.RatString())
+			}
+		})
+	}
+}
+
+// wantRat reads "a" or "a/b" where a and b may be decimals.
+func wantRat(t *testing.T, s string) *big.Rat {
+	t.Helper()
+	num, den, ok := strings.Cut(s, "/")
+	r := rat(t, num)
+	if ok {
+		r.Quo(r, rat(t, den))
+	}
+	return r
+}
+
+func TestMemorySave(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	third := Rate{Base: "EUR", Quote: "USD", Date: day(t, "2024-01-02"), Value: big.NewRat(1, 3)}
+	if err := m.Save(ctx, []Rate{third}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Kept to 12 decimal places, like the exchange_rates column.
+	got, err := m.Rate("EUR", "USD", day(t, "2024-01-02"))
+	if err != nil || got.Cmp(rat(t, "0.333333333333")) != 0 {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	// A later save replaces the same pair and date.
+	if err := m.Save(ctx, []Rate{{Base: "EUR", Quote: "USD", Date: third.Date, Value: rat(t, "1.1")}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Rate("EUR", "USD", third.Date); got.Cmp(rat(t, "1.1")) != 0 {
+		t.Fatalf("after replacing: got %s", got.RatString())
+	}
+
+	// On a day with rates both ways, each direction uses its own.
+	if err := m.Save(ctx, []Rate{{Base: "USD", Quote: "EUR", Date: third.Date, Value: rat(t, "0.9")}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Rate("USD", "EUR", third.Date); got.Cmp(rat(t, "0.9")) != 0 {
+		t.Fatalf("USD/EUR: got %s", got.RatString())
+	}
+	if got, _ := m.Rate("EUR", "USD", third.Date); got.Cmp(rat(t, "1.1")) != 0 {
+		t.Fatalf("EUR/USD: got %s", got.RatString())
+	}
+}
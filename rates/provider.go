@@ -0,0 +1,114 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Pivot is the currency rates are triangulated through when a pair has no rate of its own. ECB dumps
+// quote every currency against the euro.
+const Pivot = "EUR"
+
+// ExchangeRateProvider gives how many units of to one unit of from was worth on a date.
+type ExchangeRateProvider interface {
+	Rate(from, to string, date time.Time) (*big.Rat, error)
+}
+
+// Storage is an ExchangeRateProvider that rates can also be imported into. The repositories
+// implement it, on the application database or in memory.
+type Storage interface {
+	ExchangeRateProvider
+	Save(ctx context.Context, rates []Rate) error
+}
+
+// Cross finds the rate from one currency to another with pair, which looks up the latest direct or
+// inverted rate of a single pair and returns a bare ErrNoRate when there is none. Pairs with no rate
+// of their own are crossed through Pivot.
+func Cross(from, to string, date time.Time, pair func(from, to string, date time.Time) (*big.Rat, error)) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	rate, err := pair(from, to, date)
+	if !errors.Is(err, ErrNoRate) {
+		return rate, err
+	}
+
+	if from != Pivot && to != Pivot {
+		fromPivot, err := pair(from, Pivot, date)
+		if err != nil && !errors.Is(err, ErrNoRate) {
+			return nil, err
+		}
+		pivotTo, err2 := pair(Pivot, to, date)
+		if err2 != nil && !errors.Is(err2, ErrNoRate) {
+			return nil, err2
+		}
+		if err == nil && err2 == nil {
+			return fromPivot.Mul(fromPivot, pivotTo), nil
+		}
+	}
+	return nil, fmt.Errorf("%w from %s to %s on or before %s", ErrNoRate, from, to, date.Format(DateLayout))
+}
+
+// maxCacheEntries bounds the cache; it is emptied when full rather than tracking recency.
+const maxCacheEntries = 10000
+
+type cacheKey struct {
+	from, to string
+	day      string
+}
+
+// Cache is a Storage that remembers the rates the one behind it returned, per currency pair and day.
+// Misses are not cached, so a rate imported later is picked up straight away, and saving rates through
+// the cache forgets every rate it holds.
+type Cache struct {
+	next    Storage
+	mu      sync.RWMutex
+	entries map[cacheKey]*big.Rat
+}
+
+func NewCache(next Storage) *Cache {
+	return &Cache{next: next, entries: make(map[cacheKey]*big.Rat)}
+}
+
+func (c *Cache) Rate(from, to string, date time.Time) (*big.Rat, error) {
+	key := cacheKey{from: from, to: to, day: date.Format(DateLayout)}
+
+	c.mu.RLock()
+	rate, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok {
+		return new(big.Rat).Set(rate), nil
+	}
+
+	rate, err := c.next.Rate(from, to, date)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= maxCacheEntries {
+		c.entries = make(map[cacheKey]*big.Rat)
+	}
+	c.entries[key] = new(big.Rat).Set(rate)
+	c.mu.Unlock()
+	return rate, nil
+}
+
+// Save stores rates behind the cache and drops every cached lookup they might change.
+func (c *Cache) Save(ctx context.Context, rates []Rate) error {
+	err := c.next.Save(ctx, rates)
+	c.Clear()
+	return err
+}
+
+// Clear forgets every cached rate.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	c.entries = make(map[cacheKey]*big.Rat)
+	c.mu.Unlock()
+}
@@ -0,0 +1,114 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// countingStorage has one rate per pair, whatever the date, and counts the lookups it answers.
+type countingStorage struct {
+	rates   map[string]*big.Rat // by "FROM/TO"
+	lookups int
+}
+
+func (s *countingStorage) Rate(from, to string, date time.Time) (*big.Rat, error) {
+	s.lookups++
+	rate, ok := s.rates[from+"/"+to]
+	if !ok {
+		return nil, ErrNoRate
+	}
+	return new(big.Rat).Set(rate), nil
+}
+
+func (s *countingStorage) Save(ctx context.Context, rates []Rate) error {
+	for _, r := range rates {
+		s.rates[r.Base+"/"+r.Quote] = r.Value
+	}
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	p := &countingStorage{rates: map[string]*big.Rat{"EUR/USD": big.NewRat(11, 10)}}
+	c := NewCache(p)
+	date := day(t, "2024-01-02")
+
+	for i := 0; i < 2; i++ {
+		if got, err := c.Rate("EUR", "USD", date); err != nil || got.Cmp(big.NewRat(11, 10)) != 0 {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	}
+	if p.lookups != 1 {
+		t.Fatalf("a cached rate was looked up again: %d lookups", p.lookups)
+	}
+	if _, err := c.Rate("EUR", "USD", day(t, "2024-01-03")); err != nil || p.lookups != 2 {
+		t.Fatalf("another day: %v after %d lookups", err, p.lookups)
+	}
+
+	// Misses are not cached, so a rate that turns up later is used straight away.
+	if _, err := c.Rate("EUR", "GBP", date); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("missing pair: got %v", err)
+	}
+	p.rates["EUR/GBP"] = big.NewRat(86, 100)
+	if got, err := c.Rate("EUR", "GBP", date); err != nil || got.Cmp(big.NewRat(86, 100)) != 0 {
+		t.Fatalf("after adding the pair: got %v, %v", got, err)
+	}
+
+	p.rates["EUR/USD"] = big.NewRat(12, 10)
+	c.Clear()
+	if got, _ := c.Rate("EUR", "USD", date); got.Cmp(big.NewRat(12, 10)) != 0 {
+		t.Fatalf("after Clear: got %s", got.RatString())
+	}
+}
+
+func TestCacheReturnsCopies(t *testing.T) {
+	c := NewCache(&countingStorage{rates: map[string]*big.Rat{"EUR/USD": big.NewRat(11, 10)}})
+	date := day(t, "2024-01-02")
+
+	first, err := c.Rate("EUR", "USD", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.SetInt64(0)
+	if second, _ := c.Rate("EUR", "USD", date); second.Cmp(big.NewRat(11, 10)) != 0 {
+		t.Fatalf("a caller's change reached the cache: got %s", second.RatString())
+	}
+}
+
+func TestCacheSaveClearsCache(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	c := NewCache(m)
+	date := day(t, "2024-01-02")
+	eurUSD := func(value string) Rate {
+		return Rate{Base: "EUR", Quote: "USD", Date: date, Value: rat(t, value)}
+	}
+
+	if _, err := c.Rate("EUR", "USD", date); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("empty store: got %v", err)
+	}
+	if err := c.Save(ctx, []Rate{eurUSD("1.1")}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Rate("EUR", "USD", date); err != nil || got.Cmp(rat(t, "1.1")) != 0 {
+		t.Fatalf("after the first save: got %v, %v", got, err)
+	}
+
+	// Saved behind the cache's back, the new rate is not seen...
+	if err := m.Save(ctx, []Rate{eurUSD("1.2")}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Rate("EUR", "USD", date); got.Cmp(rat(t, "1.1")) != 0 {
+		t.Fatalf("cached lookup: got %s", got.RatString())
+	}
+
+	// ...but saving through the cache drops what it held.
+	if err := c.Save(ctx, []Rate{eurUSD("1.3")}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Rate("EUR", "USD", date); got.Cmp(rat(t, "1.3")) != 0 {
+		t.Fatalf("after the second save: got %s", got.RatString())
+	}
+}
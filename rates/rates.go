@@ -0,0 +1,179 @@
+// Package rates stores dated exchange rates and converts amounts between currencies with them.
+package rates
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/money"
+)
+
+// DateLayout is how rate dates are written in JSON and CSV.
+const DateLayout = "2006-01-02"
+
+// ErrNoRate is returned when no rate is known for a currency pair on or before the requested date.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rate says that one unit of Base is worth Value units of Quote on Date.
+type Rate struct {
+	Base  string
+	Quote string
+	Date  time.Time
+	Value *big.Rat
+}
+
+type rateJSON struct {
+	Base  string          `json:"base"`
+	Quote string          `json:"quote"`
+	Date  string          `json:"date"`
+	Rate  json.RawMessage `json:"rate"`
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rateJSON{
+		Base:  r.Base,
+		Quote: r.Quote,
+		Date:  r.Date.Format(DateLayout),
+		Rate:  json.RawMessage(FormatRate(r.Value)),
+	})
+}
+
+// UnmarshalJSON accepts the rate as a JSON number or a decimal string.
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	var raw rateJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rate, err := NewRate(raw.Base, raw.Quote, raw.Date, strings.Trim(string(raw.Rate), `"`))
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// NewRate parses and validates one rate from its text fields.
+func NewRate(base, quote, date, value string) (Rate, error) {
+	var rate Rate
+	var err error
+	if rate.Base, err = money.NormalizeCurrency(base); err != nil || strings.TrimSpace(base) == "" {
+		return Rate{}, fmt.Errorf("invalid base currency %q", base)
+	}
+	if rate.Quote, err = money.NormalizeCurrency(quote); err != nil || strings.TrimSpace(quote) == "" {
+		return Rate{}, fmt.Errorf("invalid quote currency %q", quote)
+	}
+	if rate.Base == rate.Quote {
+		return Rate{}, fmt.Errorf("base and quote currency are both %s", rate.Base)
+	}
+	if rate.Date, err = time.Parse(DateLayout, strings.TrimSpace(date)); err != nil {
+		return Rate{}, fmt.Errorf("invalid rate date %q: use YYYY-MM-DD", date)
+	}
+	if rate.Value, err = ParseRate(value); err != nil {
+		return Rate{}, err
+	}
+	return rate, nil
+}
+
+// ParseRate reads a positive decimal rate, as stored or imported.
+func ParseRate(value string) (*big.Rat, error) {
+	value = strings.TrimSpace(value)
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok || strings.ContainsAny(value, "eE/") || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid rate %q: must be a positive decimal", value)
+	}
+	return rate, nil
+}
+
+// FormatRate writes a rate to 12 decimal places, as the exchange_rates column keeps it, without
+// trailing zeros.
+func FormatRate(value *big.Rat) string {
+	s := strings.TrimRight(value.FloatString(12), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Snapshot is the rate an amount is converted with into Currency, stored with the amount when it is
+// recorded so that importing new rates later never changes what it was worth.
+type Snapshot struct {
+	Currency string
+	Rate     *big.Rat
+}
+
+type snapshotJSON struct {
+	Currency string          `json:"currency"`
+	Rate     json.RawMessage `json:"rate"`
+}
+
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(snapshotJSON{Currency: s.Currency, Rate: json.RawMessage(FormatRate(s.Rate))})
+}
+
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	var raw snapshotJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rate, err := ParseRate(strings.Trim(string(raw.Rate), `"`))
+	if err != nil {
+		return err
+	}
+	*s = Snapshot{Currency: raw.Currency, Rate: rate}
+	return nil
+}
+
+// Take looks up the rate from currency to target on date in p. It returns nil when the two are the
+// same or no rate is known yet; such amounts are converted at whatever rate is current when they are
+// read.
+func Take(p ExchangeRateProvider, from, to string, date time.Time) (*Snapshot, error) {
+	if from == to {
+		return nil, nil
+	}
+	rate, err := p.Rate(from, to, date)
+	if errors.Is(err, ErrNoRate) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Currency: to, Rate: rate}, nil
+}
+
+// ScanSnapshot builds a snapshot from its nullable exchange_rate and rate_currency columns.
+func ScanSnapshot(rate, currency sql.NullString) (*Snapshot, error) {
+	if !rate.Valid || !currency.Valid {
+		return nil, nil
+	}
+	value, err := ParseRate(rate.String)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Currency: currency.String, Rate: value}, nil
+}
+
+// Columns returns the values to store in the exchange_rate and rate_currency columns; both are NULL
+// for a nil snapshot.
+func (s *Snapshot) Columns() (rate, currency interface{}) {
+	if s == nil {
+		return nil, nil
+	}
+	return FormatRate(s.Rate), s.Currency
+}
+
+// Convert expresses amount, in currency from, in currency to at the rate p has for date. A snapshot
+// taken for the same target currency is used instead of looking the rate up.
+func Convert(p ExchangeRateProvider, amount money.Amount, from, to string, date time.Time, snapshot *Snapshot) (money.Amount, error) {
+	if from == to {
+		return amount, nil
+	}
+	if snapshot != nil && snapshot.Currency == to {
+		return money.Convert(amount, snapshot.Rate)
+	}
+	rate, err := p.Rate(from, to, date)
+	if err != nil {
+		return 0, err
+	}
+	return money.Convert(amount, rate)
+}
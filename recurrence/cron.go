@@ -0,0 +1,123 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cron is a parsed cron-like day expression.
+type Cron struct {
+	days, months, weekdays uint64 // bit n set when value n matches
+	anyDay, anyWeekday     bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// ParseCron reads an expression with three fields, day of month, month and day of week, matched
+// like the last three fields of a crontab line:
+//
+//	"1 * *"        the first of every month
+//	"1,15 * *"     the first and fifteenth
+//	"* * 1-5"      every weekday
+//	"*/2 1-6 *"    odd days from January to June
+//
+// Each field is *, a number, a range a-b, any of those followed by /step, or a comma-separated list.
+// When both the day of month and the day of week are restricted, a day matching either one matches.
+// A five-field crontab line is also accepted; its minute and hour must be single numbers, since
+// occurrences are whole days, and are otherwise ignored.
+func ParseCron(expr string) (Cron, error) {
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 3:
+	case 5:
+		for i, name := range []string{"minute", "hour"} {
+			if _, err := strconv.Atoi(fields[i]); err != nil {
+				return Cron{}, fmt.Errorf("cron %s must be a single number: occurrences are whole days", name)
+			}
+		}
+		fields = fields[2:]
+	default:
+		return Cron{}, fmt.Errorf("cron expression %q must have 3 fields (day of month, month, day of week)", expr)
+	}
+
+	var c Cron
+	var err error
+	masks := []*uint64{&c.days, &c.months, &c.weekdays}
+	for i, field := range cronFields {
+		if *masks[i], err = parseCronField(fields[i], field); err != nil {
+			return Cron{}, err
+		}
+	}
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	c.anyDay = strings.HasPrefix(fields[0], "*")
+	c.anyWeekday = strings.HasPrefix(fields[2], "*")
+	return c, nil
+}
+
+func parseCronField(s string, field cronField) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(s, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in cron %s %q", field.name, part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := field.min, field.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || lo > hi {
+				return 0, fmt.Errorf("invalid range in cron %s %q", field.name, part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in cron %s %q", field.name, part)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = field.max
+			}
+		}
+		if lo < field.min || hi > field.max {
+			return 0, fmt.Errorf("cron %s %q is outside %d-%d", field.name, part, field.min, field.max)
+		}
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+// Matches reports whether the expression matches day.
+func (c Cron) Matches(day Date) bool {
+	if c.months&(1<<uint(day.Month())) == 0 {
+		return false
+	}
+	dayMatch := c.days&(1<<uint(day.Day())) != 0
+	weekdayMatch := c.weekdays&(1<<uint(day.Weekday())) != 0
+	if !c.anyDay && !c.anyWeekday {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
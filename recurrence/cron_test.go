@@ -0,0 +1,72 @@
+package recurrence
+
+import "testing"
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		match []string
+		skip  []string
+	}{
+		{name: "single day", expr: "1 * *", match: []string{"2024-01-01", "2024-02-01"}, skip: []string{"2024-01-02", "2024-01-31"}},
+		{name: "list", expr: "1,15 * *", match: []string{"2024-03-01", "2024-03-15"}, skip: []string{"2024-03-14", "2024-03-16"}},
+		{name: "weekday range", expr: "* * 1-5", match: []string{"2024-09-02", "2024-09-06"}, skip: []string{"2024-09-07", "2024-09-08"}},
+		{name: "step over everything", expr: "*/2 1-6 *", match: []string{"2024-01-01", "2024-06-29"}, skip: []string{"2024-01-02", "2024-07-01"}},
+		{name: "step from a value", expr: "5/10 * *", match: []string{"2024-04-05", "2024-04-15", "2024-04-25"}, skip: []string{"2024-04-06", "2024-04-30"}},
+		{name: "stepped range", expr: "10-20/5 * *", match: []string{"2024-04-10", "2024-04-15", "2024-04-20"}, skip: []string{"2024-04-05", "2024-04-25"}},
+		{name: "list of ranges", expr: "1-2,30-31 * *", match: []string{"2024-05-02", "2024-05-30"}, skip: []string{"2024-05-03", "2024-05-29"}},
+		{name: "months", expr: "1 1,7 *", match: []string{"2024-01-01", "2024-07-01"}, skip: []string{"2024-02-01", "2024-07-02"}},
+		{name: "seven is Sunday", expr: "* * 7", match: []string{"2024-09-01"}, skip: []string{"2024-09-02"}},
+		{name: "zero is Sunday", expr: "* * 0", match: []string{"2024-09-08"}, skip: []string{"2024-09-07"}},
+		// Both day fields restricted: the 13th or any Friday.
+		{name: "day or weekday", expr: "13 * 5", match: []string{"2024-09-13", "2024-09-06", "2024-10-13"}, skip: []string{"2024-09-12", "2024-10-12"}},
+		// Only one restricted: both must match, and * always does.
+		{name: "day and any weekday", expr: "13 * *", match: []string{"2024-10-13"}, skip: []string{"2024-09-06"}},
+		{name: "stepped star counts as unrestricted", expr: "*/7 * 5", match: []string{"2024-11-22"}, skip: []string{"2024-12-06", "2024-12-08"}},
+		{name: "crontab line", expr: "30 9 1 * *", match: []string{"2024-12-01"}, skip: []string{"2024-12-02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, day := range tt.match {
+				if !cron.Matches(date(day)) {
+					t.Errorf("%q does not match %s", tt.expr, day)
+				}
+			}
+			for _, day := range tt.skip {
+				if cron.Matches(date(day)) {
+					t.Errorf("%q matches %s", tt.expr, day)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"1 *",
+		"1 * * *",
+		"0 * *",
+		"32 * *",
+		"* 0 *",
+		"* 13 *",
+		"* * 8",
+		"5-1 * *",
+		"1- * *",
+		"*/0 * *",
+		"*/x * *",
+		"a * *",
+		"1,,2 * *",
+		"*/5 9 1 * *",
+		"0 9-17 1 * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
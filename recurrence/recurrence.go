@@ -0,0 +1,182 @@
+// Package recurrence works out when a recurring expense falls due. Occurrences are whole days.
+package recurrence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout is how dates are written in JSON.
+const DateLayout = "2006-01-02"
+
+// Frequency is how a schedule repeats.
+type Frequency string
+
+const (
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"  // on the start date's weekday
+	Monthly Frequency = "monthly" // on the start date's day of the month, or the month's last day if shorter
+	Custom  Frequency = "custom"  // on the days matched by a cron-like expression
+)
+
+// maxCustomSearch is how far ahead Next looks for a day matching a custom expression.
+const maxCustomSearch = 5 * 366
+
+// Date is a calendar day, written as YYYY-MM-DD. It is always midnight UTC.
+type Date struct {
+	time.Time
+}
+
+// Day returns the calendar day t falls on, in t's location.
+func Day(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate reads a YYYY-MM-DD date.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD", s)
+	}
+	return Date{t}, nil
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+// AddDays returns the date n days later.
+func (d Date) AddDays(n int) Date {
+	return Date{d.AddDate(0, 0, n)}
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Schedule is when a recurring expense occurs: from Start, repeating by Frequency, until End if set.
+type Schedule struct {
+	Frequency Frequency `json:"frequency"`
+	Every     int       `json:"every,omitempty"` // daily, weekly and monthly: every N periods, default 1
+	Cron      string    `json:"cron,omitempty"`  // custom: see ParseCron
+	Start     Date      `json:"start_date"`
+	End       *Date     `json:"end_date,omitempty"`
+}
+
+// Validate checks the schedule and fills in the default interval.
+func (s *Schedule) Validate() error {
+	if s.Start.IsZero() {
+		return errors.New("start_date is required")
+	}
+	if s.End != nil && s.End.Before(s.Start.Time) {
+		return errors.New("end_date must not be before start_date")
+	}
+
+	switch s.Frequency {
+	case Daily, Weekly, Monthly:
+		if s.Cron != "" {
+			return fmt.Errorf("cron is only used with the %s frequency", Custom)
+		}
+		if s.Every == 0 {
+			s.Every = 1
+		}
+		if s.Every < 0 {
+			return errors.New("every must be positive")
+		}
+	case Custom:
+		if s.Every != 0 {
+			return fmt.Errorf("every is not used with the %s frequency", Custom)
+		}
+		if _, err := ParseCron(s.Cron); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("frequency must be %s, %s, %s or %s", Daily, Weekly, Monthly, Custom)
+	}
+	return nil
+}
+
+// Next returns the first occurrence on or after from. ok is false once the schedule has ended. The
+// schedule must be valid.
+func (s Schedule) Next(from Date) (next Date, ok bool) {
+	if from.Before(s.Start.Time) {
+		from = s.Start
+	}
+
+	switch s.Frequency {
+	case Daily, Weekly:
+		step := s.Every
+		if s.Frequency == Weekly {
+			step *= 7
+		}
+		days := daysBetween(s.Start, from)
+		periods := (days + step - 1) / step
+		next = s.Start.AddDays(periods * step)
+	case Monthly:
+		months := (from.Year()-s.Start.Year())*12 + int(from.Month()) - int(s.Start.Month())
+		k := months / s.Every
+		if k > 0 {
+			k-- // the clamped day in an earlier month can still be on or after from
+		}
+		for next = s.monthly(k); next.Before(from.Time); k++ {
+			next = s.monthly(k + 1)
+		}
+	case Custom:
+		cron, err := ParseCron(s.Cron)
+		if err != nil {
+			return Date{}, false
+		}
+		day := from
+		for i := 0; !cron.Matches(day); i++ {
+			if i >= maxCustomSearch || (s.End != nil && day.After(s.End.Time)) {
+				return Date{}, false
+			}
+			day = day.AddDays(1)
+		}
+		next = day
+	default:
+		return Date{}, false
+	}
+
+	if s.End != nil && next.After(s.End.Time) {
+		return Date{}, false
+	}
+	return next, true
+}
+
+// Occurs reports whether the schedule has an occurrence on day.
+func (s Schedule) Occurs(day Date) bool {
+	next, ok := s.Next(day)
+	return ok && next.Equal(day.Time)
+}
+
+// monthly is the k-th monthly occurrence after Start, clamped to the end of short months.
+func (s Schedule) monthly(k int) Date {
+	first := time.Date(s.Start.Year(), s.Start.Month()+time.Month(k*s.Every), 1, 0, 0, 0, 0, time.UTC)
+	day := s.Start.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return Date{first.AddDate(0, 0, day-1)}
+}
+
+func daysBetween(from, to Date) int {
+	return int(to.Sub(from.Time).Hours() / 24)
+}
@@ -0,0 +1,99 @@
+package recurrence
+
+import "testing"
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from     string
+		want     string // empty when the schedule has ended
+	}{
+		{name: "before start", schedule: Schedule{Frequency: Daily, Every: 1, Start: date("2024-01-10")}, from: "2024-01-01", want: "2024-01-10"},
+		{name: "daily", schedule: Schedule{Frequency: Daily, Every: 1, Start: date("2024-01-10")}, from: "2024-02-03", want: "2024-02-03"},
+		{name: "every third day", schedule: Schedule{Frequency: Daily, Every: 3, Start: date("2024-01-01")}, from: "2024-01-02", want: "2024-01-04"},
+		{name: "every third day on one", schedule: Schedule{Frequency: Daily, Every: 3, Start: date("2024-01-01")}, from: "2024-01-07", want: "2024-01-07"},
+		{name: "weekly", schedule: Schedule{Frequency: Weekly, Every: 1, Start: date("2024-01-01")}, from: "2024-01-02", want: "2024-01-08"},
+		{name: "fortnightly", schedule: Schedule{Frequency: Weekly, Every: 2, Start: date("2024-01-01")}, from: "2024-01-09", want: "2024-01-15"},
+		{name: "monthly", schedule: Schedule{Frequency: Monthly, Every: 1, Start: date("2024-01-15")}, from: "2024-01-16", want: "2024-02-15"},
+		{name: "Jan 31 to Feb 28", schedule: Schedule{Frequency: Monthly, Every: 1, Start: date("2023-01-31")}, from: "2023-02-01", want: "2023-02-28"},
+		{name: "Jan 31 to Feb 29", schedule: Schedule{Frequency: Monthly, Every: 1, Start: date("2024-01-31")}, from: "2024-02-01", want: "2024-02-29"},
+		{name: "back to the 31st after February", schedule: Schedule{Frequency: Monthly, Every: 1, Start: date("2023-01-31")}, from: "2023-03-01", want: "2023-03-31"},
+		{name: "clamped to April 30", schedule: Schedule{Frequency: Monthly, Every: 1, Start: date("2024-03-31")}, from: "2024-04-01", want: "2024-04-30"},
+		{name: "every other month", schedule: Schedule{Frequency: Monthly, Every: 2, Start: date("2024-01-31")}, from: "2024-02-01", want: "2024-03-31"},
+		{name: "every other month skips the clamped one", schedule: Schedule{Frequency: Monthly, Every: 2, Start: date("2023-12-31")}, from: "2024-01-01", want: "2024-02-29"},
+		{name: "quarterly across a year", schedule: Schedule{Frequency: Monthly, Every: 3, Start: date("2024-11-30")}, from: "2024-12-01", want: "2025-02-28"},
+		{name: "custom", schedule: Schedule{Frequency: Custom, Cron: "* * 5", Start: date("2024-09-01")}, from: "2024-09-07", want: "2024-09-13"},
+		{name: "custom leap day", schedule: Schedule{Frequency: Custom, Cron: "29 2 *", Start: date("2023-01-01")}, from: "2023-03-01", want: "2024-02-29"},
+		{name: "end is inclusive", schedule: Schedule{Frequency: Daily, Every: 1, Start: date("2024-01-01"), End: datePtr("2024-01-05")}, from: "2024-01-05", want: "2024-01-05"},
+		{name: "after end", schedule: Schedule{Frequency: Daily, Every: 1, Start: date("2024-01-01"), End: datePtr("2024-01-05")}, from: "2024-01-06"},
+		{name: "next falls after end", schedule: Schedule{Frequency: Weekly, Every: 1, Start: date("2024-01-01"), End: datePtr("2024-01-10")}, from: "2024-01-09"},
+		{name: "clamped day after end", schedule: Schedule{Frequency: Monthly, Every: 1, Start: date("2024-01-31"), End: datePtr("2024-02-28")}, from: "2024-02-01"},
+		{name: "custom after end", schedule: Schedule{Frequency: Custom, Cron: "1 * *", Start: date("2024-01-01"), End: datePtr("2024-03-15")}, from: "2024-03-02"},
+		{name: "custom that never matches", schedule: Schedule{Frequency: Custom, Cron: "31 2 *", Start: date("2024-01-01")}, from: "2024-01-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok := tt.schedule.Next(date(tt.from))
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("got %s, want no occurrence", next)
+				}
+				return
+			}
+			if !ok || next.String() != tt.want {
+				t.Fatalf("got %s, %v; want %s", next, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	s := Schedule{Frequency: Monthly, Start: date("2024-01-31")}
+	if err := s.Validate(); err != nil || s.Every != 1 {
+		t.Fatalf("got every %d, %v", s.Every, err)
+	}
+
+	for name, s := range map[string]Schedule{
+		"no start":         {Frequency: Daily},
+		"end before start": {Frequency: Daily, Start: date("2024-01-02"), End: datePtr("2024-01-01")},
+		"negative every":   {Frequency: Weekly, Every: -1, Start: date("2024-01-01")},
+		"cron on monthly":  {Frequency: Monthly, Cron: "1 * *", Start: date("2024-01-01")},
+		"every on custom":  {Frequency: Custom, Every: 2, Cron: "1 * *", Start: date("2024-01-01")},
+		"bad cron":         {Frequency: Custom, Cron: "1 *", Start: date("2024-01-01")},
+		"unknown":          {Frequency: "yearly", Start: date("2024-01-01")},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+}
+
+func TestScheduleOccurs(t *testing.T) {
+	s := Schedule{Frequency: Monthly, Every: 1, Start: date("2024-01-31")}
+	for day, want := range map[string]bool{
+		"2024-01-31": true,
+		"2024-02-29": true,
+		"2024-02-28": false,
+		"2024-03-31": true,
+		"2024-03-29": false,
+		"2023-12-31": false,
+	} {
+		if got := s.Occurs(date(day)); got != want {
+			t.Errorf("Occurs(%s) = %v, want %v", day, got, want)
+		}
+	}
+}
+
+func date(s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func datePtr(s string) *Date {
+	d := date(s)
+	return &d
+}
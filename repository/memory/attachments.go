@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type attachments struct{ store }
+
+func (r attachments) Create(ctx context.Context, a *models.Attachment) error {
+	defer r.lock(ctx)()
+
+	if _, ok := r.db.expenses[a.ExpenseID]; !ok {
+		return violation("expense_attachments", "no expense %d", a.ExpenseID)
+	}
+	if a.Size <= 0 {
+		return violation("expense_attachments", "size_bytes must be positive")
+	}
+	if a.UploadedBy != nil {
+		if _, ok := r.db.users[*a.UploadedBy]; !ok {
+			return violation("expense_attachments", "no user %d", *a.UploadedBy)
+		}
+	}
+	for _, existing := range r.db.attachments {
+		if existing.StorageKey == a.StorageKey {
+			return violation("expense_attachments", "storage key %q is taken", a.StorageKey)
+		}
+	}
+
+	stored := copyAttachment(*a)
+	stored.ID = r.db.next("expense_attachments")
+	stored.CreatedAt = r.now(ctx)
+	stored.DownloadURL = ""
+	if stored.Thumbnail != nil {
+		stored.Thumbnail.URL = ""
+	}
+	r.db.attachments[stored.ID] = stored
+	a.ID, a.CreatedAt = stored.ID, stored.CreatedAt
+	return nil
+}
+
+func (r attachments) Get(ctx context.Context, expenseID, id int) (*models.Attachment, error) {
+	defer r.lock(ctx)()
+
+	a, ok := r.db.attachments[id]
+	if !ok || a.ExpenseID != expenseID {
+		return nil, repository.ErrNotFound
+	}
+	a = copyAttachment(a)
+	return &a, nil
+}
+
+func (r attachments) List(ctx context.Context, expenseID int) ([]models.Attachment, error) {
+	defer r.lock(ctx)()
+
+	var list []models.Attachment
+	for _, a := range r.db.attachments {
+		if a.ExpenseID == expenseID {
+			list = append(list, copyAttachment(a))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (r attachments) Delete(ctx context.Context, id int) error {
+	defer r.lock(ctx)()
+
+	if _, ok := r.db.attachments[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.db.attachments, id)
+	return nil
+}
+
+func copyAttachment(a models.Attachment) models.Attachment {
+	a.Width, a.Height, a.UploadedBy = intPtr(a.Width), intPtr(a.Height), intPtr(a.UploadedBy)
+	if a.Thumbnail != nil {
+		thumbnail := *a.Thumbnail
+		a.Thumbnail = &thumbnail
+	}
+	if a.ThumbnailKey != nil {
+		key := *a.ThumbnailKey
+		a.ThumbnailKey = &key
+	}
+	return a
+}
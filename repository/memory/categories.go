@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+func (r expenses) Categories(ctx context.Context, groupID *int) ([]models.Category, error) {
+	defer r.lock(ctx)()
+
+	categories := []models.Category{}
+	for _, c := range r.db.categories {
+		if c.GroupID == nil || (groupID != nil && *c.GroupID == *groupID) {
+			categories = append(categories, copyCategory(c))
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, b := categories[i], categories[j]
+		if (a.GroupID == nil) != (b.GroupID == nil) {
+			return a.GroupID == nil
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return categories, nil
+}
+
+func (r expenses) Category(ctx context.Context, id int) (*models.Category, error) {
+	defer r.lock(ctx)()
+
+	c, ok := r.db.categories[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	c = copyCategory(c)
+	return &c, nil
+}
+
+func (r expenses) CategoryByName(ctx context.Context, name string, groupID *int) (*models.Category, error) {
+	defer r.lock(ctx)()
+
+	if c, ok := r.db.categoryNamed(name, nil); ok {
+		return &c, nil
+	}
+	if groupID != nil {
+		if c, ok := r.db.categoryNamed(name, groupID); ok {
+			return &c, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r expenses) CreateCategory(ctx context.Context, category *models.Category, createdBy int) error {
+	defer r.lock(ctx)()
+
+	if _, ok := r.db.categoryNamed(category.Name, nil); ok {
+		return repository.ErrDuplicate
+	}
+	id := r.db.next("categories")
+	if category.GroupID != nil {
+		if _, ok := r.db.categoryNamed(category.Name, category.GroupID); ok {
+			return repository.ErrDuplicate
+		}
+		if _, ok := r.db.groups[*category.GroupID]; !ok {
+			return violation("categories", "no group %d", *category.GroupID)
+		}
+	}
+	if _, ok := r.db.users[createdBy]; !ok {
+		return violation("categories", "no user %d", createdBy)
+	}
+	r.db.categories[id] = models.Category{ID: id, Name: category.Name, GroupID: intPtr(category.GroupID)}
+	category.ID = id
+	return nil
+}
+
+// DeleteCategory also uncategorizes the category's expenses, as ON DELETE SET NULL does.
+func (r expenses) DeleteCategory(ctx context.Context, groupID, categoryID int) error {
+	defer r.lock(ctx)()
+
+	c, ok := r.db.categories[categoryID]
+	if !ok || c.GroupID == nil || *c.GroupID != groupID {
+		return repository.ErrNotFound
+	}
+	delete(r.db.categories, categoryID)
+	for id, row := range r.db.expenses {
+		if row.expense.CategoryID != nil && *row.expense.CategoryID == categoryID {
+			row.expense.CategoryID = nil
+			r.db.expenses[id] = row
+		}
+	}
+	return nil
+}
+
+// categoryNamed finds the group's category with name, ignoring case, or the system one if groupID
+// is nil.
+func (d *db) categoryNamed(name string, groupID *int) (models.Category, bool) {
+	for _, c := range d.categories {
+		if !strings.EqualFold(c.Name, name) {
+			continue
+		}
+		if (groupID == nil && c.GroupID == nil) || (groupID != nil && c.GroupID != nil && *c.GroupID == *groupID) {
+			return copyCategory(c), true
+		}
+	}
+	return models.Category{}, false
+}
+
+func copyCategory(c models.Category) models.Category {
+	c.GroupID = intPtr(c.GroupID)
+	return c
+}
@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+var errCursorWithoutDate = errors.New("cursor for a date sort has no date")
+
+func (r expenses) List(ctx context.Context, filter repository.ExpenseFilter) (*repository.ExpensePage, error) {
+	if filter.After != nil && filter.Sort != repository.SortByAmount && filter.After.Date == nil {
+		return nil, errCursorWithoutDate
+	}
+
+	defer r.lock(ctx)()
+
+	var matched []models.Expense
+	for _, row := range r.db.expenses {
+		if !row.deleted && matches(row.expense, filter) {
+			matched = append(matched, row.expense)
+		}
+	}
+	page := &repository.ExpensePage{Total: len(matched)}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return positionOf(matched[i]).compare(positionOf(matched[j]), filter) < 0
+	})
+	var after *position
+	if filter.After != nil {
+		after = &position{amount: filter.After.Amount, id: filter.After.ID}
+		if filter.After.Date != nil {
+			after.date = filter.After.Date.Time
+		}
+	}
+	for _, e := range matched {
+		if after != nil && positionOf(e).compare(*after, filter) <= 0 {
+			continue
+		}
+		if len(page.Expenses) == filter.Limit {
+			page.More = true
+			break
+		}
+		expense, _, err := r.db.readExpense(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		page.Expenses = append(page.Expenses, *expense)
+	}
+	return page, nil
+}
+
+// matches reports whether the expense passes every condition of filter but the cursor.
+func matches(e models.Expense, filter repository.ExpenseFilter) bool {
+	if e.GroupID == nil || *e.GroupID != filter.GroupID {
+		return false
+	}
+	if filter.Uncategorized {
+		if e.CategoryID != nil {
+			return false
+		}
+	} else if filter.CategoryID != nil && (e.CategoryID == nil || *e.CategoryID != *filter.CategoryID) {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		if !hasTag(e.Tags, tag) {
+			return false
+		}
+	}
+	if filter.From != nil && e.ExpenseDate.Before(filter.From.Time) {
+		return false
+	}
+	if filter.To != nil && e.ExpenseDate.After(filter.To.Time) {
+		return false
+	}
+	if filter.PayerID != nil && !hasContributor(e, *filter.PayerID, true) {
+		return false
+	}
+	if filter.ParticipantID != nil && !hasContributor(e, *filter.ParticipantID, false) {
+		return false
+	}
+	if filter.MinAmount != nil && e.Amount < *filter.MinAmount {
+		return false
+	}
+	if filter.MaxAmount != nil && e.Amount > *filter.MaxAmount {
+		return false
+	}
+	if filter.Search != "" && !strings.Contains(strings.ToLower(e.Description), strings.ToLower(filter.Search)) {
+		return false
+	}
+	return true
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasContributor reports whether userID contributes to the expense, having paid towards it if paid
+// is set.
+func hasContributor(e models.Expense, userID int, paid bool) bool {
+	for _, c := range e.Contributors {
+		if c.UserID == userID && (!paid || c.PaidAmount > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// position is where an expense falls in a listing: by the sort column, then by ID.
+type position struct {
+	amount money.Amount
+	date   time.Time
+	id     int
+}
+
+func positionOf(e models.Expense) position {
+	return position{amount: e.Amount, date: e.ExpenseDate.Time, id: e.ID}
+}
+
+// compare is negative if p comes before q, comparing as (column, id) does in SQL, reversed for a
+// descending sort.
+func (p position) compare(q position, filter repository.ExpenseFilter) int {
+	c := p.date.Compare(q.date)
+	if filter.Sort == repository.SortByAmount {
+		c = cmp.Compare(p.amount, q.amount)
+	}
+	if c == 0 {
+		c = cmp.Compare(p.id, q.id)
+	}
+	if filter.Desc {
+		c = -c
+	}
+	return c
+}
@@ -0,0 +1,359 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type expenses struct{ store }
+
+// expenseRow is an expense as the expenses table and its child tables hold it, without Category.
+type expenseRow struct {
+	expense   models.Expense
+	deleted   bool
+	deletedBy *int
+}
+
+type revisionRow struct {
+	revision  int
+	action    string
+	actorID   *int
+	createdAt time.Time
+	snapshot  []byte // JSON, as the snapshot column holds it
+}
+
+func (r expenses) Create(ctx context.Context, expense *models.Expense) error {
+	defer r.lock(ctx)()
+
+	id := r.db.next("expenses")
+	stored, err := r.db.expenseColumns(id, expense)
+	if err != nil {
+		return err
+	}
+	stored.GroupID = intPtr(expense.GroupID)
+	stored.CreatedBy = expense.CreatedBy
+	stored.ExpenseType = expense.ExpenseType
+	createdAt := r.now(ctx)
+	stored.CreatedAt, stored.UpdatedAt = &createdAt, &createdAt
+
+	r.db.expenses[id] = expenseRow{expense: stored}
+	expense.ID, expense.CreatedAt, expense.UpdatedAt = id, timePtr(createdAt), timePtr(createdAt)
+	return nil
+}
+
+func (r expenses) Get(ctx context.Context, id int) (*models.Expense, bool, error) {
+	defer r.lock(ctx)()
+	return r.db.readExpense(id)
+}
+
+// Lock is Get: the transaction ctx is in already holds every expense.
+func (r expenses) Lock(ctx context.Context, id int) (*models.Expense, bool, error) {
+	return r.Get(ctx, id)
+}
+
+// Update changes what an edit can change, leaving the group, creator, type and creation time.
+func (r expenses) Update(ctx context.Context, expense *models.Expense) error {
+	defer r.lock(ctx)()
+
+	row, ok := r.db.expenses[expense.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	stored, err := r.db.expenseColumns(expense.ID, expense)
+	if err != nil {
+		return err
+	}
+	old := row.expense
+	stored.GroupID, stored.CreatedBy, stored.ExpenseType, stored.CreatedAt = old.GroupID, old.CreatedBy, old.ExpenseType, old.CreatedAt
+	updatedAt := r.now(ctx)
+	stored.UpdatedAt = &updatedAt
+
+	row.expense = stored
+	r.db.expenses[expense.ID] = row
+	expense.UpdatedAt = timePtr(updatedAt)
+	return nil
+}
+
+func (r expenses) Delete(ctx context.Context, id, deletedBy int) error {
+	defer r.lock(ctx)()
+
+	row, ok := r.db.expenses[id]
+	if !ok || row.deleted {
+		return repository.ErrNotFound
+	}
+	if _, ok := r.db.users[deletedBy]; !ok {
+		return violation("expenses", "no user %d", deletedBy)
+	}
+	updatedAt := r.now(ctx)
+	row.deleted, row.deletedBy = true, &deletedBy
+	row.expense.UpdatedAt = &updatedAt
+	r.db.expenses[id] = row
+	return nil
+}
+
+func (r expenses) Undelete(ctx context.Context, id int) error {
+	defer r.lock(ctx)()
+
+	row, ok := r.db.expenses[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	row.deleted, row.deletedBy = false, nil
+	r.db.expenses[id] = row
+	return nil
+}
+
+// expenseColumns checks expense against the schema and returns the copy of it to store.
+func (d *db) expenseColumns(id int, expense *models.Expense) (models.Expense, error) {
+	if expense.ExpenseDate == nil {
+		return models.Expense{}, violation("expenses", "expense_date is required")
+	}
+	if expense.Tax < 0 || expense.Tip < 0 || expense.Discount < 0 {
+		return models.Expense{}, violation("expenses", "tax, tip and discount cannot be negative")
+	}
+	if expense.CategoryID != nil {
+		if _, ok := d.categories[*expense.CategoryID]; !ok {
+			return models.Expense{}, violation("expenses", "no category %d", *expense.CategoryID)
+		}
+	}
+	if len(expense.AmountsOwed) != len(expense.Contributors) {
+		return models.Expense{}, fmt.Errorf("expense %d has %d contributors but %d amounts owed", id, len(expense.Contributors), len(expense.AmountsOwed))
+	}
+	rate, err := storedRate("expenses", expense.ExchangeRate)
+	if err != nil {
+		return models.Expense{}, err
+	}
+
+	date := recurrence.Day(expense.ExpenseDate.Time)
+	stored := models.Expense{
+		ID:           id,
+		Description:  expense.Description,
+		Amount:       expense.Amount,
+		Currency:     expense.Currency,
+		SplitType:    expense.SplitType,
+		CategoryID:   intPtr(expense.CategoryID),
+		Tax:          expense.Tax,
+		Tip:          expense.Tip,
+		Discount:     expense.Discount,
+		ExpenseDate:  &date,
+		TimeZone:     expense.TimeZone,
+		ExchangeRate: rate,
+	}
+
+	if len(expense.Tags) > 0 {
+		stored.Tags = append([]string(nil), expense.Tags...)
+		sort.Strings(stored.Tags)
+		for i := 1; i < len(stored.Tags); i++ {
+			if stored.Tags[i] == stored.Tags[i-1] {
+				return models.Expense{}, violation("expense_tags", "tag %q given twice", stored.Tags[i])
+			}
+		}
+	}
+	for _, item := range expense.Items {
+		if item.Amount <= 0 {
+			return models.Expense{}, violation("expense_items", "item amounts must be positive")
+		}
+		stored.Items = append(stored.Items, models.LineItem{
+			Description: item.Description,
+			Amount:      item.Amount,
+			AssignedTo:  append([]int(nil), item.AssignedTo...),
+		})
+	}
+	// The contributors table keeps what each owes as contribution_amount, alongside amounts_owed.
+	for i, c := range expense.Contributors {
+		stored.Contributors = append(stored.Contributors, c)
+		stored.AmountsOwed = append(stored.AmountsOwed, models.AmountOwed{UserID: c.UserID, Owed: expense.AmountsOwed[i].Owed, Balance: expense.AmountsOwed[i].Balance})
+	}
+	return stored, nil
+}
+
+// storedRate is snapshot as it reads back from its exchange_rate and rate_currency columns.
+func storedRate(table string, snapshot *rates.Snapshot) (*rates.Snapshot, error) {
+	rate, currency := snapshot.Columns()
+	if rate == nil {
+		return nil, nil
+	}
+	stored, err := rates.ScanSnapshot(sql.NullString{String: rate.(string), Valid: true}, sql.NullString{String: currency.(string), Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	if stored.Rate.Sign() <= 0 {
+		return nil, violation(table, "exchange_rate must be positive")
+	}
+	return stored, nil
+}
+
+// readExpense returns a copy of a stored expense that the caller is free to change.
+func (d *db) readExpense(id int) (*models.Expense, bool, error) {
+	row, ok := d.expenses[id]
+	if !ok {
+		return nil, false, repository.ErrNotFound
+	}
+	e := row.expense
+	e.GroupID = intPtr(e.GroupID)
+	e.CategoryID = intPtr(e.CategoryID)
+	e.Category = d.categoryName(e.CategoryID)
+	date := *e.ExpenseDate
+	e.ExpenseDate = &date
+	e.CreatedAt, e.UpdatedAt = timePtr(*e.CreatedAt), timePtr(*e.UpdatedAt)
+	e.ExchangeRate = copyRate(e.ExchangeRate)
+	e.Tags = append([]string(nil), e.Tags...)
+	e.Items = nil
+	for _, item := range row.expense.Items {
+		item.AssignedTo = append([]int(nil), item.AssignedTo...)
+		e.Items = append(e.Items, item)
+	}
+	e.Contributors = append([]models.Contributor(nil), e.Contributors...)
+	e.AmountsOwed = append([]models.AmountOwed(nil), e.AmountsOwed...)
+	return &e, row.deleted, nil
+}
+
+func (d *db) categoryName(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return d.categories[*id].Name
+}
+
+func copyRate(s *rates.Snapshot) *rates.Snapshot {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Rate = new(big.Rat).Set(s.Rate)
+	return &c
+}
+
+func (r expenses) GroupShares(ctx context.Context, groupID int) ([]repository.ExpenseShares, error) {
+	defer r.lock(ctx)()
+	return r.db.shares(func(e models.Expense) bool {
+		return e.GroupID != nil && *e.GroupID == groupID
+	}), nil
+}
+
+func (r expenses) PersonalShares(ctx context.Context, userID int) ([]repository.ExpenseShares, error) {
+	defer r.lock(ctx)()
+	return r.db.shares(func(e models.Expense) bool {
+		if e.ExpenseType != "personal" {
+			return false
+		}
+		for _, c := range e.Contributors {
+			if c.UserID == userID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// shares returns the live expenses with contributors that match, in ID order, with each
+// contributor's part by user ID.
+func (d *db) shares(match func(e models.Expense) bool) []repository.ExpenseShares {
+	var list []repository.ExpenseShares
+	for _, id := range d.expenseIDs() {
+		row := d.expenses[id]
+		e := row.expense
+		if row.deleted || len(e.Contributors) == 0 || !match(e) {
+			continue
+		}
+		shares := make([]repository.Share, len(e.Contributors))
+		for i, c := range e.Contributors {
+			shares[i] = repository.Share{UserID: c.UserID, Paid: c.PaidAmount, Owed: e.AmountsOwed[i].Owed}
+		}
+		sort.SliceStable(shares, func(i, j int) bool { return shares[i].UserID < shares[j].UserID })
+		list = append(list, repository.ExpenseShares{
+			ID:           e.ID,
+			Description:  e.Description,
+			Currency:     e.Currency,
+			Date:         *e.ExpenseDate,
+			CategoryID:   intPtr(e.CategoryID),
+			Category:     d.categoryName(e.CategoryID),
+			ExchangeRate: copyRate(e.ExchangeRate),
+			Shares:       shares,
+		})
+	}
+	return list
+}
+
+// expenseIDs returns the ID of every stored expense, in ascending order.
+func (d *db) expenseIDs() []int {
+	ids := make([]int, 0, len(d.expenses))
+	for id := range d.expenses {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (r expenses) SaveRevision(ctx context.Context, expense *models.Expense, action string, actorID int) error {
+	snapshot, err := json.Marshal(expense)
+	if err != nil {
+		return err
+	}
+
+	defer r.lock(ctx)()
+	if _, ok := r.db.expenses[expense.ID]; !ok {
+		return violation("expense_revisions", "no expense %d", expense.ID)
+	}
+	if _, ok := r.db.users[actorID]; !ok {
+		return violation("expense_revisions", "no user %d", actorID)
+	}
+	previous := r.db.revisions[expense.ID]
+	revision := 1
+	if len(previous) > 0 {
+		revision = previous[len(previous)-1].revision + 1
+	}
+	// A new slice, so a rolled-back transaction's copy of the map still sees the old one.
+	revisions := append(append([]revisionRow(nil), previous...), revisionRow{
+		revision:  revision,
+		action:    action,
+		actorID:   &actorID,
+		createdAt: r.now(ctx),
+		snapshot:  snapshot,
+	})
+	r.db.revisions[expense.ID] = revisions
+	return nil
+}
+
+func (r expenses) Revisions(ctx context.Context, expenseID int) ([]models.ExpenseRevision, error) {
+	defer r.lock(ctx)()
+
+	var revisions []models.ExpenseRevision
+	for _, row := range r.db.revisions[expenseID] {
+		rev, err := row.decode()
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+	return revisions, nil
+}
+
+func (r expenses) Revision(ctx context.Context, expenseID, revision int) (*models.ExpenseRevision, error) {
+	defer r.lock(ctx)()
+
+	for _, row := range r.db.revisions[expenseID] {
+		if row.revision == revision {
+			return row.decode()
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (row revisionRow) decode() (*models.ExpenseRevision, error) {
+	rev := models.ExpenseRevision{Revision: row.revision, Action: row.action, ActorID: intPtr(row.actorID), CreatedAt: row.createdAt}
+	if err := json.Unmarshal(row.snapshot, &rev.Snapshot); err != nil {
+		return nil, fmt.Errorf("decode revision %d: %w", row.revision, err)
+	}
+	return &rev, nil
+}
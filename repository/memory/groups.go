@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type groups struct{ store }
+
+func (r groups) Create(ctx context.Context, group *models.Group, ownerID int) error {
+	defer r.lock(ctx)()
+
+	id := r.db.next("groups")
+	if _, ok := r.db.users[ownerID]; !ok {
+		return violation("groups", "no user %d", ownerID)
+	}
+	createdAt := r.now(ctx)
+	r.db.groups[id] = models.Group{ID: id, Name: group.Name, BaseCurrency: group.BaseCurrency, CreatedAt: &createdAt}
+	r.db.members[membership{id, ownerID}] = models.RoleOwner
+	group.ID, group.CreatedAt = id, timePtr(createdAt)
+	return nil
+}
+
+func (r groups) Get(ctx context.Context, id int) (*models.Group, error) {
+	defer r.lock(ctx)()
+
+	g, ok := r.db.groups[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	g.CreatedAt = timePtr(*g.CreatedAt)
+	return &g, nil
+}
+
+func (r groups) Rename(ctx context.Context, id int, name string) error {
+	return r.update(ctx, id, func(g *models.Group) { g.Name = name })
+}
+
+func (r groups) SetBaseCurrency(ctx context.Context, id int, currency string) error {
+	return r.update(ctx, id, func(g *models.Group) { g.BaseCurrency = currency })
+}
+
+func (r groups) update(ctx context.Context, id int, change func(g *models.Group)) error {
+	defer r.lock(ctx)()
+
+	g, ok := r.db.groups[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	change(&g)
+	r.db.groups[id] = g
+	return nil
+}
+
+func (r groups) Role(ctx context.Context, groupID, userID int) (models.Role, bool, error) {
+	defer r.lock(ctx)()
+
+	role, ok := r.db.members[membership{groupID, userID}]
+	return role, ok, nil
+}
+
+func (r groups) AddMember(ctx context.Context, groupID, userID int, role models.Role) error {
+	defer r.lock(ctx)()
+
+	if !role.Valid() {
+		return violation("group_users", "invalid role %q", role)
+	}
+	if _, ok := r.db.members[membership{groupID, userID}]; ok {
+		return repository.ErrDuplicate
+	}
+	if role == models.RoleOwner && r.db.hasOwner(groupID, userID) {
+		return repository.ErrDuplicate
+	}
+	if _, ok := r.db.groups[groupID]; !ok {
+		return violation("group_users", "no group %d", groupID)
+	}
+	if _, ok := r.db.users[userID]; !ok {
+		return violation("group_users", "no user %d", userID)
+	}
+	r.db.members[membership{groupID, userID}] = role
+	return nil
+}
+
+func (r groups) RemoveMember(ctx context.Context, groupID, userID int) error {
+	defer r.lock(ctx)()
+
+	key := membership{groupID, userID}
+	if _, ok := r.db.members[key]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.db.members, key)
+	return nil
+}
+
+func (r groups) SetRole(ctx context.Context, groupID, userID int, role models.Role) error {
+	defer r.lock(ctx)()
+
+	key := membership{groupID, userID}
+	if _, ok := r.db.members[key]; !ok {
+		return repository.ErrNotFound
+	}
+	if !role.Valid() {
+		return violation("group_users", "invalid role %q", role)
+	}
+	if role == models.RoleOwner && r.db.hasOwner(groupID, userID) {
+		return violation("group_users", "group %d already has an owner", groupID)
+	}
+	r.db.members[key] = role
+	return nil
+}
+
+func (r groups) TransferOwnership(ctx context.Context, groupID, ownerID, newOwnerID int) error {
+	defer r.lock(ctx)()
+
+	newOwner := membership{groupID, newOwnerID}
+	if _, ok := r.db.members[newOwner]; !ok {
+		return repository.ErrNotFound
+	}
+	owner := membership{groupID, ownerID}
+	_, ownerIsMember := r.db.members[owner]
+	for key, role := range r.db.members {
+		if key.groupID == groupID && role == models.RoleOwner && key != owner && key != newOwner {
+			return violation("group_users", "group %d already has an owner", groupID)
+		}
+	}
+
+	if ownerIsMember {
+		r.db.members[owner] = models.RoleAdmin
+	}
+	r.db.members[newOwner] = models.RoleOwner
+	return nil
+}
+
+func (r groups) NonMembers(ctx context.Context, groupID int, userIDs []int) ([]int, error) {
+	defer r.lock(ctx)()
+
+	seen := make(map[int]bool)
+	var missing []int
+	for _, id := range userIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, ok := r.db.members[membership{groupID, id}]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	sort.Ints(missing)
+	return missing, nil
+}
+
+// hasOwner reports whether anyone but exceptUserID owns the group.
+func (d *db) hasOwner(groupID, exceptUserID int) bool {
+	for key, role := range d.members {
+		if key.groupID == groupID && key.userID != exceptUserID && role == models.RoleOwner {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+// Package memory implements the repositories in memory, for tests and for running the API without a
+// database. It keeps the rules the schema in db.sql enforces: unique emails and memberships, one
+// owner per group, references between rows and what happens to them on delete. Nothing survives a
+// restart.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+// New returns empty repositories, apart from the system categories db.sql seeds. A transaction
+// holds the whole store until it ends, so transactions run one at a time and see no one else's
+// writes.
+func New() repository.Repositories {
+	s := store{db: newDB()}
+	return repository.Repositories{
+		Users:         users{s},
+		Groups:        groups{s},
+		Expenses:      expenses{s},
+		Settlements:   settlements{s},
+		Recurring:     recurring{s},
+		Attachments:   attachments{s},
+		ExchangeRates: rates.NewMemory(),
+		Tx:            s,
+	}
+}
+
+// systemCategories are seeded with IDs 1 to 10, as by db.sql.
+var systemCategories = []string{"Food", "Groceries", "Travel", "Transport", "Rent", "Utilities", "Entertainment", "Shopping", "Health", "Other"}
+
+// db is every table. Rows are never changed in place: a write stores a new row, so a transaction
+// can be rolled back by putting the old maps back.
+type db struct {
+	mu sync.Mutex
+	tables
+	// seq is the last ID handed out per table. Like a database sequence it is not rolled back.
+	seq map[string]int
+	// txTime is when the running transaction started.
+	txTime time.Time
+}
+
+type tables struct {
+	users       map[int]models.User
+	groups      map[int]models.Group
+	members     map[membership]models.Role
+	categories  map[int]models.Category
+	expenses    map[int]expenseRow
+	revisions   map[int][]revisionRow // by expense ID, in revision order
+	settlements map[settlementKey]settlementRow
+	recurring   map[int]recurringRow
+	occurrences map[occurrenceKey]models.RecurringOccurrence
+	attachments map[int]models.Attachment
+}
+
+type membership struct{ groupID, userID int }
+
+func newDB() *db {
+	d := &db{
+		tables: tables{
+			users:       make(map[int]models.User),
+			groups:      make(map[int]models.Group),
+			members:     make(map[membership]models.Role),
+			categories:  make(map[int]models.Category),
+			expenses:    make(map[int]expenseRow),
+			revisions:   make(map[int][]revisionRow),
+			settlements: make(map[settlementKey]settlementRow),
+			recurring:   make(map[int]recurringRow),
+			occurrences: make(map[occurrenceKey]models.RecurringOccurrence),
+			attachments: make(map[int]models.Attachment),
+		},
+		seq: make(map[string]int),
+	}
+	for _, name := range systemCategories {
+		id := d.next("categories")
+		d.categories[id] = models.Category{ID: id, Name: name}
+	}
+	return d
+}
+
+func (d *db) next(table string) int {
+	d.seq[table]++
+	return d.seq[table]
+}
+
+// clone copies the maps but shares the rows, which are never changed in place.
+func (t tables) clone() tables {
+	return tables{
+		users:       maps.Clone(t.users),
+		groups:      maps.Clone(t.groups),
+		members:     maps.Clone(t.members),
+		categories:  maps.Clone(t.categories),
+		expenses:    maps.Clone(t.expenses),
+		revisions:   maps.Clone(t.revisions),
+		settlements: maps.Clone(t.settlements),
+		recurring:   maps.Clone(t.recurring),
+		occurrences: maps.Clone(t.occurrences),
+		attachments: maps.Clone(t.attachments),
+	}
+}
+
+type store struct {
+	db *db
+}
+
+type txKey struct{}
+
+func (s store) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	s.db.mu.Lock()
+	s.db.txTime = now()
+	saved := s.db.tables.clone()
+	committed := false
+	defer func() {
+		if !committed {
+			s.db.tables = saved
+		}
+		s.db.mu.Unlock()
+	}()
+
+	err := fn(context.WithValue(ctx, txKey{}, s.db))
+	committed = err == nil
+	return err
+}
+
+func (s store) inTx(ctx context.Context) bool {
+	d, _ := ctx.Value(txKey{}).(*db)
+	return d == s.db
+}
+
+// lock holds the store for one call, unless ctx is in a transaction, which already holds it. The
+// returned func releases it.
+func (s store) lock(ctx context.Context) func() {
+	if s.inTx(ctx) {
+		return func() {}
+	}
+	s.db.mu.Lock()
+	return s.db.mu.Unlock
+}
+
+// now is CURRENT_TIMESTAMP: the time the transaction ctx is in started, or else the current time.
+func (s store) now(ctx context.Context) time.Time {
+	if s.inTx(ctx) {
+		return s.db.txTime
+	}
+	return now()
+}
+
+// now is the current time as a TIMESTAMP column stores it: UTC, to the microsecond.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// violation is the error for a write the schema would reject, other than the unique constraints
+// the repositories report as repository.ErrDuplicate.
+func violation(table, format string, args ...interface{}) error {
+	return fmt.Errorf("memory: %s: %s", table, fmt.Sprintf(format, args...))
+}
+
+func intPtr(p *int) *int {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,327 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+// fixture is a group owned by the first of three users.
+func fixture(t *testing.T) (repository.Repositories, int, []int) {
+	t.Helper()
+	ctx := context.Background()
+	repos := New()
+
+	var userIDs []int
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		user := &models.User{Name: email, Email: email, TimeZone: "UTC"}
+		if err := repos.Users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		userIDs = append(userIDs, user.ID)
+	}
+	group := &models.Group{Name: "Trip", BaseCurrency: "INR"}
+	if err := repos.Groups.Create(ctx, group, userIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+	return repos, group.ID, userIDs
+}
+
+func addExpense(t *testing.T, repos repository.Repositories, groupID int, amount money.Amount, day string, paidBy, owedBy int) *models.Expense {
+	t.Helper()
+	date, err := recurrence.ParseDate(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense := &models.Expense{
+		Description: "Dinner", Amount: amount, Currency: "INR", SplitType: "equal", ExpenseType: "group",
+		CreatedBy: paidBy, GroupID: &groupID, ExpenseDate: &date, TimeZone: "UTC",
+		Contributors: []models.Contributor{{UserID: paidBy, PaidAmount: amount}, {UserID: owedBy}},
+		AmountsOwed:  []models.AmountOwed{{UserID: paidBy, Owed: amount / 2}, {UserID: owedBy, Owed: amount - amount/2}},
+	}
+	if err := repos.Expenses.Create(context.Background(), expense); err != nil {
+		t.Fatal(err)
+	}
+	return expense
+}
+
+func TestUniqueEmailsAndMemberships(t *testing.T) {
+	ctx := context.Background()
+	repos, groupID, userIDs := fixture(t)
+
+	if err := repos.Users.Create(ctx, &models.User{Name: "A", Email: "a@example.com"}); !errors.Is(err, repository.ErrDuplicate) {
+		t.Fatalf("second account for an email: got %v", err)
+	}
+	if err := repos.Groups.AddMember(ctx, groupID, userIDs[1], models.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Groups.AddMember(ctx, groupID, userIDs[1], models.RoleAdmin); !errors.Is(err, repository.ErrDuplicate) {
+		t.Fatalf("second membership: got %v", err)
+	}
+	if err := repos.Groups.AddMember(ctx, groupID, userIDs[2], models.RoleOwner); !errors.Is(err, repository.ErrDuplicate) {
+		t.Fatalf("second owner: got %v", err)
+	}
+	if err := repos.Groups.AddMember(ctx, groupID, 99, models.RoleMember); err == nil {
+		t.Fatal("membership of a missing user was stored")
+	}
+	if err := repos.Groups.SetRole(ctx, groupID, userIDs[1], models.RoleOwner); err == nil {
+		t.Fatal("a second owner was set")
+	}
+
+	if err := repos.Groups.TransferOwnership(ctx, groupID, userIDs[0], userIDs[2]); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("transfer to a non-member: got %v", err)
+	}
+	if role, _, _ := repos.Groups.Role(ctx, groupID, userIDs[0]); role != models.RoleOwner {
+		t.Fatalf("failed transfer left the owner as %q", role)
+	}
+	if err := repos.Groups.TransferOwnership(ctx, groupID, userIDs[0], userIDs[1]); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []models.Role{models.RoleAdmin, models.RoleOwner} {
+		if role, _, _ := repos.Groups.Role(ctx, groupID, userIDs[i]); role != want {
+			t.Fatalf("user %d: got role %q, want %q", userIDs[i], role, want)
+		}
+	}
+
+	missing, err := repos.Groups.NonMembers(ctx, groupID, []int{userIDs[2], userIDs[0], userIDs[2]})
+	if err != nil || len(missing) != 1 || missing[0] != userIDs[2] {
+		t.Fatalf("non-members: got %v, %v", missing, err)
+	}
+}
+
+func TestDeleteCategoryUncategorizesExpenses(t *testing.T) {
+	ctx := context.Background()
+	repos, groupID, userIDs := fixture(t)
+
+	if err := repos.Expenses.CreateCategory(ctx, &models.Category{Name: "food", GroupID: &groupID}, userIDs[0]); !errors.Is(err, repository.ErrDuplicate) {
+		t.Fatalf("category named like a system one: got %v", err)
+	}
+	category := &models.Category{Name: "Snacks", GroupID: &groupID}
+	if err := repos.Expenses.CreateCategory(ctx, category, userIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	expense := addExpense(t, repos, groupID, 1000, "2024-03-01", userIDs[0], userIDs[1])
+	expense.CategoryID = &category.ID
+	if err := repos.Expenses.Update(ctx, expense); err != nil {
+		t.Fatal(err)
+	}
+	stored, _, err := repos.Expenses.Get(ctx, expense.ID)
+	if err != nil || stored.Category != "Snacks" {
+		t.Fatalf("got %+v, %v", stored, err)
+	}
+
+	if err := repos.Expenses.DeleteCategory(ctx, groupID+1, category.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("deleting another group's category: got %v", err)
+	}
+	if err := repos.Expenses.DeleteCategory(ctx, groupID, category.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, _, err = repos.Expenses.Get(ctx, expense.ID)
+	if err != nil || stored.CategoryID != nil || stored.Category != "" {
+		t.Fatalf("after delete: got %+v, %v", stored, err)
+	}
+}
+
+func TestWithinTxRollsBack(t *testing.T) {
+	ctx := context.Background()
+	repos, groupID, userIDs := fixture(t)
+	expense := addExpense(t, repos, groupID, 1000, "2024-03-01", userIDs[0], userIDs[1])
+
+	failure := errors.New("changed my mind")
+	err := repos.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repos.Expenses.SaveRevision(ctx, expense, "delete", userIDs[0]); err != nil {
+			return err
+		}
+		if err := repos.Expenses.Delete(ctx, expense.ID, userIDs[0]); err != nil {
+			return err
+		}
+		if err := repos.Groups.Rename(ctx, groupID, "Renamed"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("got %v", err)
+	}
+
+	if _, deleted, err := repos.Expenses.Get(ctx, expense.ID); err != nil || deleted {
+		t.Fatalf("expense deleted = %v, %v after rollback", deleted, err)
+	}
+	if revisions, _ := repos.Expenses.Revisions(ctx, expense.ID); len(revisions) != 0 {
+		t.Fatalf("got %d revisions after rollback", len(revisions))
+	}
+	if group, _ := repos.Groups.Get(ctx, groupID); group.Name != "Trip" {
+		t.Fatalf("group renamed to %q after rollback", group.Name)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	ctx := context.Background()
+	repos, groupID, userIDs := fixture(t)
+	for i, day := range []string{"2024-03-02", "2024-03-01", "2024-03-02", "2024-03-03"} {
+		addExpense(t, repos, groupID, money.Amount(1000*(i+1)), day, userIDs[0], userIDs[1])
+	}
+	deleted := addExpense(t, repos, groupID, 9000, "2024-03-04", userIDs[0], userIDs[1])
+	if err := repos.Expenses.Delete(ctx, deleted.ID, userIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := repository.ExpenseFilter{GroupID: groupID, Sort: repository.SortByDate, Desc: true, Limit: 3}
+	var got []int
+	for {
+		page, err := repos.Expenses.List(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 4 {
+			t.Fatalf("total: got %d", page.Total)
+		}
+		for _, e := range page.Expenses {
+			got = append(got, e.ID)
+		}
+		if !page.More {
+			break
+		}
+		last := page.Expenses[len(page.Expenses)-1]
+		filter.After = &repository.ExpenseCursor{Date: last.ExpenseDate, ID: last.ID}
+	}
+
+	// Newest first, ties broken by ID in the same direction.
+	want := []int{4, 3, 1, 2}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPendingSettlementsExpire(t *testing.T) {
+	ctx := context.Background()
+	repos, _, userIDs := fixture(t)
+
+	past := time.Now().Add(-time.Minute)
+	s := &models.Settlement{Type: "personal", DebtorID: userIDs[1], CreditorID: userIDs[0], Amount: 500, Currency: "INR",
+		Status: models.SettlementPending, ExpiresAt: &past, CreatedBy: &userIDs[1]}
+	if err := repos.Settlements.Create(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	awaiting, err := repos.Settlements.List(ctx, repository.SettlementFilter{AwaitingConfirmation: true})
+	if err != nil || len(awaiting) != 0 {
+		t.Fatalf("awaiting confirmation: got %v, %v", awaiting, err)
+	}
+	if err := repos.Settlements.ExpirePending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repos.Settlements.Lock(ctx, "personal", s.ID)
+	if err != nil || stored.Status != models.SettlementExpired {
+		t.Fatalf("got %+v, %v", stored, err)
+	}
+	if _, err := repos.Settlements.Lock(ctx, "group", s.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("other kind: got %v", err)
+	}
+}
+
+func TestRecurringOccurrences(t *testing.T) {
+	ctx := context.Background()
+	repos, groupID, userIDs := fixture(t)
+	expense := addExpense(t, repos, groupID, 300, "2024-01-01", userIDs[0], userIDs[1])
+
+	start, _ := recurrence.ParseDate("2024-01-01")
+	rec := &models.RecurringExpense{
+		Expense:  models.Expense{Description: "Rent", CreatedBy: userIDs[0], GroupID: &groupID},
+		Schedule: recurrence.Schedule{Frequency: recurrence.Daily, Every: 1, Start: start},
+	}
+	if err := repos.Recurring.Create(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.Expense.Description = "changed after Create"
+	if got, _ := repos.Recurring.Get(ctx, rec.ID); got.Expense.Description != "Rent" {
+		t.Fatalf("a caller's change reached the store: got %q", got.Expense.Description)
+	}
+
+	day := func(i int) recurrence.Date { return start.AddDays(i) }
+	for i, status := range []string{models.OccurrenceCreated, models.OccurrenceFailed, models.OccurrenceSkipped} {
+		if err := repos.Recurring.AddOccurrence(ctx, rec.ID, models.RecurringOccurrence{Date: day(i), Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repos.Recurring.AddOccurrence(ctx, rec.ID, models.RecurringOccurrence{Date: day(0), Status: models.OccurrenceCreated}); !errors.Is(err, repository.ErrDuplicate) {
+		t.Fatalf("second occurrence on a date: got %v", err)
+	}
+	if err := repos.Recurring.UpdateOccurrence(ctx, rec.ID, models.RecurringOccurrence{Date: day(0), Status: models.OccurrenceCreated, ExpenseID: &expense.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Recurring.UpdateOccurrence(ctx, rec.ID, models.RecurringOccurrence{Date: day(5), Status: models.OccurrenceFailed}); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("update of a date not handled: got %v", err)
+	}
+
+	occurrences, err := repos.Recurring.Occurrences(ctx, rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(occurrences) != 3 || occurrences[0].Date != day(2) || occurrences[2].ExpenseID == nil || *occurrences[2].ExpenseID != expense.ID {
+		t.Fatalf("occurrences: got %+v", occurrences)
+	}
+	if last, _ := repos.Recurring.LastOccurrence(ctx, rec.ID); last == nil || *last != day(1) {
+		t.Fatalf("last occurrence, skipping the skipped one: got %v", last)
+	}
+
+	if due, _ := repos.Recurring.Due(ctx, day(0)); len(due) != 0 {
+		t.Fatalf("due without a next occurrence: got %v", due)
+	}
+	next := day(3)
+	if err := repos.Recurring.SetNextOccurrence(ctx, rec.ID, &next); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := repos.Recurring.Due(ctx, day(3)); len(due) != 1 || due[0] != rec.ID {
+		t.Fatalf("due: got %v", due)
+	}
+	if visible, _ := repos.Recurring.List(ctx, repository.RecurringFilter{VisibleTo: userIDs[2]}); len(visible) != 0 {
+		t.Fatalf("visible to a non-member: got %v", visible)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	repos, groupID, userIDs := fixture(t)
+	expense := addExpense(t, repos, groupID, 300, "2024-01-01", userIDs[0], userIDs[1])
+
+	first := &models.Attachment{ExpenseID: expense.ID, StorageKey: "a", Size: 1, UploadedBy: &userIDs[0]}
+	if err := repos.Attachments.Create(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Attachments.Create(ctx, &models.Attachment{ExpenseID: expense.ID, StorageKey: "a", Size: 1}); err == nil {
+		t.Fatal("a second attachment with the same storage key was stored")
+	}
+	if err := repos.Attachments.Create(ctx, &models.Attachment{ExpenseID: 99, StorageKey: "b", Size: 1}); err == nil {
+		t.Fatal("an attachment to a missing expense was stored")
+	}
+	second := &models.Attachment{ExpenseID: expense.ID, StorageKey: "b", Size: 1}
+	if err := repos.Attachments.Create(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repos.Attachments.Get(ctx, expense.ID+1, first.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("attachment under another expense: got %v", err)
+	}
+	if err := repos.Attachments.Delete(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Attachments.Delete(ctx, first.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("second delete: got %v", err)
+	}
+	if list, _ := repos.Attachments.List(ctx, expense.ID); len(list) != 1 || list[0].ID != second.ID {
+		t.Fatalf("attachments: got %+v", list)
+	}
+}
@@ -0,0 +1,306 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type recurring struct{ store }
+
+// recurringRow is a template as the recurring_expenses table holds it.
+type recurringRow struct {
+	template  []byte // JSON, as the template column holds it
+	groupID   *int
+	createdBy int
+	schedule  recurrence.Schedule
+	next      *recurrence.Date
+	paused    bool
+}
+
+// occurrenceKey is unique per template, as (recurring_id, occurs_on) is.
+type occurrenceKey struct {
+	recurringID int
+	date        string // DateLayout
+}
+
+var occurrenceStatuses = map[string]bool{
+	models.OccurrenceCreated: true,
+	models.OccurrenceSkipped: true,
+	models.OccurrenceFailed:  true,
+}
+
+func (r recurring) Create(ctx context.Context, rec *models.RecurringExpense) error {
+	defer r.lock(ctx)()
+
+	id := r.db.next("recurring_expenses")
+	row, err := r.db.recurringColumns(rec)
+	if err != nil {
+		return err
+	}
+	row.groupID = intPtr(rec.Expense.GroupID)
+	row.createdBy = rec.Expense.CreatedBy
+	if row.groupID != nil {
+		if _, ok := r.db.groups[*row.groupID]; !ok {
+			return violation("recurring_expenses", "no group %d", *row.groupID)
+		}
+	}
+	if _, ok := r.db.users[row.createdBy]; !ok {
+		return violation("recurring_expenses", "no user %d", row.createdBy)
+	}
+
+	r.db.recurring[id] = row
+	rec.ID = id
+	return nil
+}
+
+func (r recurring) Get(ctx context.Context, id int) (*models.RecurringExpense, error) {
+	defer r.lock(ctx)()
+	return r.db.readRecurring(id)
+}
+
+// Lock is Get: the transaction ctx is in already holds every template.
+func (r recurring) Lock(ctx context.Context, id int) (*models.RecurringExpense, error) {
+	return r.Get(ctx, id)
+}
+
+// TryLock is Get: transactions run one at a time, so no other one can be holding the template.
+func (r recurring) TryLock(ctx context.Context, id int) (*models.RecurringExpense, error) {
+	return r.Get(ctx, id)
+}
+
+func (r recurring) List(ctx context.Context, filter repository.RecurringFilter) ([]models.RecurringExpense, error) {
+	defer r.lock(ctx)()
+
+	var list []models.RecurringExpense
+	for _, id := range r.db.recurringIDs() {
+		rec, err := r.db.readRecurring(id)
+		if err != nil {
+			return nil, err
+		}
+		if filter.GroupID != nil && (rec.Expense.GroupID == nil || *rec.Expense.GroupID != *filter.GroupID) {
+			continue
+		}
+		if r.db.recurringVisible(rec, filter.VisibleTo) {
+			list = append(list, *rec)
+		}
+	}
+	return list, nil
+}
+
+// recurringVisible reports whether the user created the template, belongs to its group or, for a
+// personal one, contributes to it.
+func (d *db) recurringVisible(rec *models.RecurringExpense, userID int) bool {
+	if rec.Expense.CreatedBy == userID {
+		return true
+	}
+	if rec.Expense.GroupID != nil {
+		_, member := d.members[membership{*rec.Expense.GroupID, userID}]
+		return member
+	}
+	for _, c := range rec.Expense.Contributors {
+		if c.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r recurring) Due(ctx context.Context, day recurrence.Date) ([]int, error) {
+	defer r.lock(ctx)()
+
+	var ids []int
+	for _, id := range r.db.recurringIDs() {
+		row := r.db.recurring[id]
+		if !row.paused && row.next != nil && !row.next.After(day.Time) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r recurring) Update(ctx context.Context, rec *models.RecurringExpense) error {
+	defer r.lock(ctx)()
+
+	existing, ok := r.db.recurring[rec.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	row, err := r.db.recurringColumns(rec)
+	if err != nil {
+		return err
+	}
+	row.groupID, row.createdBy = existing.groupID, existing.createdBy
+	r.db.recurring[rec.ID] = row
+	return nil
+}
+
+func (r recurring) SetNextOccurrence(ctx context.Context, id int, next *recurrence.Date) error {
+	defer r.lock(ctx)()
+
+	row, ok := r.db.recurring[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	row.next = datePtr(next)
+	r.db.recurring[id] = row
+	return nil
+}
+
+func (r recurring) AddOccurrence(ctx context.Context, recurringID int, o models.RecurringOccurrence) error {
+	defer r.lock(ctx)()
+
+	key := occurrenceKey{recurringID, o.Date.String()}
+	if _, ok := r.db.occurrences[key]; ok {
+		return repository.ErrDuplicate
+	}
+	if _, ok := r.db.recurring[recurringID]; !ok {
+		return violation("recurring_occurrences", "no recurring expense %d", recurringID)
+	}
+	stored, err := r.db.occurrenceColumns(o)
+	if err != nil {
+		return err
+	}
+	r.db.occurrences[key] = stored
+	return nil
+}
+
+func (r recurring) UpdateOccurrence(ctx context.Context, recurringID int, o models.RecurringOccurrence) error {
+	defer r.lock(ctx)()
+
+	key := occurrenceKey{recurringID, o.Date.String()}
+	if _, ok := r.db.occurrences[key]; !ok {
+		return repository.ErrNotFound
+	}
+	stored, err := r.db.occurrenceColumns(o)
+	if err != nil {
+		return err
+	}
+	r.db.occurrences[key] = stored
+	return nil
+}
+
+func (r recurring) Occurrences(ctx context.Context, recurringID int) ([]models.RecurringOccurrence, error) {
+	defer r.lock(ctx)()
+
+	var list []models.RecurringOccurrence
+	for key, o := range r.db.occurrences {
+		if key.recurringID == recurringID {
+			list = append(list, copyOccurrence(o))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Date.After(list[j].Date.Time) })
+	return list, nil
+}
+
+func (r recurring) LastOccurrence(ctx context.Context, recurringID int) (*recurrence.Date, error) {
+	defer r.lock(ctx)()
+
+	var last *recurrence.Date
+	for key, o := range r.db.occurrences {
+		if key.recurringID != recurringID || o.Status == models.OccurrenceSkipped {
+			continue
+		}
+		if last == nil || o.Date.After(last.Time) {
+			last = datePtr(&o.Date)
+		}
+	}
+	return last, nil
+}
+
+// recurringColumns is everything about rec that Update may change, checked as the table would.
+func (d *db) recurringColumns(rec *models.RecurringExpense) (recurringRow, error) {
+	switch rec.Frequency {
+	case recurrence.Daily, recurrence.Weekly, recurrence.Monthly, recurrence.Custom:
+	default:
+		return recurringRow{}, violation("recurring_expenses", "invalid frequency %q", rec.Frequency)
+	}
+	if rec.Every < 0 {
+		return recurringRow{}, violation("recurring_expenses", "every must be positive")
+	}
+	if rec.End != nil && rec.End.Before(rec.Start.Time) {
+		return recurringRow{}, violation("recurring_expenses", "end_date is before start_date")
+	}
+	template, err := json.Marshal(rec.Expense)
+	if err != nil {
+		return recurringRow{}, err
+	}
+
+	schedule := recurrence.Schedule{
+		Frequency: rec.Frequency,
+		Every:     rec.Every,
+		Cron:      rec.Cron,
+		Start:     recurrence.Day(rec.Start.Time),
+		End:       datePtr(rec.End),
+	}
+	// The every column defaults to 1 and is not read back for custom schedules.
+	if schedule.Every == 0 {
+		schedule.Every = 1
+	}
+	return recurringRow{template: template, schedule: schedule, next: datePtr(rec.NextOccurrence), paused: rec.Paused}, nil
+}
+
+// readRecurring returns a copy of a stored template that the caller is free to change.
+func (d *db) readRecurring(id int) (*models.RecurringExpense, error) {
+	row, ok := d.recurring[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+
+	rec := models.RecurringExpense{ID: id, Schedule: row.schedule, NextOccurrence: datePtr(row.next), Paused: row.paused}
+	if err := json.Unmarshal(row.template, &rec.Expense); err != nil {
+		return nil, err
+	}
+	rec.Expense.CreatedBy = row.createdBy
+	rec.Expense.GroupID = intPtr(row.groupID)
+	rec.End = datePtr(row.schedule.End)
+	if rec.Frequency == recurrence.Custom {
+		rec.Every = 0
+	}
+	return &rec, nil
+}
+
+func (d *db) occurrenceColumns(o models.RecurringOccurrence) (models.RecurringOccurrence, error) {
+	if !occurrenceStatuses[o.Status] {
+		return models.RecurringOccurrence{}, violation("recurring_occurrences", "invalid status %q", o.Status)
+	}
+	if o.ExpenseID != nil {
+		if _, ok := d.expenses[*o.ExpenseID]; !ok {
+			return models.RecurringOccurrence{}, violation("recurring_occurrences", "no expense %d", *o.ExpenseID)
+		}
+	}
+	stored := copyOccurrence(o)
+	stored.Date = recurrence.Day(o.Date.Time)
+	return stored, nil
+}
+
+// recurringIDs returns the ID of every stored template, in ascending order.
+func (d *db) recurringIDs() []int {
+	ids := make([]int, 0, len(d.recurring))
+	for id := range d.recurring {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func copyOccurrence(o models.RecurringOccurrence) models.RecurringOccurrence {
+	o.ExpenseID = intPtr(o.ExpenseID)
+	if o.Error != nil {
+		reason := *o.Error
+		o.Error = &reason
+	}
+	return o
+}
+
+func datePtr(d *recurrence.Date) *recurrence.Date {
+	if d == nil {
+		return nil
+	}
+	v := *d
+	return &v
+}
@@ -0,0 +1,255 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type settlements struct{ store }
+
+// settlementKey identifies a settlement; group and personal ones are numbered separately.
+type settlementKey struct {
+	kind string
+	id   int
+}
+
+// settlementRow is a settlement as its table holds it; ReversedBy is worked out when read.
+type settlementRow struct {
+	models.Settlement
+}
+
+// settlementTables maps a settlement kind to the table, and so the ID sequence, it is kept in.
+var settlementTables = map[string]string{
+	"group":    "group_settlements",
+	"personal": "personal_settlements",
+}
+
+var settlementStatuses = map[models.SettlementStatus]bool{
+	models.SettlementPending:   true,
+	models.SettlementConfirmed: true,
+	models.SettlementRejected:  true,
+	models.SettlementExpired:   true,
+	models.SettlementDisputed:  true,
+}
+
+func settlementTable(kind string) (string, error) {
+	table, ok := settlementTables[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown settlement kind %q", kind)
+	}
+	return table, nil
+}
+
+func (r settlements) Create(ctx context.Context, s *models.Settlement) error {
+	table, err := settlementTable(s.Type)
+	if err != nil {
+		return err
+	}
+	if s.Type == "group" && s.GroupID == nil {
+		return fmt.Errorf("group settlement without a group")
+	}
+
+	defer r.lock(ctx)()
+
+	id := r.db.next(table)
+	if !settlementStatuses[s.Status] {
+		return violation(table, "invalid status %q", s.Status)
+	}
+	rate, err := storedRate(table, s.ExchangeRate)
+	if err != nil {
+		return err
+	}
+	if s.ReversalOf != nil {
+		for key, row := range r.db.settlements {
+			if key.kind == s.Type && row.ReversalOf != nil && *row.ReversalOf == *s.ReversalOf {
+				return violation(table, "settlement %d is already reversed", *s.ReversalOf)
+			}
+		}
+		if _, ok := r.db.settlements[settlementKey{s.Type, *s.ReversalOf}]; !ok {
+			return violation(table, "no settlement %d to reverse", *s.ReversalOf)
+		}
+	}
+	if s.Type == "group" {
+		if _, ok := r.db.groups[*s.GroupID]; !ok {
+			return violation(table, "no group %d", *s.GroupID)
+		}
+	}
+	for _, userID := range []*int{&s.DebtorID, &s.CreditorID, s.CreatedBy} {
+		if userID == nil {
+			continue
+		}
+		if _, ok := r.db.users[*userID]; !ok {
+			return violation(table, "no user %d", *userID)
+		}
+	}
+
+	stored := models.Settlement{
+		ID:           id,
+		Type:         s.Type,
+		DebtorID:     s.DebtorID,
+		CreditorID:   s.CreditorID,
+		Amount:       s.Amount,
+		Currency:     s.Currency,
+		Status:       s.Status,
+		ReversalOf:   intPtr(s.ReversalOf),
+		CreatedBy:    intPtr(s.CreatedBy),
+		CreatedAt:    r.now(ctx),
+		ExchangeRate: rate,
+	}
+	if s.Type == "group" {
+		stored.GroupID = intPtr(s.GroupID)
+	}
+	if s.ExpiresAt != nil {
+		stored.ExpiresAt = timePtr(s.ExpiresAt.UTC().Round(time.Microsecond))
+	}
+	r.db.settlements[settlementKey{s.Type, id}] = settlementRow{stored}
+	s.ID, s.CreatedAt = id, stored.CreatedAt
+	return nil
+}
+
+// Lock is List by ID: the transaction ctx is in already holds every settlement.
+func (r settlements) Lock(ctx context.Context, kind string, id int) (*models.Settlement, error) {
+	if _, err := settlementTable(kind); err != nil {
+		return nil, err
+	}
+	list, err := r.List(ctx, repository.SettlementFilter{Type: kind, ID: &id})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return &list[0], nil
+}
+
+func (r settlements) SetStatus(ctx context.Context, kind string, id int, status models.SettlementStatus, reason *string) error {
+	table, err := settlementTable(kind)
+	if err != nil {
+		return err
+	}
+
+	defer r.lock(ctx)()
+
+	key := settlementKey{kind, id}
+	row, ok := r.db.settlements[key]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if !settlementStatuses[status] {
+		return violation(table, "invalid status %q", status)
+	}
+	row.Status = status
+	row.StatusReason = nil
+	if reason != nil {
+		text := *reason
+		row.StatusReason = &text
+	}
+	row.RespondedAt = timePtr(r.now(ctx))
+	r.db.settlements[key] = row
+	return nil
+}
+
+func (r settlements) ExpirePending(ctx context.Context) error {
+	defer r.lock(ctx)()
+
+	t := r.now(ctx)
+	for key, row := range r.db.settlements {
+		if row.Status == models.SettlementPending && row.ExpiresAt != nil && !row.ExpiresAt.After(t) {
+			row.Status = models.SettlementExpired
+			r.db.settlements[key] = row
+		}
+	}
+	return nil
+}
+
+// LockDebtor has nothing to do: the transaction ctx is in already runs alone.
+func (r settlements) LockDebtor(ctx context.Context, debtorID int) error {
+	return nil
+}
+
+func (r settlements) List(ctx context.Context, filter repository.SettlementFilter) ([]models.Settlement, error) {
+	defer r.lock(ctx)()
+
+	t := r.now(ctx)
+	reversedBy := make(map[settlementKey]int)
+	for key, row := range r.db.settlements {
+		if row.ReversalOf != nil {
+			reversedBy[settlementKey{key.kind, *row.ReversalOf}] = key.id
+		}
+	}
+
+	list := []models.Settlement{}
+	for key, row := range r.db.settlements {
+		s := row.Settlement
+		if !settlementMatches(filter, s, t) {
+			continue
+		}
+		if id, ok := reversedBy[key]; ok {
+			s.ReversedBy = &id
+		}
+		s.GroupID, s.ReversalOf, s.CreatedBy = intPtr(s.GroupID), intPtr(s.ReversalOf), intPtr(s.CreatedBy)
+		if s.ExpiresAt != nil {
+			s.ExpiresAt = timePtr(*s.ExpiresAt)
+		}
+		if s.RespondedAt != nil {
+			s.RespondedAt = timePtr(*s.RespondedAt)
+		}
+		if s.StatusReason != nil {
+			reason := *s.StatusReason
+			s.StatusReason = &reason
+		}
+		s.ExchangeRate = copyRate(s.ExchangeRate)
+		list = append(list, s)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.ID > b.ID
+	})
+	return list, nil
+}
+
+// settlementMatches reports whether s passes every condition of filter at time t.
+func settlementMatches(filter repository.SettlementFilter, s models.Settlement, t time.Time) bool {
+	switch {
+	case filter.Type != "" && s.Type != filter.Type:
+		return false
+	case filter.ID != nil && s.ID != *filter.ID:
+		return false
+	case filter.GroupID != nil && (s.GroupID == nil || *s.GroupID != *filter.GroupID):
+		return false
+	case filter.DebtorID != nil && s.DebtorID != *filter.DebtorID:
+		return false
+	case filter.CreditorID != nil && s.CreditorID != *filter.CreditorID:
+		return false
+	case filter.Status != "" && s.Status != filter.Status:
+		return false
+	case filter.AwaitingConfirmation && (s.Status != models.SettlementPending || (s.ExpiresAt != nil && !s.ExpiresAt.After(t))):
+		return false
+	case filter.From != nil && s.CreatedAt.Before(filter.From.UTC()):
+		return false
+	case filter.To != nil && !s.CreatedAt.Before(filter.To.UTC()):
+		return false
+	}
+
+	if filter.UserID != nil {
+		user := *filter.UserID
+		if filter.OtherUserID != nil {
+			other := *filter.OtherUserID
+			return (s.DebtorID == user && s.CreditorID == other) || (s.DebtorID == other && s.CreditorID == user)
+		}
+		return s.DebtorID == user || s.CreditorID == user
+	}
+	return true
+}
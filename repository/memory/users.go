@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type users struct{ store }
+
+func (r users) Create(ctx context.Context, user *models.User) error {
+	defer r.lock(ctx)()
+
+	id := r.db.next("users")
+	for _, u := range r.db.users {
+		if u.Email == user.Email {
+			return repository.ErrDuplicate
+		}
+	}
+	r.db.users[id] = models.User{ID: id, Name: user.Name, Email: user.Email, Password: user.Password, TimeZone: user.TimeZone}
+	user.ID = id
+	return nil
+}
+
+func (r users) Get(ctx context.Context, id int) (*models.User, error) {
+	defer r.lock(ctx)()
+
+	u, ok := r.db.users[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &u, nil
+}
+
+func (r users) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer r.lock(ctx)()
+
+	for _, u := range r.db.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r users) SetPassword(ctx context.Context, id int, hash string) error {
+	return r.update(ctx, id, func(u *models.User) { u.Password = hash })
+}
+
+func (r users) SetTimeZone(ctx context.Context, id int, timeZone string) error {
+	return r.update(ctx, id, func(u *models.User) { u.TimeZone = timeZone })
+}
+
+func (r users) update(ctx context.Context, id int, change func(u *models.User)) error {
+	defer r.lock(ctx)()
+
+	u, ok := r.db.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	change(&u)
+	r.db.users[id] = u
+	return nil
+}
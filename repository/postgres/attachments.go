@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+)
+
+type attachments struct{ store }
+
+const attachmentColumns = `id, expense_id, storage_key, file_name, content_type, size_bytes, checksum,
+	width, height, thumbnail_key, thumbnail_width, thumbnail_height, uploaded_by, created_at`
+
+func (r attachments) Create(ctx context.Context, a *models.Attachment) error {
+	var thumbWidth, thumbHeight *int
+	if a.Thumbnail != nil {
+		thumbWidth, thumbHeight = &a.Thumbnail.Width, &a.Thumbnail.Height
+	}
+	return r.q(ctx).QueryRow(`
+		INSERT INTO expense_attachments (expense_id, storage_key, file_name, content_type, size_bytes, checksum,
+		                                 width, height, thumbnail_key, thumbnail_width, thumbnail_height, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at`,
+		a.ExpenseID, a.StorageKey, a.FileName, a.ContentType, a.Size, a.Checksum,
+		a.Width, a.Height, a.ThumbnailKey, thumbWidth, thumbHeight, a.UploadedBy,
+	).Scan(&a.ID, &a.CreatedAt)
+}
+
+func (r attachments) Get(ctx context.Context, expenseID, id int) (*models.Attachment, error) {
+	a, err := scanAttachment(r.q(ctx).QueryRow(`SELECT `+attachmentColumns+` FROM expense_attachments
+		WHERE id = $1 AND expense_id = $2`, id, expenseID))
+	return a, notFound(err)
+}
+
+func (r attachments) List(ctx context.Context, expenseID int) ([]models.Attachment, error) {
+	rows, err := r.q(ctx).Query(`SELECT `+attachmentColumns+` FROM expense_attachments
+		WHERE expense_id = $1
+		ORDER BY created_at, id`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+func (r attachments) Delete(ctx context.Context, id int) error {
+	return mustAffect(r.q(ctx).Exec(`DELETE FROM expense_attachments WHERE id = $1`, id))
+}
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (*models.Attachment, error) {
+	var a models.Attachment
+	var thumbWidth, thumbHeight *int
+	err := row.Scan(&a.ID, &a.ExpenseID, &a.StorageKey, &a.FileName, &a.ContentType, &a.Size, &a.Checksum,
+		&a.Width, &a.Height, &a.ThumbnailKey, &thumbWidth, &thumbHeight, &a.UploadedBy, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if a.ThumbnailKey != nil && thumbWidth != nil && thumbHeight != nil {
+		a.Thumbnail = &models.AttachmentThumbnail{Width: *thumbWidth, Height: *thumbHeight}
+	}
+	return &a, nil
+}
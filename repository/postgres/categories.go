@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+func (r expenses) Categories(ctx context.Context, groupID *int) ([]models.Category, error) {
+	rows, err := r.q(ctx).Query(`
+		SELECT id, name, group_id
+		FROM categories
+		WHERE group_id IS NULL OR group_id = $1
+		ORDER BY group_id NULLS FIRST, LOWER(name)`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.GroupID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func (r expenses) Category(ctx context.Context, id int) (*models.Category, error) {
+	var c models.Category
+	err := r.q(ctx).QueryRow(`SELECT id, name, group_id FROM categories WHERE id = $1`, id).Scan(&c.ID, &c.Name, &c.GroupID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (r expenses) CategoryByName(ctx context.Context, name string, groupID *int) (*models.Category, error) {
+	var c models.Category
+	err := r.q(ctx).QueryRow(`
+		SELECT id, name, group_id FROM categories
+		WHERE LOWER(name) = LOWER($1) AND (group_id IS NULL OR group_id = $2)`, name, groupID).
+		Scan(&c.ID, &c.Name, &c.GroupID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (r expenses) CreateCategory(ctx context.Context, category *models.Category, createdBy int) error {
+	err := r.q(ctx).QueryRow(`
+		INSERT INTO categories (group_id, name, created_by)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM categories WHERE group_id IS NULL AND LOWER(name) = LOWER($2))
+		ON CONFLICT DO NOTHING
+		RETURNING id`, category.GroupID, category.Name, createdBy).Scan(&category.ID)
+	if err == sql.ErrNoRows {
+		return repository.ErrDuplicate
+	}
+	return err
+}
+
+func (r expenses) DeleteCategory(ctx context.Context, groupID, categoryID int) error {
+	return mustAffect(r.q(ctx).Exec(`DELETE FROM categories WHERE id = $1 AND group_id = $2`, categoryID, groupID))
+}
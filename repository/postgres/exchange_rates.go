@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/utils"
+)
+
+// exchangeRates reads and saves the exchange_rates table.
+type exchangeRates struct{ store }
+
+func (r exchangeRates) Rate(from, to string, date time.Time) (*big.Rat, error) {
+	return rates.Cross(from, to, date, r.pairRate)
+}
+
+// pairRate reads the latest direct or inverted rate between two currencies, returning a bare
+// rates.ErrNoRate when there is none.
+func (r exchangeRates) pairRate(from, to string, date time.Time) (*big.Rat, error) {
+	var value string
+	var inverse bool
+	err := r.db.QueryRow(`
+		SELECT rate::text, base_currency <> $1
+		FROM exchange_rates
+		WHERE ((base_currency = $1 AND quote_currency = $2) OR (base_currency = $2 AND quote_currency = $1))
+		  AND rate_date <= $3::date
+		ORDER BY rate_date DESC, base_currency = $1 DESC
+		LIMIT 1`, from, to, date.Format(rates.DateLayout)).Scan(&value, &inverse)
+	if err == sql.ErrNoRows {
+		return nil, rates.ErrNoRate
+	} else if err != nil {
+		return nil, err
+	}
+
+	rate, err := rates.ParseRate(value)
+	if err != nil {
+		return nil, fmt.Errorf("stored rate for %s/%s: %w", from, to, err)
+	}
+	if inverse {
+		rate.Inv(rate)
+	}
+	return rate, nil
+}
+
+func (r exchangeRates) Save(ctx context.Context, imported []rates.Rate) error {
+	return r.inTx(ctx, func(q utils.Querier) error {
+		for _, rate := range imported {
+			_, err := q.Exec(`
+				INSERT INTO exchange_rates (base_currency, quote_currency, rate_date, rate)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (base_currency, quote_currency, rate_date) DO UPDATE SET rate = EXCLUDED.rate`,
+				rate.Base, rate.Quote, rate.Date, rates.FormatRate(rate.Value))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
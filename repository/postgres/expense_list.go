@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+var errCursorWithoutDate = errors.New("cursor for a date sort has no date")
+
+func (r expenses) List(ctx context.Context, filter repository.ExpenseFilter) (*repository.ExpensePage, error) {
+	q := r.q(ctx)
+	conds, args := conditions(filter)
+	where := strings.Join(conds, " AND ")
+
+	page := &repository.ExpensePage{}
+	if err := q.QueryRow(`SELECT COUNT(*) FROM expenses e WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	column, direction, compare := sortColumn(filter), "ASC", ">"
+	if filter.Desc {
+		direction, compare = "DESC", "<"
+	}
+	if filter.After != nil {
+		var value interface{} = filter.After.Amount
+		if filter.Sort != repository.SortByAmount {
+			if filter.After.Date == nil {
+				return nil, errCursorWithoutDate
+			}
+			value = filter.After.Date.Time
+		}
+		args = append(args, value, filter.After.ID)
+		where += fmt.Sprintf(" AND (%s, e.id) %s ($%d, $%d)", column, compare, len(args)-1, len(args))
+	}
+	args = append(args, filter.Limit+1)
+
+	// The IDs come first, using the sort index and the cursor; then just those expenses are read.
+	rows, err := q.Query(fmt.Sprintf(`
+		SELECT e.id
+		FROM expenses e
+		WHERE %s
+		ORDER BY %s %s, e.id %s
+		LIMIT $%d`, where, column, direction, direction, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		if len(ids) == filter.Limit {
+			// The extra row only tells us there is another page.
+			page.More = true
+			break
+		}
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	loaded, _, err := loadExpenses(q, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if expense, ok := loaded[id]; ok {
+			page.Expenses = append(page.Expenses, *expense)
+		}
+	}
+	return page, nil
+}
+
+// conditions returns the WHERE clause selecting filter's expenses, leaving out the cursor, and
+// its arguments.
+func conditions(filter repository.ExpenseFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions = append(conditions, "e.group_id = "+arg(filter.GroupID), "e.deleted_at IS NULL")
+	if filter.Uncategorized {
+		conditions = append(conditions, "e.category_id IS NULL")
+	} else if filter.CategoryID != nil {
+		conditions = append(conditions, "e.category_id = "+arg(*filter.CategoryID))
+	}
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM expense_tags t WHERE t.expense_id = e.id AND t.tag = "+arg(tag)+")")
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "e.expense_date >= "+arg(filter.From.Time))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "e.expense_date <= "+arg(filter.To.Time))
+	}
+	if filter.PayerID != nil {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM contributors c WHERE c.expense_id = e.id AND c.user_id = "+arg(*filter.PayerID)+" AND c.paid_amount > 0)")
+	}
+	if filter.ParticipantID != nil {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM contributors c WHERE c.expense_id = e.id AND c.user_id = "+arg(*filter.ParticipantID)+")")
+	}
+	if filter.MinAmount != nil {
+		conditions = append(conditions, "e.amount >= "+arg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		conditions = append(conditions, "e.amount <= "+arg(*filter.MaxAmount))
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, `e.description ILIKE `+arg("%"+escapeLike(filter.Search)+"%")+` ESCAPE '\'`)
+	}
+	return conditions, args
+}
+
+// sortColumn is the column filter orders by, before the ID tie-break.
+func sortColumn(filter repository.ExpenseFilter) string {
+	if filter.Sort == repository.SortByAmount {
+		return "e.amount"
+	}
+	return "e.expense_date"
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+func TestExpenseListConditions(t *testing.T) {
+	payer := 7
+	f := repository.ExpenseFilter{GroupID: 1, PayerID: &payer, Search: `50%_off\`}
+	conditions, args := conditions(f)
+
+	where := strings.Join(conditions, " AND ")
+	for _, want := range []string{"e.group_id = $1", "e.deleted_at IS NULL", "c.user_id = $2 AND c.paid_amount > 0", `e.description ILIKE $3 ESCAPE '\'`} {
+		if !strings.Contains(where, want) {
+			t.Errorf("conditions %q missing %q", where, want)
+		}
+	}
+	if len(args) != 3 || args[2] != `%50\%\_off\\%` {
+		t.Fatalf("args = %q", args)
+	}
+}
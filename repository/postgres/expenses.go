@@ -0,0 +1,370 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/lib/pq"
+)
+
+type expenses struct{ store }
+
+func (r expenses) Create(ctx context.Context, expense *models.Expense) error {
+	return r.inTx(ctx, func(q utils.Querier) error {
+		rate, rateCurrency := expense.ExchangeRate.Columns()
+		err := q.QueryRow(`
+			INSERT INTO expenses (group_id, description, amount, currency, created_by, split_type, expense_type, exchange_rate, rate_currency, category_id,
+			                      tax, tip, discount, expense_date, time_zone)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id, created_at, updated_at`,
+			expense.GroupID, expense.Description, expense.Amount, expense.Currency, expense.CreatedBy, expense.SplitType, expense.ExpenseType, rate, rateCurrency, expense.CategoryID,
+			expense.Tax, expense.Tip, expense.Discount, expense.ExpenseDate.Time, expense.TimeZone,
+		).Scan(&expense.ID, &expense.CreatedAt, &expense.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return replaceChildren(q, expense)
+	})
+}
+
+func (r expenses) Get(ctx context.Context, id int) (*models.Expense, bool, error) {
+	return readExpense(r.q(ctx), id)
+}
+
+func (r expenses) Lock(ctx context.Context, id int) (*models.Expense, bool, error) {
+	q := r.q(ctx)
+	var locked int
+	if err := q.QueryRow(`SELECT id FROM expenses WHERE id = $1 FOR UPDATE`, id).Scan(&locked); err != nil {
+		return nil, false, notFound(err)
+	}
+	return readExpense(q, id)
+}
+
+func (r expenses) Update(ctx context.Context, expense *models.Expense) error {
+	return r.inTx(ctx, func(q utils.Querier) error {
+		rate, rateCurrency := expense.ExchangeRate.Columns()
+		err := q.QueryRow(`
+			UPDATE expenses SET description = $1, amount = $2, currency = $3, split_type = $4, exchange_rate = $5, rate_currency = $6, category_id = $7,
+			                    tax = $8, tip = $9, discount = $10, expense_date = $11, time_zone = $12, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $13
+			RETURNING updated_at`, expense.Description, expense.Amount, expense.Currency, expense.SplitType, rate, rateCurrency, expense.CategoryID,
+			expense.Tax, expense.Tip, expense.Discount, expense.ExpenseDate.Time, expense.TimeZone, expense.ID,
+		).Scan(&expense.UpdatedAt)
+		if err != nil {
+			return notFound(err)
+		}
+
+		if _, err := q.Exec(`DELETE FROM amounts_owed WHERE expense_id = $1`, expense.ID); err != nil {
+			return err
+		}
+		if _, err := q.Exec(`DELETE FROM contributors WHERE expense_id = $1`, expense.ID); err != nil {
+			return err
+		}
+		return replaceChildren(q, expense)
+	})
+}
+
+func (r expenses) Delete(ctx context.Context, id, deletedBy int) error {
+	return mustAffect(r.q(ctx).Exec(`
+		UPDATE expenses SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND deleted_at IS NULL`, deletedBy, id))
+}
+
+func (r expenses) Undelete(ctx context.Context, id int) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE expenses SET deleted_at = NULL, deleted_by = NULL WHERE id = $1`, id))
+}
+
+// readExpense reads one expense with everything stored alongside it.
+func readExpense(q utils.Querier, id int) (*models.Expense, bool, error) {
+	loaded, deleted, err := loadExpenses(q, []int{id})
+	if err != nil {
+		return nil, false, err
+	}
+	expense, ok := loaded[id]
+	if !ok {
+		return nil, false, repository.ErrNotFound
+	}
+	return expense, deleted[id], nil
+}
+
+// loadExpenses reads the given expenses with their splits, tags and items, keyed by ID, and which of
+// them are deleted.
+func loadExpenses(q utils.Querier, ids []int) (map[int]*models.Expense, map[int]bool, error) {
+	rows, err := q.Query(`
+		SELECT e.id, e.description, e.amount, e.currency, e.split_type, e.expense_type, e.created_by, e.group_id, e.created_at,
+		       e.exchange_rate::text, e.rate_currency, e.category_id, COALESCE(cat.name, ''), e.tax, e.tip, e.discount,
+		       e.expense_date, e.time_zone, e.updated_at, e.deleted_at IS NOT NULL
+		FROM expenses e
+		LEFT JOIN categories cat ON cat.id = e.category_id
+		WHERE e.id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	loaded := make(map[int]*models.Expense, len(ids))
+	deleted := make(map[int]bool)
+	for rows.Next() {
+		var e models.Expense
+		var rate, rateCurrency sql.NullString
+		var expenseDate time.Time
+		var isDeleted bool
+		err := rows.Scan(&e.ID, &e.Description, &e.Amount, &e.Currency, &e.SplitType, &e.ExpenseType, &e.CreatedBy, &e.GroupID, &e.CreatedAt,
+			&rate, &rateCurrency, &e.CategoryID, &e.Category, &e.Tax, &e.Tip, &e.Discount,
+			&expenseDate, &e.TimeZone, &e.UpdatedAt, &isDeleted)
+		if err != nil {
+			return nil, nil, err
+		}
+		date := recurrence.Day(expenseDate)
+		e.ExpenseDate = &date
+		if e.ExchangeRate, err = rates.ScanSnapshot(rate, rateCurrency); err != nil {
+			return nil, nil, err
+		}
+		loaded[e.ID] = &e
+		deleted[e.ID] = isDeleted
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+	if len(loaded) == 0 {
+		return loaded, deleted, nil
+	}
+
+	if err := loadTags(q, ids, loaded); err != nil {
+		return nil, nil, err
+	}
+	if err := loadItems(q, ids, loaded); err != nil {
+		return nil, nil, err
+	}
+	if err := loadSplits(q, ids, loaded); err != nil {
+		return nil, nil, err
+	}
+	return loaded, deleted, nil
+}
+
+func loadTags(q utils.Querier, ids []int, into map[int]*models.Expense) error {
+	rows, err := q.Query(`SELECT expense_id, tag FROM expense_tags WHERE expense_id = ANY($1) ORDER BY expense_id, tag`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		into[id].Tags = append(into[id].Tags, tag)
+	}
+	return rows.Err()
+}
+
+func loadItems(q utils.Querier, ids []int, into map[int]*models.Expense) error {
+	rows, err := q.Query(`
+		SELECT expense_id, description, amount, assigned_to
+		FROM expense_items
+		WHERE expense_id = ANY($1)
+		ORDER BY expense_id, position`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var item models.LineItem
+		var assignedTo pq.Int64Array
+		if err := rows.Scan(&id, &item.Description, &item.Amount, &assignedTo); err != nil {
+			return err
+		}
+		for _, userID := range assignedTo {
+			item.AssignedTo = append(item.AssignedTo, int(userID))
+		}
+		into[id].Items = append(into[id].Items, item)
+	}
+	return rows.Err()
+}
+
+// loadSplits reads the contributors and what each owes, falling back to the contribution amount for
+// rows written before amounts_owed existed.
+func loadSplits(q utils.Querier, ids []int, into map[int]*models.Expense) error {
+	rows, err := q.Query(`
+		SELECT c.expense_id, c.user_id, COALESCE(c.paid_amount, 0), COALESCE(c.percentage, 0), COALESCE(c.share, 0), COALESCE(c.amount, 0),
+		       COALESCE(ao.owed, c.contribution_amount), COALESCE(ao.balance, COALESCE(c.paid_amount, 0) - c.contribution_amount)
+		FROM contributors c
+		LEFT JOIN amounts_owed ao ON ao.expense_id = c.expense_id AND ao.user_id = c.user_id
+		WHERE c.expense_id = ANY($1)
+		ORDER BY c.expense_id, c.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var c models.Contributor
+		var owed models.AmountOwed
+		if err := rows.Scan(&id, &c.UserID, &c.PaidAmount, &c.Percentage, &c.Share, &c.Amount, &owed.Owed, &owed.Balance); err != nil {
+			return err
+		}
+		owed.UserID = c.UserID
+		into[id].Contributors = append(into[id].Contributors, c)
+		into[id].AmountsOwed = append(into[id].AmountsOwed, owed)
+	}
+	return rows.Err()
+}
+
+// replaceChildren writes the expense's tags, items and splits, replacing any tags and items stored.
+func replaceChildren(q utils.Querier, expense *models.Expense) error {
+	if len(expense.AmountsOwed) != len(expense.Contributors) {
+		return fmt.Errorf("expense %d has %d contributors but %d amounts owed", expense.ID, len(expense.Contributors), len(expense.AmountsOwed))
+	}
+
+	if _, err := q.Exec(`DELETE FROM expense_tags WHERE expense_id = $1`, expense.ID); err != nil {
+		return err
+	}
+	for _, tag := range expense.Tags {
+		if _, err := q.Exec(`INSERT INTO expense_tags (expense_id, tag) VALUES ($1, $2)`, expense.ID, tag); err != nil {
+			return err
+		}
+	}
+
+	if _, err := q.Exec(`DELETE FROM expense_items WHERE expense_id = $1`, expense.ID); err != nil {
+		return err
+	}
+	for i, item := range expense.Items {
+		_, err := q.Exec(`
+			INSERT INTO expense_items (expense_id, position, description, amount, assigned_to)
+			VALUES ($1, $2, $3, $4, $5)`, expense.ID, i, item.Description, item.Amount, pq.Array(item.AssignedTo))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, c := range expense.Contributors {
+		_, err := q.Exec(
+			`INSERT INTO contributors (expense_id, user_id, paid_amount, contribution_amount, percentage, share, amount) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			expense.ID, c.UserID, c.PaidAmount, expense.AmountsOwed[i].Owed, c.Percentage, c.Share, c.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, owed := range expense.AmountsOwed {
+		_, err := q.Exec(`INSERT INTO amounts_owed (expense_id, user_id, owed, balance) VALUES ($1, $2, $3, $4)`,
+			expense.ID, owed.UserID, owed.Owed, owed.Balance)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r expenses) GroupShares(ctx context.Context, groupID int) ([]repository.ExpenseShares, error) {
+	return readShares(r.q(ctx), `e.group_id = $1`, groupID)
+}
+
+func (r expenses) PersonalShares(ctx context.Context, userID int) ([]repository.ExpenseShares, error) {
+	return readShares(r.q(ctx), `e.expense_type = 'personal' AND e.id IN (SELECT expense_id FROM contributors WHERE user_id = $1)`, userID)
+}
+
+// readShares reads the live expenses matching condition with each contributor's part.
+func readShares(q utils.Querier, condition string, arg interface{}) ([]repository.ExpenseShares, error) {
+	rows, err := q.Query(`
+		SELECT e.id, e.description, e.currency, e.expense_date, e.exchange_rate::text, e.rate_currency, e.category_id, COALESCE(cat.name, ''),
+		       c.user_id, COALESCE(c.paid_amount, 0), c.contribution_amount
+		FROM expenses e
+		JOIN contributors c ON c.expense_id = e.id
+		LEFT JOIN categories cat ON cat.id = e.category_id
+		WHERE `+condition+` AND e.deleted_at IS NULL
+		ORDER BY e.id, c.user_id`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []repository.ExpenseShares
+	for rows.Next() {
+		var e repository.ExpenseShares
+		var date time.Time
+		var rate, rateCurrency sql.NullString
+		var share repository.Share
+		if err := rows.Scan(&e.ID, &e.Description, &e.Currency, &date, &rate, &rateCurrency, &e.CategoryID, &e.Category,
+			&share.UserID, &share.Paid, &share.Owed); err != nil {
+			return nil, err
+		}
+		if len(list) == 0 || list[len(list)-1].ID != e.ID {
+			e.Date = recurrence.Day(date)
+			if e.ExchangeRate, err = rates.ScanSnapshot(rate, rateCurrency); err != nil {
+				return nil, err
+			}
+			list = append(list, e)
+		}
+		current := &list[len(list)-1]
+		current.Shares = append(current.Shares, share)
+	}
+	return list, rows.Err()
+}
+
+func (r expenses) SaveRevision(ctx context.Context, expense *models.Expense, action string, actorID int) error {
+	snapshot, err := json.Marshal(expense)
+	if err != nil {
+		return err
+	}
+	_, err = r.q(ctx).Exec(`
+		INSERT INTO expense_revisions (expense_id, revision, action, snapshot, actor_id)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4 FROM expense_revisions WHERE expense_id = $1`,
+		expense.ID, action, snapshot, actorID)
+	return err
+}
+
+func (r expenses) Revisions(ctx context.Context, expenseID int) ([]models.ExpenseRevision, error) {
+	rows, err := r.q(ctx).Query(`
+		SELECT revision, action, actor_id, created_at, snapshot
+		FROM expense_revisions
+		WHERE expense_id = $1
+		ORDER BY revision`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.ExpenseRevision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (r expenses) Revision(ctx context.Context, expenseID, revision int) (*models.ExpenseRevision, error) {
+	rev, err := scanRevision(r.q(ctx).QueryRow(`
+		SELECT revision, action, actor_id, created_at, snapshot
+		FROM expense_revisions
+		WHERE expense_id = $1 AND revision = $2`, expenseID, revision))
+	return rev, notFound(err)
+}
+
+func scanRevision(row interface{ Scan(...interface{}) error }) (*models.ExpenseRevision, error) {
+	var rev models.ExpenseRevision
+	var snapshot []byte
+	if err := row.Scan(&rev.Revision, &rev.Action, &rev.ActorID, &rev.CreatedAt, &snapshot); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(snapshot, &rev.Snapshot); err != nil {
+		return nil, fmt.Errorf("decode revision %d: %w", rev.Revision, err)
+	}
+	return &rev, nil
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/lib/pq"
+)
+
+type groups struct{ store }
+
+func (r groups) Create(ctx context.Context, group *models.Group, ownerID int) error {
+	return r.inTx(ctx, func(q utils.Querier) error {
+		err := q.QueryRow(`INSERT INTO groups (name, base_currency, created_by) VALUES ($1, $2, $3) RETURNING id, created_at`,
+			group.Name, group.BaseCurrency, ownerID).Scan(&group.ID, &group.CreatedAt)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(`INSERT INTO group_users (group_id, user_id, role) VALUES ($1, $2, $3)`, group.ID, ownerID, models.RoleOwner)
+		return err
+	})
+}
+
+func (r groups) Get(ctx context.Context, id int) (*models.Group, error) {
+	var g models.Group
+	err := r.q(ctx).QueryRow(`SELECT id, name, base_currency, COALESCE(created_at, CURRENT_TIMESTAMP) FROM groups WHERE id = $1`, id).
+		Scan(&g.ID, &g.Name, &g.BaseCurrency, &g.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &g, nil
+}
+
+func (r groups) Rename(ctx context.Context, id int, name string) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE groups SET name = $1 WHERE id = $2`, name, id))
+}
+
+func (r groups) SetBaseCurrency(ctx context.Context, id int, currency string) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE groups SET base_currency = $1 WHERE id = $2`, currency, id))
+}
+
+func (r groups) Role(ctx context.Context, groupID, userID int) (models.Role, bool, error) {
+	var role models.Role
+	err := r.q(ctx).QueryRow(`SELECT role FROM group_users WHERE group_id = $1 AND user_id = $2`, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return role, true, nil
+}
+
+func (r groups) AddMember(ctx context.Context, groupID, userID int, role models.Role) error {
+	_, err := r.q(ctx).Exec(`INSERT INTO group_users (group_id, user_id, role) VALUES ($1, $2, $3)`, groupID, userID, role)
+	return duplicate(err)
+}
+
+func (r groups) RemoveMember(ctx context.Context, groupID, userID int) error {
+	return mustAffect(r.q(ctx).Exec(`DELETE FROM group_users WHERE group_id = $1 AND user_id = $2`, groupID, userID))
+}
+
+func (r groups) SetRole(ctx context.Context, groupID, userID int, role models.Role) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE group_users SET role = $1 WHERE group_id = $2 AND user_id = $3`, role, groupID, userID))
+}
+
+func (r groups) TransferOwnership(ctx context.Context, groupID, ownerID, newOwnerID int) error {
+	return r.inTx(ctx, func(q utils.Querier) error {
+		// Demote first so the one-owner-per-group index is never violated mid-transaction.
+		_, err := q.Exec(`UPDATE group_users SET role = $1 WHERE group_id = $2 AND user_id = $3`, models.RoleAdmin, groupID, ownerID)
+		if err != nil {
+			return err
+		}
+		return mustAffect(q.Exec(`UPDATE group_users SET role = $1 WHERE group_id = $2 AND user_id = $3`, models.RoleOwner, groupID, newOwnerID))
+	})
+}
+
+func (r groups) NonMembers(ctx context.Context, groupID int, userIDs []int) ([]int, error) {
+	rows, err := r.q(ctx).Query(`
+		SELECT DISTINCT u.id
+		FROM unnest($2::int[]) AS u(id)
+		WHERE NOT EXISTS (SELECT 1 FROM group_users gu WHERE gu.group_id = $1 AND gu.user_id = u.id)
+		ORDER BY u.id`, groupID, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		missing = append(missing, id)
+	}
+	return missing, rows.Err()
+}
@@ -0,0 +1,80 @@
+// Package postgres implements the repositories on the PostgreSQL schema in db.sql.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/utils"
+	"github.com/lib/pq"
+)
+
+// New returns repositories that keep everything in db. Their transactions are ordinary database
+// transactions, carried in the context with utils.ContextWithTx.
+func New(db *sql.DB) repository.Repositories {
+	s := store{db: db}
+	return repository.Repositories{
+		Users:         users{s},
+		Groups:        groups{s},
+		Expenses:      expenses{s},
+		Settlements:   settlements{s},
+		Recurring:     recurring{s},
+		Attachments:   attachments{s},
+		ExchangeRates: exchangeRates{s},
+		Tx:            s,
+	}
+}
+
+type store struct {
+	db *sql.DB
+}
+
+func (s store) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return utils.RunInTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(utils.ContextWithTx(ctx, tx))
+	})
+}
+
+// q is the transaction ctx carries, or the database itself.
+func (s store) q(ctx context.Context) utils.Querier {
+	return utils.QuerierFor(ctx, s.db)
+}
+
+// inTx runs fn in the transaction ctx carries, or in a new one, for writes that span several rows.
+func (s store) inTx(ctx context.Context, fn func(q utils.Querier) error) error {
+	return utils.RunInTx(ctx, s.db, func(tx *sql.Tx) error { return fn(tx) })
+}
+
+// notFound turns sql.ErrNoRows into repository.ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	return err
+}
+
+// duplicate turns a unique constraint violation into repository.ErrDuplicate.
+func duplicate(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return repository.ErrDuplicate
+	}
+	return err
+}
+
+// mustAffect returns repository.ErrNotFound when result changed no rows.
+func mustAffect(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+)
+
+type recurring struct{ store }
+
+const recurringColumns = `id, template, group_id, created_by, frequency, every, cron, start_date, end_date, next_occurrence, paused`
+
+func (r recurring) Create(ctx context.Context, rec *models.RecurringExpense) error {
+	template, err := json.Marshal(rec.Expense)
+	if err != nil {
+		return err
+	}
+	return r.q(ctx).QueryRow(`
+		INSERT INTO recurring_expenses (template, group_id, created_by, frequency, every, cron, start_date, end_date, next_occurrence, paused)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		template, rec.Expense.GroupID, rec.Expense.CreatedBy, rec.Frequency, recurringEvery(rec.Schedule), nullString(rec.Cron),
+		rec.Start.Time, dateColumn(rec.End), dateColumn(rec.NextOccurrence), rec.Paused,
+	).Scan(&rec.ID)
+}
+
+func (r recurring) Get(ctx context.Context, id int) (*models.RecurringExpense, error) {
+	return r.get(ctx, id, "")
+}
+
+func (r recurring) Lock(ctx context.Context, id int) (*models.RecurringExpense, error) {
+	return r.get(ctx, id, " FOR UPDATE")
+}
+
+func (r recurring) TryLock(ctx context.Context, id int) (*models.RecurringExpense, error) {
+	return r.get(ctx, id, " FOR UPDATE SKIP LOCKED")
+}
+
+func (r recurring) get(ctx context.Context, id int, lock string) (*models.RecurringExpense, error) {
+	rec, err := scanRecurring(r.q(ctx).QueryRow(`SELECT `+recurringColumns+` FROM recurring_expenses WHERE id = $1`+lock, id))
+	return rec, notFound(err)
+}
+
+func (r recurring) List(ctx context.Context, filter repository.RecurringFilter) ([]models.RecurringExpense, error) {
+	query := `
+		SELECT ` + recurringColumns + `
+		FROM recurring_expenses
+		WHERE (created_by = $1
+		   OR group_id IN (SELECT group_id FROM group_users WHERE user_id = $1)
+		   OR (group_id IS NULL AND template->'contributors' @> jsonb_build_array(jsonb_build_object('user_id', $1::int))))`
+	args := []interface{}{filter.VisibleTo}
+	if filter.GroupID != nil {
+		query += ` AND group_id = $2`
+		args = append(args, *filter.GroupID)
+	}
+
+	rows, err := r.q(ctx).Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.RecurringExpense
+	for rows.Next() {
+		rec, err := scanRecurring(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *rec)
+	}
+	return list, rows.Err()
+}
+
+func (r recurring) Due(ctx context.Context, day recurrence.Date) ([]int, error) {
+	rows, err := r.q(ctx).Query(`
+		SELECT id FROM recurring_expenses
+		WHERE NOT paused AND next_occurrence <= $1
+		ORDER BY id`, day.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r recurring) Update(ctx context.Context, rec *models.RecurringExpense) error {
+	template, err := json.Marshal(rec.Expense)
+	if err != nil {
+		return err
+	}
+	return mustAffect(r.q(ctx).Exec(`
+		UPDATE recurring_expenses
+		SET template = $1, frequency = $2, every = $3, cron = $4, start_date = $5, end_date = $6, next_occurrence = $7,
+		    paused = $8, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $9`,
+		template, rec.Frequency, recurringEvery(rec.Schedule), nullString(rec.Cron), rec.Start.Time, dateColumn(rec.End),
+		dateColumn(rec.NextOccurrence), rec.Paused, rec.ID))
+}
+
+func (r recurring) SetNextOccurrence(ctx context.Context, id int, next *recurrence.Date) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE recurring_expenses SET next_occurrence = $1 WHERE id = $2`, dateColumn(next), id))
+}
+
+func (r recurring) AddOccurrence(ctx context.Context, recurringID int, o models.RecurringOccurrence) error {
+	result, err := r.q(ctx).Exec(`
+		INSERT INTO recurring_occurrences (recurring_id, occurs_on, status, expense_id, error) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (recurring_id, occurs_on) DO NOTHING`, recurringID, o.Date.Time, o.Status, o.ExpenseID, o.Error)
+	if err := mustAffect(result, err); err == repository.ErrNotFound {
+		return repository.ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r recurring) UpdateOccurrence(ctx context.Context, recurringID int, o models.RecurringOccurrence) error {
+	return mustAffect(r.q(ctx).Exec(`
+		UPDATE recurring_occurrences SET status = $1, expense_id = $2, error = $3
+		WHERE recurring_id = $4 AND occurs_on = $5`, o.Status, o.ExpenseID, o.Error, recurringID, o.Date.Time))
+}
+
+func (r recurring) Occurrences(ctx context.Context, recurringID int) ([]models.RecurringOccurrence, error) {
+	rows, err := r.q(ctx).Query(`
+		SELECT occurs_on, status, expense_id, error
+		FROM recurring_occurrences
+		WHERE recurring_id = $1
+		ORDER BY occurs_on DESC`, recurringID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var occurrences []models.RecurringOccurrence
+	for rows.Next() {
+		var o models.RecurringOccurrence
+		var date time.Time
+		if err := rows.Scan(&date, &o.Status, &o.ExpenseID, &o.Error); err != nil {
+			return nil, err
+		}
+		o.Date = recurrence.Day(date)
+		occurrences = append(occurrences, o)
+	}
+	return occurrences, rows.Err()
+}
+
+func (r recurring) LastOccurrence(ctx context.Context, recurringID int) (*recurrence.Date, error) {
+	var last sql.NullTime
+	err := r.q(ctx).QueryRow(`SELECT MAX(occurs_on) FROM recurring_occurrences WHERE recurring_id = $1 AND status <> 'skipped'`,
+		recurringID).Scan(&last)
+	if err != nil || !last.Valid {
+		return nil, err
+	}
+	day := recurrence.Day(last.Time)
+	return &day, nil
+}
+
+func scanRecurring(row interface{ Scan(...interface{}) error }) (*models.RecurringExpense, error) {
+	var rec models.RecurringExpense
+	var template []byte
+	var groupID sql.NullInt64
+	var createdBy int
+	var cron sql.NullString
+	var start time.Time
+	var end, next sql.NullTime
+	err := row.Scan(&rec.ID, &template, &groupID, &createdBy, &rec.Frequency, &rec.Every, &cron, &start, &end, &next, &rec.Paused)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(template, &rec.Expense); err != nil {
+		return nil, err
+	}
+	rec.Expense.CreatedBy = createdBy
+	rec.Expense.GroupID = nil
+	if groupID.Valid {
+		id := int(groupID.Int64)
+		rec.Expense.GroupID = &id
+	}
+
+	if rec.Frequency == recurrence.Custom {
+		rec.Every = 0
+	}
+	rec.Cron = cron.String
+	rec.Start = recurrence.Day(start)
+	if end.Valid {
+		day := recurrence.Day(end.Time)
+		rec.End = &day
+	}
+	if next.Valid {
+		day := recurrence.Day(next.Time)
+		rec.NextOccurrence = &day
+	}
+	return &rec, nil
+}
+
+// recurringEvery is the stored interval; custom schedules have none, and the column defaults to 1.
+func recurringEvery(s recurrence.Schedule) int {
+	if s.Every == 0 {
+		return 1
+	}
+	return s.Every
+}
+
+func dateColumn(d *recurrence.Date) interface{} {
+	if d == nil {
+		return nil
+	}
+	return d.Time
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/repository"
+	"github.com/ashishsonamm/setu-splitwise/utils"
+)
+
+// awaitingConfirmation matches pending settlements that have not yet expired, even if ExpirePending
+// has not caught up with them.
+const awaitingConfirmation = "s.status = 'pending' AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)"
+
+// settlementTables maps a settlement kind to its table. Only these names are ever put into SQL.
+var settlementTables = map[string]string{
+	"group":    "group_settlements",
+	"personal": "personal_settlements",
+}
+
+type settlements struct{ store }
+
+func settlementTable(kind string) (string, error) {
+	table, ok := settlementTables[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown settlement kind %q", kind)
+	}
+	return table, nil
+}
+
+func (r settlements) Create(ctx context.Context, s *models.Settlement) error {
+	table, err := settlementTable(s.Type)
+	if err != nil {
+		return err
+	}
+	var groupID interface{}
+	columns := "debtor_id, creditor_id, amount, currency, exchange_rate, rate_currency, status, expires_at, reversal_of, created_by"
+	if s.Type == "group" {
+		if s.GroupID == nil {
+			return fmt.Errorf("group settlement without a group")
+		}
+		groupID = *s.GroupID
+		columns = "group_id, " + columns
+	}
+
+	rate, rateCurrency := s.ExchangeRate.Columns()
+	args := []interface{}{s.DebtorID, s.CreditorID, s.Amount, s.Currency, rate, rateCurrency, s.Status, utc(s.ExpiresAt), s.ReversalOf, s.CreatedBy}
+	if groupID != nil {
+		args = append([]interface{}{groupID}, args...)
+	}
+	placeholders := make([]string, len(args))
+	for i := range args {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	return r.q(ctx).QueryRow(`INSERT INTO `+table+` (`+columns+`) VALUES (`+strings.Join(placeholders, ", ")+`) RETURNING id, created_at`,
+		args...).Scan(&s.ID, &s.CreatedAt)
+}
+
+func (r settlements) Lock(ctx context.Context, kind string, id int) (*models.Settlement, error) {
+	table, err := settlementTable(kind)
+	if err != nil {
+		return nil, err
+	}
+	var locked int
+	if err := r.q(ctx).QueryRow(`SELECT id FROM `+table+` WHERE id = $1 FOR UPDATE`, id).Scan(&locked); err != nil {
+		return nil, notFound(err)
+	}
+
+	list, err := r.List(ctx, repository.SettlementFilter{Type: kind, ID: &id})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return &list[0], nil
+}
+
+func (r settlements) SetStatus(ctx context.Context, kind string, id int, status models.SettlementStatus, reason *string) error {
+	table, err := settlementTable(kind)
+	if err != nil {
+		return err
+	}
+	return mustAffect(r.q(ctx).Exec(`UPDATE `+table+` SET status = $1, status_reason = $2, responded_at = CURRENT_TIMESTAMP WHERE id = $3`,
+		status, reason, id))
+}
+
+func (r settlements) ExpirePending(ctx context.Context) error {
+	return r.inTx(ctx, func(q utils.Querier) error {
+		for _, table := range settlementTables {
+			_, err := q.Exec(`UPDATE ` + table + ` SET status = 'expired'
+				WHERE status = 'pending' AND expires_at <= CURRENT_TIMESTAMP`)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r settlements) LockDebtor(ctx context.Context, debtorID int) error {
+	_, err := r.q(ctx).Exec("SELECT pg_advisory_xact_lock($1)", debtorID)
+	return err
+}
+
+func (r settlements) List(ctx context.Context, filter repository.SettlementFilter) ([]models.Settlement, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Type != "" {
+		conditions = append(conditions, "s.type = "+arg(filter.Type))
+	}
+	if filter.ID != nil {
+		conditions = append(conditions, "s.id = "+arg(*filter.ID))
+	}
+	if filter.GroupID != nil {
+		conditions = append(conditions, "s.group_id = "+arg(*filter.GroupID))
+	}
+	if filter.UserID != nil {
+		p := arg(*filter.UserID)
+		if filter.OtherUserID != nil {
+			o := arg(*filter.OtherUserID)
+			conditions = append(conditions, fmt.Sprintf("((s.debtor_id = %s AND s.creditor_id = %s) OR (s.debtor_id = %s AND s.creditor_id = %s))", p, o, o, p))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(s.debtor_id = %s OR s.creditor_id = %s)", p, p))
+		}
+	}
+	if filter.DebtorID != nil {
+		conditions = append(conditions, "s.debtor_id = "+arg(*filter.DebtorID))
+	}
+	if filter.CreditorID != nil {
+		conditions = append(conditions, "s.creditor_id = "+arg(*filter.CreditorID))
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "s.status = "+arg(filter.Status))
+	}
+	if filter.AwaitingConfirmation {
+		conditions = append(conditions, awaitingConfirmation)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "s.created_at >= "+arg(utc(filter.From)))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "s.created_at < "+arg(utc(filter.To)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.q(ctx).Query(`
+		SELECT s.type, s.id, s.group_id, s.debtor_id, s.creditor_id, s.amount, s.currency, s.status, s.reversal_of,
+		       s.reversed_by, s.created_by, s.created_at, s.expires_at, s.responded_at, s.status_reason, s.exchange_rate, s.rate_currency
+		FROM (
+			SELECT 'group' AS type, gs.id, gs.group_id, gs.debtor_id, gs.creditor_id, gs.amount, gs.currency, gs.status, gs.reversal_of,
+			       (SELECT r.id FROM group_settlements r WHERE r.reversal_of = gs.id) AS reversed_by,
+			       gs.created_by, gs.created_at, gs.expires_at, gs.responded_at, gs.status_reason,
+			       gs.exchange_rate::text AS exchange_rate, gs.rate_currency
+			FROM group_settlements gs
+			UNION ALL
+			SELECT 'personal', ps.id, NULL, ps.debtor_id, ps.creditor_id, ps.amount, ps.currency, ps.status, ps.reversal_of,
+			       (SELECT r.id FROM personal_settlements r WHERE r.reversal_of = ps.id),
+			       ps.created_by, ps.created_at, ps.expires_at, ps.responded_at, ps.status_reason,
+			       ps.exchange_rate::text, ps.rate_currency
+			FROM personal_settlements ps
+		) s
+		`+where+`
+		ORDER BY s.created_at DESC, s.type, s.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Settlement{}
+	for rows.Next() {
+		var s models.Settlement
+		var rate, rateCurrency sql.NullString
+		if err := rows.Scan(&s.Type, &s.ID, &s.GroupID, &s.DebtorID, &s.CreditorID, &s.Amount, &s.Currency, &s.Status, &s.ReversalOf,
+			&s.ReversedBy, &s.CreatedBy, &s.CreatedAt, &s.ExpiresAt, &s.RespondedAt, &s.StatusReason, &rate, &rateCurrency); err != nil {
+			return nil, err
+		}
+		if s.ExchangeRate, err = rates.ScanSnapshot(rate, rateCurrency); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// utc is t as the UTC wall time TIMESTAMP columns are written in.
+func utc(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
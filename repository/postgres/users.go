@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+)
+
+type users struct{ store }
+
+const userColumns = `id, name, email, COALESCE(password, ''), time_zone, is_admin`
+
+func (r users) Create(ctx context.Context, user *models.User) error {
+	err := r.q(ctx).QueryRow(`INSERT INTO users (name, email, password, time_zone) VALUES ($1, $2, $3, $4) RETURNING id`,
+		user.Name, user.Email, user.Password, user.TimeZone).Scan(&user.ID)
+	return duplicate(err)
+}
+
+func (r users) Get(ctx context.Context, id int) (*models.User, error) {
+	return scanUser(r.q(ctx).QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (r users) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(r.q(ctx).QueryRow(`SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+func (r users) SetPassword(ctx context.Context, id int, hash string) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE users SET password = $1 WHERE id = $2`, hash, id))
+}
+
+func (r users) SetTimeZone(ctx context.Context, id int, timeZone string) error {
+	return mustAffect(r.q(ctx).Exec(`UPDATE users SET time_zone = $1 WHERE id = $2`, timeZone, id))
+}
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var u models.User
+	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.TimeZone, &u.IsAdmin); err != nil {
+		return nil, notFound(err)
+	}
+	return &u, nil
+}
@@ -0,0 +1,267 @@
+// Package repository is how handlers read and store users, groups, expenses, settlements, recurring
+// expenses, attachments and exchange rates without knowing where they are kept. The postgres package
+// implements it on the application database, the memory package in memory for tests and local demos.
+package repository
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/models"
+	"github.com/ashishsonamm/setu-splitwise/money"
+	"github.com/ashishsonamm/setu-splitwise/rates"
+	"github.com/ashishsonamm/setu-splitwise/recurrence"
+)
+
+var (
+	// ErrNotFound is returned when the row asked for does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a write would break a uniqueness rule, such as a second account
+	// for one email or a second membership of one group.
+	ErrDuplicate = errors.New("already exists")
+)
+
+// Repositories is one implementation of every repository, sharing one Transactor.
+type Repositories struct {
+	Users         UserRepository
+	Groups        GroupRepository
+	Expenses      ExpenseRepository
+	Settlements   SettlementRepository
+	Recurring     RecurringRepository
+	Attachments   AttachmentRepository
+	ExchangeRates ExchangeRateRepository
+	Tx            Transactor
+}
+
+// Transactor runs several repository calls as one unit. Everything fn does with the context it is
+// given is committed if fn returns nil and rolled back otherwise. Called with a context already
+// inside a transaction, fn simply joins it.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// UserRepository stores user accounts.
+type UserRepository interface {
+	// Create stores a new user and sets its ID. It returns ErrDuplicate if the email is taken.
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id int) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// SetPassword replaces the user's password hash.
+	SetPassword(ctx context.Context, id int, hash string) error
+	SetTimeZone(ctx context.Context, id int, timeZone string) error
+}
+
+// GroupRepository stores groups and who belongs to them, with what role.
+type GroupRepository interface {
+	// Create stores a new group with ownerID as its owner and sets its ID and CreatedAt.
+	Create(ctx context.Context, group *models.Group, ownerID int) error
+	Get(ctx context.Context, id int) (*models.Group, error)
+	Rename(ctx context.Context, id int, name string) error
+	SetBaseCurrency(ctx context.Context, id int, currency string) error
+
+	// Role returns the user's role in the group; member is false if they do not belong to it.
+	Role(ctx context.Context, groupID, userID int) (role models.Role, member bool, err error)
+	// AddMember returns ErrDuplicate if the user already belongs to the group.
+	AddMember(ctx context.Context, groupID, userID int, role models.Role) error
+	RemoveMember(ctx context.Context, groupID, userID int) error
+	SetRole(ctx context.Context, groupID, userID int, role models.Role) error
+	// TransferOwnership makes newOwnerID the owner and the current owner, ownerID, an admin.
+	TransferOwnership(ctx context.Context, groupID, ownerID, newOwnerID int) error
+	// NonMembers returns the subset of userIDs that do not belong to the group, in ascending order.
+	NonMembers(ctx context.Context, groupID int, userIDs []int) ([]int, error)
+}
+
+// ExpenseRepository stores expenses with their splits, history and categories.
+type ExpenseRepository interface {
+	// Create stores a new expense with its splits, tags and items, setting its ID and timestamps.
+	// AmountsOwed must line up with Contributors.
+	Create(ctx context.Context, expense *models.Expense) error
+	// Get returns an expense whether or not it has been deleted; deleted reports which.
+	Get(ctx context.Context, id int) (expense *models.Expense, deleted bool, err error)
+	// Lock is Get that also holds the expense until the transaction ends, so concurrent changes to it
+	// are applied one after the other.
+	Lock(ctx context.Context, id int) (expense *models.Expense, deleted bool, err error)
+	// Update overwrites the stored expense, replacing its splits, tags and items, and sets UpdatedAt.
+	Update(ctx context.Context, expense *models.Expense) error
+	// Delete soft-deletes the expense: it is kept for its history but stops counting anywhere.
+	Delete(ctx context.Context, id, deletedBy int) error
+	// Undelete brings a soft-deleted expense back.
+	Undelete(ctx context.Context, id int) error
+
+	// List returns one page of a group's live expenses.
+	List(ctx context.Context, filter ExpenseFilter) (*ExpensePage, error)
+	// GroupShares returns the live expenses of a group, in ID order.
+	GroupShares(ctx context.Context, groupID int) ([]ExpenseShares, error)
+	// PersonalShares returns the live personal expenses userID contributes to, in ID order.
+	PersonalShares(ctx context.Context, userID int) ([]ExpenseShares, error)
+
+	// SaveRevision keeps a snapshot of the expense as it was before a change, numbered after the
+	// expense's previous revisions. action and actorID describe the change.
+	SaveRevision(ctx context.Context, expense *models.Expense, action string, actorID int) error
+	// Revisions returns every revision of the expense, oldest first.
+	Revisions(ctx context.Context, expenseID int) ([]models.ExpenseRevision, error)
+	Revision(ctx context.Context, expenseID, revision int) (*models.ExpenseRevision, error)
+
+	// Categories returns the system categories, then those of the group if groupID is set, by name.
+	Categories(ctx context.Context, groupID *int) ([]models.Category, error)
+	Category(ctx context.Context, id int) (*models.Category, error)
+	// CategoryByName finds a system category or one of the group's by name, ignoring case.
+	CategoryByName(ctx context.Context, name string, groupID *int) (*models.Category, error)
+	// CreateCategory adds a group category and sets its ID. It returns ErrDuplicate if the name is
+	// already used by a system category or another of the group's.
+	CreateCategory(ctx context.Context, category *models.Category, createdBy int) error
+	// DeleteCategory removes one of the group's own categories; their expenses become uncategorized.
+	DeleteCategory(ctx context.Context, groupID, categoryID int) error
+}
+
+const (
+	SortByDate   = "date"
+	SortByAmount = "amount"
+)
+
+// ExpenseFilter selects a group's expenses for a listing, and the order and page to return them in.
+type ExpenseFilter struct {
+	GroupID       int
+	CategoryID    *int
+	Uncategorized bool
+	Tags          []string
+	From, To      *recurrence.Date // expense dates, both inclusive
+	PayerID       *int
+	ParticipantID *int
+	MinAmount     *money.Amount
+	MaxAmount     *money.Amount
+	Search        string // text in the description
+
+	Sort  string // SortByDate or SortByAmount
+	Desc  bool
+	Limit int
+	After *ExpenseCursor
+}
+
+// ExpenseCursor is the last expense of the previous page. Ties in the sort column are broken by ID.
+type ExpenseCursor struct {
+	Date   *recurrence.Date // set when sorting by date
+	Amount money.Amount
+	ID     int
+}
+
+// ExpensePage is one page of a listing. More is set when another page follows.
+type ExpensePage struct {
+	Expenses []models.Expense
+	Total    int // expenses matching the filter, across all pages
+	More     bool
+}
+
+// ExpenseShares is an expense reduced to what balances and reports need: who paid and who owes what.
+type ExpenseShares struct {
+	ID           int
+	Description  string
+	Currency     string
+	Date         recurrence.Date
+	CategoryID   *int
+	Category     string // empty for uncategorized expenses
+	ExchangeRate *rates.Snapshot
+	Shares       []Share // by user ID
+}
+
+// Share is one contributor's part in an expense.
+type Share struct {
+	UserID int
+	Paid   money.Amount
+	Owed   money.Amount
+}
+
+// SettlementRepository stores group and personal settlements; kind is "group" or "personal".
+type SettlementRepository interface {
+	// Create stores a new settlement of the kind given by its Type, setting its ID and CreatedAt.
+	Create(ctx context.Context, settlement *models.Settlement) error
+	// List returns group and personal settlements matching filter, newest first.
+	List(ctx context.Context, filter SettlementFilter) ([]models.Settlement, error)
+	// Lock returns one settlement and holds it until the transaction ends.
+	Lock(ctx context.Context, kind string, id int) (*models.Settlement, error)
+	// SetStatus records the creditor's answer. A nil reason clears the one stored.
+	SetStatus(ctx context.Context, kind string, id int, status models.SettlementStatus, reason *string) error
+	// ExpirePending marks every pending settlement past its expiry as expired.
+	ExpirePending(ctx context.Context) error
+	// LockDebtor serializes settlements paid by one user until the transaction ends, so two
+	// concurrent payments cannot both be checked against the same outstanding balance.
+	LockDebtor(ctx context.Context, debtorID int) error
+}
+
+// SettlementFilter selects settlements; unset fields match everything.
+type SettlementFilter struct {
+	Type        string // "group", "personal" or "" for both
+	ID          *int
+	GroupID     *int
+	UserID      *int // either party
+	OtherUserID *int // the other party, used with UserID
+	DebtorID    *int
+	CreditorID  *int
+	Status      models.SettlementStatus
+	// AwaitingConfirmation matches pending settlements that have not expired, even if ExpirePending
+	// has not caught up with them.
+	AwaitingConfirmation bool
+	From, To             *time.Time // created at or after From and before To
+}
+
+// RecurringRepository stores recurring expense templates and the occurrences handled so far.
+type RecurringRepository interface {
+	// Create stores a new template and sets its ID. Occurrences are ignored.
+	Create(ctx context.Context, rec *models.RecurringExpense) error
+	Get(ctx context.Context, id int) (*models.RecurringExpense, error)
+	// Lock is Get that also holds the template until the transaction ends.
+	Lock(ctx context.Context, id int) (*models.RecurringExpense, error)
+	// TryLock is Lock that returns ErrNotFound rather than waiting when another transaction holds
+	// the template, so concurrent schedulers each take different ones.
+	TryLock(ctx context.Context, id int) (*models.RecurringExpense, error)
+	// List returns the templates matching filter, in ID order.
+	List(ctx context.Context, filter RecurringFilter) ([]models.RecurringExpense, error)
+	// Due returns the IDs of the unpaused templates whose next occurrence is on or before day, in order.
+	Due(ctx context.Context, day recurrence.Date) ([]int, error)
+	// Update overwrites the template, its schedule, next occurrence and paused flag.
+	Update(ctx context.Context, rec *models.RecurringExpense) error
+	// SetNextOccurrence moves the template on; a nil next means its schedule has ended.
+	SetNextOccurrence(ctx context.Context, id int, next *recurrence.Date) error
+
+	// AddOccurrence records a handled date. It returns ErrDuplicate if the date already was.
+	AddOccurrence(ctx context.Context, recurringID int, occurrence models.RecurringOccurrence) error
+	// UpdateOccurrence replaces the status, expense and error of the occurrence on the same date.
+	UpdateOccurrence(ctx context.Context, recurringID int, occurrence models.RecurringOccurrence) error
+	// Occurrences returns every handled date of the template, newest first.
+	Occurrences(ctx context.Context, recurringID int) ([]models.RecurringOccurrence, error)
+	// LastOccurrence returns the latest date an expense was created or attempted for, ignoring
+	// skipped ones, or nil if there is none.
+	LastOccurrence(ctx context.Context, recurringID int) (*recurrence.Date, error)
+}
+
+// RecurringFilter selects templates; an unset GroupID matches every group.
+type RecurringFilter struct {
+	// VisibleTo matches the templates the user created, those of their groups and personal ones
+	// they contribute to.
+	VisibleTo int
+	GroupID   *int
+}
+
+// AttachmentRepository stores the rows describing expenses' attachments; the files themselves are
+// in the blob store.
+type AttachmentRepository interface {
+	// Create stores a new attachment and sets its ID and CreatedAt.
+	Create(ctx context.Context, attachment *models.Attachment) error
+	// Get returns one of the expense's attachments. DownloadURL and the thumbnail's URL are left empty.
+	Get(ctx context.Context, expenseID, id int) (*models.Attachment, error)
+	// List returns the expense's attachments, oldest first.
+	List(ctx context.Context, expenseID int) ([]models.Attachment, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// ExchangeRateRepository stores dated exchange rates. It is a rates.Storage, so a rates.Cache can be
+// put in front of it.
+type ExchangeRateRepository interface {
+	// Rate returns the most recent rate on or before date. A rate stored for the opposite direction
+	// is inverted, and pairs with no rate either way are crossed through rates.Pivot.
+	Rate(from, to string, date time.Time) (*big.Rat, error)
+	// Save stores rates all at once, replacing any already stored for the same pair and date.
+	Save(ctx context.Context, imported []rates.Rate) error
+}
@@ -1,31 +1,112 @@
 package routes
 
 import (
+	"github.com/ashishsonamm/setu-splitwise/apierror"
+	"github.com/ashishsonamm/setu-splitwise/blobstore"
 	"github.com/ashishsonamm/setu-splitwise/handlers"
 	"github.com/ashishsonamm/setu-splitwise/middleware"
+	"github.com/ashishsonamm/setu-splitwise/repository"
 	"github.com/gorilla/mux"
+	"net/http"
 )
 
-func RegisterRoutes() *mux.Router {
+// RegisterRoutes builds the API's router, with every handler reading and writing through repos and
+// attachments' files kept in blobs.
+func RegisterRoutes(repos repository.Repositories, blobs blobstore.BlobStore) *mux.Router {
+	users := handlers.NewUserHandler(repos)
+	groups := handlers.NewGroupHandler(repos)
+	expenses := handlers.NewExpenseHandler(repos)
+	categories := handlers.NewCategoryHandler(repos)
+	attachments := handlers.NewAttachmentHandler(repos, blobs)
+	recurring := handlers.NewRecurringHandler(repos)
+	balances := handlers.NewBalanceHandler(repos)
+	settlements := handlers.NewSettlementHandler(repos)
+	reports := handlers.NewReportHandler(repos)
+	exchangeRates := handlers.NewExchangeRateHandler(repos)
+
 	router := mux.NewRouter()
+	router.Use(middleware.RequestID)
+	// mux skips middleware when no route matches, so these get their request ID themselves.
+	router.NotFoundHandler = middleware.RequestID(http.HandlerFunc(notFound))
+	router.MethodNotAllowedHandler = middleware.RequestID(http.HandlerFunc(methodNotAllowed))
 
-	router.HandleFunc("/api/user", handlers.CreateUser).Methods("POST")
-	router.HandleFunc("/api/login", handlers.Login).Methods("POST")
+	router.HandleFunc("/api/user", users.CreateUser).Methods("POST")
+	router.HandleFunc("/api/login", users.Login).Methods("POST")
 
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(middleware.JWTAuth)
-	api.HandleFunc("/group", handlers.CreateGroup).Methods("POST")
-	api.HandleFunc("/group/addUser", handlers.AddUserToGroup).Methods("POST")
-	api.HandleFunc("/group/removeUser", handlers.RemoveUserFromGroup).Methods("POST")
-	api.HandleFunc("/group/{groupId}/balances", handlers.GetGroupBalances).Methods("GET")
-	api.HandleFunc("/group/{groupId}/balances/{userId}", handlers.GetUserBalanceInAGroup).Methods("GET")
-	api.HandleFunc("/group/{groupId}/expenses", handlers.GetGroupExpenses).Methods("GET")
+	api.HandleFunc("/group", groups.CreateGroup).Methods("POST")
+	api.HandleFunc("/group/addUser", groups.AddUserToGroup).Methods("POST")
+	api.HandleFunc("/group/removeUser", groups.RemoveUserFromGroup).Methods("POST")
+
+	group := api.PathPrefix("/group/{groupId:[0-9]+}").Subrouter()
+	group.Use(middleware.GroupMember(repos.Groups))
+	group.HandleFunc("", groups.RenameGroup).Methods("PUT")
+	group.HandleFunc("/currency", groups.ChangeGroupCurrency).Methods("PUT")
+	group.HandleFunc("/owner", groups.TransferGroupOwnership).Methods("POST")
+	group.HandleFunc("/members/{userId}/role", groups.ChangeMemberRole).Methods("PUT")
+	group.HandleFunc("/balances", balances.GetGroupBalances).Methods("GET")
+	group.HandleFunc("/balances/{userId}", balances.GetUserBalanceInAGroup).Methods("GET")
+	group.HandleFunc("/expenses", expenses.GetGroupExpenses).Methods("GET")
+	group.HandleFunc("/categories", categories.GetGroupCategories).Methods("GET")
+	group.HandleFunc("/categories", categories.CreateGroupCategory).Methods("POST")
+	group.HandleFunc("/categories/{categoryId:[0-9]+}", categories.DeleteGroupCategory).Methods("DELETE")
+	group.HandleFunc("/reports/categories", reports.GetCategoryReport).Methods("GET")
+	group.HandleFunc("/settlements", settlements.GetGroupSettlements).Methods("GET")
+
+	api.HandleFunc("/expense", expenses.AddExpense).Methods("POST")
+	api.HandleFunc("/expense/{id:[0-9]+}", expenses.UpdateExpense).Methods("PUT")
+	api.HandleFunc("/expense/{id:[0-9]+}", expenses.DeleteExpense).Methods("DELETE")
+	api.HandleFunc("/expense/{id:[0-9]+}/history", expenses.GetExpenseHistory).Methods("GET")
+	api.HandleFunc("/expense/{id:[0-9]+}/revisions/{revision:[0-9]+}/restore", expenses.RestoreExpenseRevision).Methods("POST")
+	api.HandleFunc("/categories", categories.GetCategories).Methods("GET")
+	api.HandleFunc("/users/{userId}/time-zone", users.UpdateUserTimeZone).Methods("PUT")
+	api.HandleFunc("/users/{userId}/balance", balances.GetPersonalBalance).Methods("GET")
+	api.HandleFunc("/users/{userId}/balances", balances.GetPersonalBalance).Methods("GET")
+	api.HandleFunc("/users/{userId}/balances/{otherUserId}", balances.GetPersonalPairBalance).Methods("GET")
+
+	api.HandleFunc("/users/{userId}/settlements", settlements.GetUserSettlements).Methods("GET")
+
+	api.HandleFunc("/settle/personal", settlements.SettlePersonalBalance).Methods("POST")
+	api.HandleFunc("/settlements/{kind:group|personal}/{id:[0-9]+}/reverse", settlements.ReverseSettlement).Methods("POST")
+	api.HandleFunc("/settlements/{kind:group|personal}/{id:[0-9]+}/dispute", settlements.DisputeSettlement).Methods("POST")
+	api.HandleFunc("/settlements/{kind:group|personal}/{id:[0-9]+}/confirm", settlements.ConfirmSettlement).Methods("POST")
+	api.HandleFunc("/settlements/{kind:group|personal}/{id:[0-9]+}/reject", settlements.RejectSettlement).Methods("POST")
+	api.HandleFunc("/settlements/pending", settlements.GetPendingSettlements).Methods("GET")
+
+	api.HandleFunc("/exchange-rates", exchangeRates.GetExchangeRate).Methods("GET")
 
-	api.HandleFunc("/expense", handlers.AddExpense).Methods("POST")
-	api.HandleFunc("/users/{userId}/balance", handlers.GetPersonalBalance).Methods("GET")
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.RequireAdmin(repos.Users))
+	admin.HandleFunc("/exchange-rates", exchangeRates.ImportExchangeRates).Methods("POST")
 
-	api.HandleFunc("/settle/personal", handlers.SettlePersonalBalance).Methods("POST")
-	api.HandleFunc("/settle/{groupId}/group/{user1Id}/{user2Id}", handlers.SettleGroupBalanceBetweenUsers).Methods("POST")
+	groupSettle := api.PathPrefix("/settle/{groupId:[0-9]+}").Subrouter()
+	groupSettle.Use(middleware.GroupMember(repos.Groups))
+	groupSettle.HandleFunc("/group/{user1Id}/{user2Id}", settlements.SettleGroupBalanceBetweenUsers).Methods("POST")
+
+	attachmentRoutes := api.PathPrefix("/expense/{id:[0-9]+}/attachments").Subrouter()
+	attachmentRoutes.HandleFunc("", attachments.UploadAttachment).Methods("POST")
+	attachmentRoutes.HandleFunc("", attachments.ListAttachments).Methods("GET")
+	attachmentRoutes.HandleFunc("/{attachmentId:[0-9]+}", attachments.DownloadAttachment).Methods("GET")
+	attachmentRoutes.HandleFunc("/{attachmentId:[0-9]+}/thumbnail", attachments.DownloadAttachmentThumbnail).Methods("GET")
+	attachmentRoutes.HandleFunc("/{attachmentId:[0-9]+}", attachments.DeleteAttachment).Methods("DELETE")
+
+	recurringRoutes := api.PathPrefix("/recurring").Subrouter()
+	recurringRoutes.HandleFunc("", recurring.CreateRecurringExpense).Methods("POST")
+	recurringRoutes.HandleFunc("", recurring.ListRecurringExpenses).Methods("GET")
+	recurringRoutes.HandleFunc("/{id:[0-9]+}", recurring.GetRecurringExpense).Methods("GET")
+	recurringRoutes.HandleFunc("/{id:[0-9]+}", recurring.UpdateRecurringExpense).Methods("PUT")
+	recurringRoutes.HandleFunc("/{id:[0-9]+}/pause", recurring.PauseRecurringExpense).Methods("POST")
+	recurringRoutes.HandleFunc("/{id:[0-9]+}/resume", recurring.ResumeRecurringExpense).Methods("POST")
+	recurringRoutes.HandleFunc("/{id:[0-9]+}/skip", recurring.SkipRecurringOccurrence).Methods("POST")
 
 	return router
 }
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, apierror.NotFound, "No such endpoint")
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, apierror.MethodNotAllowed, r.Method+" is not allowed here")
+}
@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashishsonamm/setu-splitwise/blobstore"
+	"github.com/ashishsonamm/setu-splitwise/repository/memory"
+)
+
+// client calls the API as one user, failing the test on any unexpected status.
+type client struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+func (c *client) call(method, path string, body interface{}, wantStatus int) map[string]interface{} {
+	c.t.Helper()
+	var decoded map[string]interface{}
+	c.callInto(method, path, body, wantStatus, &decoded)
+	return decoded
+}
+
+func (c *client) callInto(method, path string, body interface{}, wantStatus int, into interface{}) {
+	c.t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	raw := c.send(method, path, "", &reader, wantStatus)
+	if err := json.Unmarshal(raw, into); err != nil {
+		c.t.Fatalf("%s %s: decode %s: %v", method, path, raw, err)
+	}
+}
+
+// upload posts data as the "file" field of a multipart form.
+func (c *client) upload(path, fileName string, data []byte, wantStatus int) map[string]interface{} {
+	c.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		c.t.Fatal(err)
+	}
+
+	raw := c.send("POST", path, form.FormDataContentType(), &body, wantStatus)
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		c.t.Fatalf("POST %s: decode %s: %v", path, raw, err)
+	}
+	return decoded
+}
+
+// send returns the body of the response, whatever its type.
+func (c *client) send(method, path, contentType string, body io.Reader, wantStatus int) []byte {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if resp.StatusCode != wantStatus {
+		c.t.Fatalf("%s %s: got %d %s, want %d", method, path, resp.StatusCode, raw, wantStatus)
+	}
+	return raw
+}
+
+// signUp creates a user and returns a client logged in as them, with their ID.
+func signUp(t *testing.T, server *httptest.Server, name string) (*client, int) {
+	t.Helper()
+	anonymous := &client{t: t, server: server}
+	email := name + "@example.com"
+	created := anonymous.call("POST", "/api/user", map[string]string{"name": name, "email": email, "password": "correct horse"}, http.StatusCreated)
+	login := anonymous.call("POST", "/api/login", map[string]string{"email": email, "password": "correct horse"}, http.StatusOK)
+	return &client{t: t, server: server, token: login["token"].(string)}, int(created["user_id"].(float64))
+}
+
+// newServer serves the API on fresh in-memory repositories until the test ends.
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("BCRYPT_COST", "4")
+	blobs, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(RegisterRoutes(memory.New(), blobs))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestGroupExpenseToSettlement runs the API on the in-memory repositories, from signing up to a
+// confirmed settlement, then adds a recurring expense and a receipt to the group.
+func TestGroupExpenseToSettlement(t *testing.T) {
+	server := newServer(t)
+
+	alice, aliceID := signUp(t, server, "alice")
+	bob, bobID := signUp(t, server, "bob")
+
+	group := alice.call("POST", "/api/group", map[string]string{"name": "Trip", "base_currency": "INR"}, http.StatusCreated)
+	groupID := int(group["group_id"].(float64))
+	alice.call("POST", "/api/group/addUser", map[string]int{"groupId": groupID, "userId": bobID}, http.StatusOK)
+	alice.call("POST", "/api/group/addUser", map[string]int{"groupId": groupID, "userId": bobID}, http.StatusConflict)
+
+	dinner := alice.call("POST", "/api/expense", map[string]interface{}{
+		"description": "Dinner",
+		"amount":      "300",
+		"split_type":  "equal",
+		"group_id":    groupID,
+		"contributors": []map[string]interface{}{
+			{"user_id": aliceID, "paid_amount": "300"},
+			{"user_id": bobID, "paid_amount": "0"},
+		},
+	}, http.StatusOK)
+
+	balancesPath := fmt.Sprintf("/api/group/%d/balances", groupID)
+	var transfers []map[string]interface{}
+	bob.callInto("GET", balancesPath, nil, http.StatusOK, &transfers)
+	if len(transfers) != 1 || int(transfers[0]["from"].(float64)) != bobID || int(transfers[0]["to"].(float64)) != aliceID || transfers[0]["amount"].(float64) != 150 {
+		t.Fatalf("balances: got %v", transfers)
+	}
+
+	settled := bob.call("POST", fmt.Sprintf("/api/settle/%d/group/%d/%d", groupID, bobID, aliceID), nil, http.StatusAccepted)
+	settlementID := int(settled["settlement_id"].(float64))
+	bob.callInto("GET", balancesPath, nil, http.StatusOK, &transfers)
+	if len(transfers) != 1 {
+		t.Fatalf("a pending settlement changed the balances: got %v", transfers)
+	}
+	bob.call("POST", fmt.Sprintf("/api/settlements/group/%d/confirm", settlementID), nil, http.StatusForbidden)
+	alice.call("POST", fmt.Sprintf("/api/settlements/group/%d/confirm", settlementID), nil, http.StatusOK)
+
+	bob.callInto("GET", balancesPath, nil, http.StatusOK, &transfers)
+	if len(transfers) != 0 {
+		t.Fatalf("balances after confirming: got %v", transfers)
+	}
+
+	listing := bob.call("GET", fmt.Sprintf("/api/group/%d/expenses", groupID), nil, http.StatusOK)
+	expenses := listing["expenses"].([]interface{})
+	if len(expenses) != 1 || expenses[0].(map[string]interface{})["description"] != "Dinner" {
+		t.Fatalf("expenses: got %v", listing)
+	}
+
+	outsider, _ := signUp(t, server, "carol")
+	outsider.call("GET", balancesPath, nil, http.StatusForbidden)
+
+	// A template starting today has its first expense created straight away.
+	today := time.Now().UTC().Format("2006-01-02")
+	rec := alice.call("POST", "/api/recurring", map[string]interface{}{
+		"expense": map[string]interface{}{
+			"description": "Rent",
+			"amount":      "1000",
+			"split_type":  "equal",
+			"group_id":    groupID,
+			"contributors": []map[string]interface{}{
+				{"user_id": aliceID, "paid_amount": "1000"},
+				{"user_id": bobID, "paid_amount": "0"},
+			},
+		},
+		"frequency":  "monthly",
+		"start_date": today,
+	}, http.StatusCreated)
+	occurrences := rec["occurrences"].([]interface{})
+	if len(occurrences) != 1 || occurrences[0].(map[string]interface{})["date"] != today || occurrences[0].(map[string]interface{})["status"] != "created" {
+		t.Fatalf("occurrences: got %v", rec)
+	}
+	var templates []map[string]interface{}
+	bob.callInto("GET", fmt.Sprintf("/api/recurring?group_id=%d", groupID), nil, http.StatusOK, &templates)
+	if len(templates) != 1 || templates[0]["id"] != rec["id"] {
+		t.Fatalf("recurring expenses: got %v", templates)
+	}
+	outsider.call("GET", fmt.Sprintf("/api/recurring/%v", rec["id"]), nil, http.StatusForbidden)
+	bob.callInto("GET", balancesPath, nil, http.StatusOK, &transfers)
+	if len(transfers) != 1 || transfers[0]["amount"].(float64) != 500 {
+		t.Fatalf("balances after the rent: got %v", transfers)
+	}
+
+	receipt := []byte("%PDF-1.4\n%%EOF\n")
+	attachmentsPath := fmt.Sprintf("/api/expense/%v/attachments", dinner["expense_id"])
+	uploaded := bob.upload(attachmentsPath, "receipt.pdf", receipt, http.StatusCreated)
+	if uploaded["content_type"] != "application/pdf" || uploaded["file_name"] != "receipt.pdf" {
+		t.Fatalf("upload: got %v", uploaded)
+	}
+	var attached []map[string]interface{}
+	alice.callInto("GET", attachmentsPath, nil, http.StatusOK, &attached)
+	if len(attached) != 1 || attached[0]["id"] != uploaded["id"] {
+		t.Fatalf("attachments: got %v", attached)
+	}
+	downloaded := alice.send("GET", uploaded["download_url"].(string), "", nil, http.StatusOK)
+	if !bytes.Equal(downloaded, receipt) {
+		t.Fatalf("download: got %q, want %q", downloaded, receipt)
+	}
+	outsider.send("GET", uploaded["download_url"].(string), "", nil, http.StatusForbidden)
+}
+
+// TestCreditorReversal checks that a reversal by the creditor leaves the debtor's balance settled
+// until the debtor confirms it.
+func TestCreditorReversal(t *testing.T) {
+	server := newServer(t)
+	alice, aliceID := signUp(t, server, "alice")
+	bob, bobID := signUp(t, server, "bob")
+
+	group := alice.call("POST", "/api/group", map[string]string{"name": "Flat", "base_currency": "INR"}, http.StatusCreated)
+	groupID := int(group["group_id"].(float64))
+	alice.call("POST", "/api/group/addUser", map[string]int{"groupId": groupID, "userId": bobID}, http.StatusOK)
+	alice.call("POST", "/api/expense", map[string]interface{}{
+		"description": "Groceries",
+		"amount":      "300",
+		"split_type":  "equal",
+		"group_id":    groupID,
+		"contributors": []map[string]interface{}{
+			{"user_id": aliceID, "paid_amount": "300"},
+			{"user_id": bobID, "paid_amount": "0"},
+		},
+	}, http.StatusOK)
+
+	settled := bob.call("POST", fmt.Sprintf("/api/settle/%d/group/%d/%d", groupID, bobID, aliceID), nil, http.StatusAccepted)
+	settlementPath := fmt.Sprintf("/api/settlements/group/%v", settled["settlement_id"])
+	alice.call("POST", settlementPath+"/confirm", nil, http.StatusOK)
+
+	reversed := alice.call("POST", settlementPath+"/reverse", nil, http.StatusOK)
+	if reversed["status"] != "pending" {
+		t.Fatalf("reverse: got %v", reversed)
+	}
+	alice.call("POST", settlementPath+"/reverse", nil, http.StatusConflict)
+
+	balancesPath := fmt.Sprintf("/api/group/%d/balances", groupID)
+	var transfers []map[string]interface{}
+	bob.callInto("GET", balancesPath, nil, http.StatusOK, &transfers)
+	if len(transfers) != 0 {
+		t.Fatalf("a pending reversal changed the balances: got %v", transfers)
+	}
+
+	reversalPath := fmt.Sprintf("/api/settlements/group/%v", reversed["reversal_id"])
+	alice.call("POST", reversalPath+"/confirm", nil, http.StatusForbidden)
+	bob.call("POST", reversalPath+"/confirm", nil, http.StatusOK)
+
+	bob.callInto("GET", balancesPath, nil, http.StatusOK, &transfers)
+	if len(transfers) != 1 || int(transfers[0]["from"].(float64)) != bobID || transfers[0]["amount"].(float64) != 150 {
+		t.Fatalf("balances after confirming the reversal: got %v", transfers)
+	}
+}
@@ -0,0 +1,256 @@
+// Package settlement turns a group's net balances into a list of payments that clears them.
+package settlement
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ashishsonamm/setu-splitwise/money"
+)
+
+// Strategy selects how transfers are planned.
+type Strategy string
+
+const (
+	// Greedy repeatedly pays the largest creditor from the largest debtor. It is fast and needs at
+	// most n-1 transfers, but is not always minimal.
+	Greedy Strategy = "greedy"
+	// Minimal finds the fewest transfers possible. Groups of up to ExactLimit people are solved
+	// exactly; larger groups use a heuristic that pairs off matching debts before going greedy.
+	Minimal Strategy = "minimal"
+)
+
+// ExactLimit is the largest number of non-zero balances solved exactly by Minimal. The exact search
+// is exponential in this number.
+const ExactLimit = 18
+
+// DefaultDust is the largest balance treated as already settled: a single minor unit left over from
+// rounding is not worth a transfer.
+const DefaultDust money.Amount = 1
+
+// Transfer is one suggested payment.
+type Transfer struct {
+	From   int          `json:"from"`
+	To     int          `json:"to"`
+	Amount money.Amount `json:"amount"`
+}
+
+// ParseStrategy reads a strategy name, defaulting to Minimal when empty.
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "":
+		return Minimal, nil
+	case Greedy, Minimal:
+		return Strategy(s), nil
+	}
+	return "", fmt.Errorf("unknown settlement strategy %q: use %q or %q", s, Greedy, Minimal)
+}
+
+type entry struct {
+	userID  int
+	balance money.Amount
+}
+
+// Plan returns the transfers that clear balances (positive = owed money, negative = owes money).
+// The result depends only on the input, never on map iteration order: transfers are sorted by
+// payer, then payee. Balances within dust of zero are ignored, and a total imbalance within dust is
+// absorbed rather than left over as an extra transfer.
+func Plan(balances map[int]money.Amount, strategy Strategy, dust money.Amount) []Transfer {
+	entries := normalize(balances, dust)
+
+	var transfers []Transfer
+	switch {
+	case strategy == Greedy:
+		transfers = greedy(entries, dust)
+	case len(entries) <= ExactLimit:
+		transfers = exact(entries, dust)
+	default:
+		transfers = heuristic(entries, dust)
+	}
+
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].From != transfers[j].From {
+			return transfers[i].From < transfers[j].From
+		}
+		return transfers[i].To < transfers[j].To
+	})
+	return transfers
+}
+
+// normalize drops balances within dust of zero and returns the rest sorted by user ID. If what is
+// left does not add up to zero but is off by no more than dust, the difference is taken out of the
+// largest balance on the heavier side so the exact search can still find zero-sum groups.
+func normalize(balances map[int]money.Amount, dust money.Amount) []entry {
+	entries := make([]entry, 0, len(balances))
+	var total money.Amount
+	for userID, balance := range balances {
+		if balance.Abs() <= dust {
+			continue
+		}
+		entries = append(entries, entry{userID, balance})
+		total += balance
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].userID < entries[j].userID })
+
+	if total != 0 && total.Abs() <= dust {
+		largest := -1
+		for i, e := range entries {
+			if (e.balance > 0) == (total > 0) && (largest < 0 || e.balance.Abs() > entries[largest].balance.Abs()) {
+				largest = i
+			}
+		}
+		if largest >= 0 {
+			entries[largest].balance -= total
+		}
+	}
+	return entries
+}
+
+// greedy settles the largest debtor against the largest creditor until one side runs out.
+func greedy(entries []entry, dust money.Amount) []Transfer {
+	var debtors, creditors []entry
+	for _, e := range entries {
+		if e.balance < 0 {
+			debtors = append(debtors, entry{e.userID, -e.balance})
+		} else if e.balance > 0 {
+			creditors = append(creditors, e)
+		}
+	}
+
+	var transfers []Transfer
+	for len(debtors) > 0 && len(creditors) > 0 {
+		sortLargestFirst(debtors)
+		sortLargestFirst(creditors)
+
+		amount := debtors[0].balance
+		if creditors[0].balance < amount {
+			amount = creditors[0].balance
+		}
+		transfers = append(transfers, Transfer{From: debtors[0].userID, To: creditors[0].userID, Amount: amount})
+
+		debtors[0].balance -= amount
+		creditors[0].balance -= amount
+		if debtors[0].balance <= dust {
+			debtors = debtors[1:]
+		}
+		if creditors[0].balance <= dust {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
+
+func sortLargestFirst(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].balance != entries[j].balance {
+			return entries[i].balance > entries[j].balance
+		}
+		return entries[i].userID < entries[j].userID
+	})
+}
+
+// exact finds the partition of balances into the largest number of zero-sum groups; each group of k
+// people then settles in k-1 transfers, which is the minimum overall. dp[mask] is the most zero-sum
+// groups the people in mask can be split into.
+func exact(entries []entry, dust money.Amount) []Transfer {
+	n := len(entries)
+	if n == 0 {
+		return nil
+	}
+
+	full := 1<<n - 1
+	sums := make([]money.Amount, full+1)
+	dp := make([]int8, full+1)
+	for mask := 1; mask <= full; mask++ {
+		low := lowestBit(mask)
+		sums[mask] = sums[mask&^(1<<low)] + entries[low].balance
+
+		best := int8(0)
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && dp[mask&^(1<<i)] > best {
+				best = dp[mask&^(1<<i)]
+			}
+		}
+		if sums[mask] == 0 {
+			best++
+		}
+		dp[mask] = best
+	}
+
+	// Walk back from the full set, peeling off one person at a time without losing a group. Reversed,
+	// that order lists people so that every zero-sum group is a contiguous run.
+	order := make([]int, 0, n)
+	for mask := full; mask != 0; {
+		closes := int8(0)
+		if sums[mask] == 0 {
+			closes = 1
+		}
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && dp[mask&^(1<<i)]+closes == dp[mask] {
+				order = append(order, i)
+				mask &^= 1 << i
+				break
+			}
+		}
+	}
+
+	var transfers []Transfer
+	var group []entry
+	var running money.Amount
+	for k := len(order) - 1; k >= 0; k-- {
+		e := entries[order[k]]
+		group = append(group, e)
+		running += e.balance
+		if running == 0 || k == 0 {
+			transfers = append(transfers, greedy(group, dust)...)
+			group = nil
+			running = 0
+		}
+	}
+	return transfers
+}
+
+// heuristic pairs off debts that exactly cancel and settles the rest greedily, for groups too large
+// for exact.
+func heuristic(entries []entry, dust money.Amount) []Transfer {
+	var transfers []Transfer
+
+	creditorsByAmount := make(map[money.Amount][]int)
+	for i, e := range entries {
+		if e.balance > 0 {
+			creditorsByAmount[e.balance] = append(creditorsByAmount[e.balance], i)
+		}
+	}
+
+	settled := make([]bool, len(entries))
+	for i, e := range entries {
+		if e.balance >= 0 {
+			continue
+		}
+		candidates := creditorsByAmount[-e.balance]
+		if len(candidates) == 0 {
+			continue
+		}
+		j := candidates[0]
+		creditorsByAmount[-e.balance] = candidates[1:]
+		transfers = append(transfers, Transfer{From: e.userID, To: entries[j].userID, Amount: -e.balance})
+		settled[i], settled[j] = true, true
+	}
+
+	var rest []entry
+	for i, e := range entries {
+		if !settled[i] {
+			rest = append(rest, e)
+		}
+	}
+	return append(transfers, greedy(rest, dust)...)
+}
+
+func lowestBit(mask int) int {
+	i := 0
+	for mask&1 == 0 {
+		mask >>= 1
+		i++
+	}
+	return i
+}
@@ -0,0 +1,160 @@
+package settlement
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ashishsonamm/setu-splitwise/money"
+)
+
+// apply replays transfers against balances and returns what is left.
+func apply(balances map[int]money.Amount, transfers []Transfer) map[int]money.Amount {
+	left := make(map[int]money.Amount, len(balances))
+	for id, b := range balances {
+		left[id] = b
+	}
+	for _, t := range transfers {
+		left[t.From] += t.Amount
+		left[t.To] -= t.Amount
+	}
+	return left
+}
+
+func assertCleared(t *testing.T, balances map[int]money.Amount, transfers []Transfer, dust money.Amount) {
+	t.Helper()
+	for id, b := range apply(balances, transfers) {
+		if b.Abs() > dust {
+			t.Errorf("user %d left with %s after %v", id, b, transfers)
+		}
+	}
+	for _, tr := range transfers {
+		if tr.Amount <= 0 {
+			t.Errorf("non-positive transfer %+v", tr)
+		}
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for in, want := range map[string]Strategy{"": Minimal, "minimal": Minimal, "greedy": Greedy} {
+		got, err := ParseStrategy(in)
+		if err != nil || got != want {
+			t.Errorf("ParseStrategy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseStrategy("optimal"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestPlanEmptyAndSettled(t *testing.T) {
+	for _, strategy := range []Strategy{Greedy, Minimal} {
+		if got := Plan(nil, strategy, 0); len(got) != 0 {
+			t.Errorf("%s: expected no transfers for no balances, got %v", strategy, got)
+		}
+		if got := Plan(map[int]money.Amount{1: 0, 2: 0}, strategy, 0); len(got) != 0 {
+			t.Errorf("%s: expected no transfers for settled balances, got %v", strategy, got)
+		}
+	}
+}
+
+func TestPlanSimple(t *testing.T) {
+	balances := map[int]money.Amount{1: 6000, 2: -3000, 3: -3000}
+	want := []Transfer{{From: 2, To: 1, Amount: 3000}, {From: 3, To: 1, Amount: 3000}}
+	for _, strategy := range []Strategy{Greedy, Minimal} {
+		if got := Plan(balances, strategy, 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", strategy, got, want)
+		}
+	}
+}
+
+func TestMinimalBeatsGreedy(t *testing.T) {
+	// {1,3} and {2,4,5} cancel out on their own, so 3 transfers suffice. Greedy starts by paying the
+	// largest debtor (5) to the largest creditor (3) and ends up needing 4.
+	balances := map[int]money.Amount{1: -300, 2: 200, 3: 300, 4: 200, 5: -400}
+
+	greedyPlan := Plan(balances, Greedy, 0)
+	minimalPlan := Plan(balances, Minimal, 0)
+	assertCleared(t, balances, greedyPlan, 0)
+	assertCleared(t, balances, minimalPlan, 0)
+
+	if len(minimalPlan) != 3 {
+		t.Fatalf("minimal plan has %d transfers, want 3: %v", len(minimalPlan), minimalPlan)
+	}
+	if len(greedyPlan) <= len(minimalPlan) {
+		t.Fatalf("expected greedy (%d) to need more transfers than minimal (%d)", len(greedyPlan), len(minimalPlan))
+	}
+}
+
+func TestPlanIsDeterministic(t *testing.T) {
+	balances := map[int]money.Amount{}
+	for id := 1; id <= 12; id++ {
+		balances[id] = money.Amount((id%5 - 2) * 1000)
+	}
+	var total money.Amount
+	for _, b := range balances {
+		total += b
+	}
+	balances[13] = -total
+
+	for _, strategy := range []Strategy{Greedy, Minimal} {
+		first := Plan(balances, strategy, 0)
+		assertCleared(t, balances, first, 0)
+		for i := 0; i < 20; i++ {
+			if got := Plan(balances, strategy, 0); !reflect.DeepEqual(got, first) {
+				t.Fatalf("%s: plan changed between calls:\n%v\n%v", strategy, first, got)
+			}
+		}
+	}
+}
+
+func TestPlanToleratesDust(t *testing.T) {
+	// User 4's single paisa and the one-paisa overall imbalance are rounding residue.
+	balances := map[int]money.Amount{1: 3334, 2: -1667, 3: -1666, 4: 1}
+
+	for _, strategy := range []Strategy{Greedy, Minimal} {
+		got := Plan(balances, strategy, DefaultDust)
+		assertCleared(t, balances, got, DefaultDust)
+		if len(got) != 2 {
+			t.Errorf("%s: expected 2 transfers, got %v", strategy, got)
+		}
+		for _, tr := range got {
+			if tr.From == 4 || tr.To == 4 {
+				t.Errorf("%s: dust balance should not be settled: %v", strategy, got)
+			}
+		}
+	}
+}
+
+func TestPlanUnbalancedInput(t *testing.T) {
+	// Creditors are owed more than debtors owe; everything the debtors owe should still be paid.
+	balances := map[int]money.Amount{1: 5000, 2: 3000, 3: -6000}
+	for _, strategy := range []Strategy{Greedy, Minimal} {
+		left := apply(balances, Plan(balances, strategy, 0))
+		if left[3] != 0 {
+			t.Errorf("%s: debtor left with %s", strategy, left[3])
+		}
+	}
+}
+
+func TestHeuristicForLargeGroups(t *testing.T) {
+	balances := map[int]money.Amount{}
+	// Pairs that cancel exactly, plus a tail that needs greedy settling.
+	for id := 1; id <= ExactLimit; id++ {
+		balances[id] = money.Amount(id * 100)
+		balances[100+id] = -money.Amount(id * 100)
+	}
+	balances[500] = 700
+	balances[501] = -300
+	balances[502] = -400
+
+	got := Plan(balances, Minimal, 0)
+	assertCleared(t, balances, got, 0)
+
+	// Each cancelling pair is one transfer, and the three-person tail needs two.
+	if want := ExactLimit + 2; len(got) != want {
+		t.Fatalf("got %d transfers, want %d", len(got), want)
+	}
+	if again := Plan(balances, Minimal, 0); !reflect.DeepEqual(again, got) {
+		t.Fatal("heuristic plan is not deterministic")
+	}
+}
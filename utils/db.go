@@ -34,7 +34,7 @@ CREATE TABLE personal_settlements (
                                    id SERIAL PRIMARY KEY,
                                    debtor_id INT NOT NULL,
                                    creditor_id INT NOT NULL,
-                                   amount FLOAT NOT NULL,
+                                   amount BIGINT NOT NULL,
                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                                    FOREIGN KEY (debtor_id) REFERENCES users(id) ON DELETE CASCADE,
                                    FOREIGN KEY (creditor_id) REFERENCES users(id) ON DELETE CASCADE
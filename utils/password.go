@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost reads the bcrypt work factor from BCRYPT_COST, falling back to bcrypt.DefaultCost
+// when it is unset or outside the range bcrypt accepts.
+func passwordCost() int {
+	cost, err := strconv.Atoi(os.Getenv("BCRYPT_COST"))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("not anyone's password")
+	return hash
+})
+
+// DummyPasswordHash is a hash at the configured cost that no login matches. Checking a password
+// against it when the email is unknown makes that take as long as a wrong password.
+func DummyPasswordHash() string {
+	return dummyHash()
+}
+
+// isPasswordHash reports whether a stored password is a bcrypt hash rather than a legacy plaintext value.
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// VerifyPassword checks a login attempt against the stored password. Legacy rows that still hold
+// plaintext are compared in constant time; needsRehash tells the caller to replace them with a hash,
+// and is also set when a hash was made with a different cost than the one currently configured.
+func VerifyPassword(stored, password string) (ok bool, needsRehash bool, err error) {
+	if !isPasswordHash(stored) {
+		ok = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		return true, false, nil
+	}
+	return true, cost != passwordCost(), nil
+}
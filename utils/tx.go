@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so helpers that issue SQL can run either
+// standalone or as part of a larger transaction.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// ContextWithTx returns a copy of ctx carrying tx, so code that is only handed a context, such as a
+// repository, takes part in the transaction.
+func ContextWithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction ctx carries, if any.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// QuerierFor is the transaction ctx carries, or db when it carries none.
+func QuerierFor(ctx context.Context, db *sql.DB) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// RunInTx runs fn inside a single transaction on db. The transaction is committed if fn returns nil
+// and rolled back if it returns an error or panics, so multi-table writes are all-or-nothing. fn's
+// error is returned unchanged so callers can match on their own sentinel errors. If ctx already
+// carries a transaction, fn joins it instead, and it is committed or rolled back by whoever began it.
+func RunInTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}